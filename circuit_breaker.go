@@ -0,0 +1,439 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	defaultBreakerFailureRatio    = 0.5
+	defaultBreakerMinRequests     = 20
+	defaultBreakerWindow          = 10 * time.Second
+	defaultBreakerOpenTimeout     = 30 * time.Second
+	defaultBreakerHalfOpenProbes  = 1
+	defaultBreakerFailureStatuses = [...]int{429, 502, 503, 504}
+
+	breakerBuckets = 10
+)
+
+// ErrCircuitOpen is matched by errors.Is for the errors returned by an open circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState represents the state of a circuit breaker.
+type CircuitState int
+
+// The states of a circuit breaker.
+const (
+	CircuitClosed   CircuitState = iota // Requests are allowed.
+	CircuitOpen                         // Requests fail fast.
+	CircuitHalfOpen                     // A limited number of probe requests are allowed.
+)
+
+// String returns the state as a string.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the state as a string.
+func (s CircuitState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CircuitBreakerError is returned for requests rejected by an open circuit breaker.
+type CircuitBreakerError struct {
+	Node  string       // URL of the node, or empty for the cluster circuit breaker.
+	State CircuitState // State of the circuit breaker.
+}
+
+// Error returns the error message.
+func (e *CircuitBreakerError) Error() string {
+	if e.Node == "" {
+		return fmt.Sprintf("circuit breaker is %s for cluster", e.State)
+	}
+	return fmt.Sprintf("circuit breaker is %s for node %s", e.State, e.Node)
+}
+
+// Is allows to match the error with ErrCircuitOpen.
+func (e *CircuitBreakerError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreakerConfig represents the configuration of the circuit breakers.
+//
+// The client keeps a circuit breaker for the cluster, and one for each node.
+// A circuit breaker opens when the ratio of failed requests within the window
+// reaches the threshold. While it's open, the requests fail fast with a
+// CircuitBreakerError; a request to a node with an open circuit breaker is
+// retried on another node, according to the retry configuration. After the
+// open timeout, the circuit breaker lets probe requests through, and closes
+// when they all succeed.
+type CircuitBreakerConfig struct {
+	FailureRatio float64       // Ratio of failed requests which opens the circuit breaker. Default: 0.5.
+	MinRequests  int           // Minimum number of requests within the window to open the circuit breaker. Default: 20.
+	Window       time.Duration // Duration of the window for counting the requests. Default: 10s.
+
+	// Requests taking longer are counted as failures. Default: disabled.
+	LatencyThreshold time.Duration
+
+	// Response statuses counted as failures. Default: 429, 502, 503, 504.
+	// Transport errors are always counted as failures.
+	FailureStatuses []int
+
+	OpenTimeout    time.Duration // Duration of the open state before probing. Default: 30s.
+	HalfOpenProbes int           // Number of successful probe requests to close the circuit breaker. Default: 1.
+
+	DisableNodes   bool // Disable the circuit breakers for individual nodes.
+	DisableCluster bool // Disable the circuit breaker for the cluster.
+
+	// Optional function called when a circuit breaker changes state;
+	// node is empty for the cluster circuit breaker.
+	OnStateChange func(node string, from, to CircuitState)
+}
+
+// CircuitBreakerMetric represents the metric information for a circuit breaker.
+type CircuitBreakerMetric struct {
+	Node     string       `json:"node,omitempty"`
+	State    CircuitState `json:"state"`
+	Requests int          `json:"requests"`
+	Failures int          `json:"failures"`
+	Rejected int          `json:"rejected"`
+
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// String returns the circuit breaker information as a string.
+func (m CircuitBreakerMetric) String() string {
+	node := m.Node
+	if node == "" {
+		node = "cluster"
+	}
+	return fmt.Sprintf("{%s %s requests=%d failures=%d rejected=%d}", node, m.State, m.Requests, m.Failures, m.Rejected)
+}
+
+// circuitBreakers holds the circuit breakers for the cluster and the nodes.
+type circuitBreakers struct {
+	cfg CircuitBreakerConfig
+
+	cluster *circuitBreaker
+
+	mu    sync.Mutex
+	nodes map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(cfg *CircuitBreakerConfig) *circuitBreakers {
+	if cfg == nil {
+		return nil
+	}
+
+	cbs := circuitBreakers{cfg: *cfg, nodes: make(map[string]*circuitBreaker)}
+	if cbs.cfg.FailureRatio <= 0 {
+		cbs.cfg.FailureRatio = defaultBreakerFailureRatio
+	}
+	if cbs.cfg.MinRequests <= 0 {
+		cbs.cfg.MinRequests = defaultBreakerMinRequests
+	}
+	if cbs.cfg.Window <= 0 {
+		cbs.cfg.Window = defaultBreakerWindow
+	}
+	if cbs.cfg.OpenTimeout <= 0 {
+		cbs.cfg.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if cbs.cfg.HalfOpenProbes <= 0 {
+		cbs.cfg.HalfOpenProbes = defaultBreakerHalfOpenProbes
+	}
+	if len(cbs.cfg.FailureStatuses) == 0 {
+		cbs.cfg.FailureStatuses = defaultBreakerFailureStatuses[:]
+	}
+
+	if !cbs.cfg.DisableCluster {
+		cbs.cluster = cbs.newBreaker("")
+	}
+
+	return &cbs
+}
+
+func (cbs *circuitBreakers) newBreaker(node string) *circuitBreaker {
+	return &circuitBreaker{
+		cfg:     &cbs.cfg,
+		node:    node,
+		buckets: make([]breakerBucket, breakerBuckets),
+	}
+}
+
+// node returns the circuit breaker for the node, or nil when disabled.
+func (cbs *circuitBreakers) node(u string) *circuitBreaker {
+	if cbs.cfg.DisableNodes {
+		return nil
+	}
+
+	cbs.mu.Lock()
+	defer cbs.mu.Unlock()
+
+	cb, ok := cbs.nodes[u]
+	if !ok {
+		cb = cbs.newBreaker(u)
+		cbs.nodes[u] = cb
+	}
+	return cb
+}
+
+// isFailure returns true when the outcome of the request counts as a failure.
+func (cbs *circuitBreakers) isFailure(res *http.Response, err error, dur time.Duration) bool {
+	if err != nil {
+		return true
+	}
+	if cbs.cfg.LatencyThreshold > 0 && dur > cbs.cfg.LatencyThreshold {
+		return true
+	}
+	for _, code := range cbs.cfg.FailureStatuses {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// done registers the outcome of a request allowed by cb.
+//
+// Requests cancelled by the caller, or rejected by another circuit breaker, are not counted.
+func (cbs *circuitBreakers) done(cb *circuitBreaker, res *http.Response, err error, dur time.Duration) {
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen)) {
+		cb.release()
+		return
+	}
+	cb.record(cbs.isFailure(res, err, dur))
+}
+
+// metrics returns the metrics for the circuit breakers, starting with the cluster.
+func (cbs *circuitBreakers) metrics() []CircuitBreakerMetric {
+	var ms []CircuitBreakerMetric
+
+	if cbs.cluster != nil {
+		ms = append(ms, cbs.cluster.metric())
+	}
+
+	cbs.mu.Lock()
+	nodes := make([]string, 0, len(cbs.nodes))
+	for u := range cbs.nodes {
+		nodes = append(nodes, u)
+	}
+	sort.Strings(nodes)
+	for _, u := range nodes {
+		ms = append(ms, cbs.nodes[u].metric())
+	}
+	cbs.mu.Unlock()
+
+	return ms
+}
+
+// roundTripper returns a transport applying the node circuit breakers to the requests sent with next.
+func (cbs *circuitBreakers) roundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &breakerTransport{breakers: cbs, next: next}
+}
+
+// breakerTransport applies the circuit breaker of the node selected by the connection pool.
+type breakerTransport struct {
+	breakers *circuitBreakers
+	next     http.RoundTripper
+}
+
+// RoundTrip executes the request, unless the circuit breaker for the node is open.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cb := t.breakers.node(req.URL.Scheme + "://" + req.URL.Host)
+	if cb == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	t.breakers.done(cb, res, err, time.Since(start))
+
+	return res, err
+}
+
+type breakerBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// circuitBreaker tracks the outcome of requests within a sliding window of buckets.
+type circuitBreaker struct {
+	sync.Mutex
+
+	cfg  *CircuitBreakerConfig
+	node string
+
+	state    CircuitState
+	openedAt time.Time
+	buckets  []breakerBucket
+	probes   int // Probe requests in flight
+	passed   int // Successful probe requests
+	rejected int
+}
+
+// allow returns an error when the request is not allowed by the circuit breaker.
+func (cb *circuitBreaker) allow() error {
+	cb.Lock()
+	defer cb.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.cfg.OpenTimeout {
+		cb.setState(CircuitHalfOpen)
+	}
+
+	switch cb.state {
+	case CircuitOpen:
+		cb.rejected++
+		return &CircuitBreakerError{Node: cb.node, State: cb.state}
+	case CircuitHalfOpen:
+		if cb.probes+cb.passed >= cb.cfg.HalfOpenProbes {
+			cb.rejected++
+			return &CircuitBreakerError{Node: cb.node, State: cb.state}
+		}
+		cb.probes++
+	}
+
+	return nil
+}
+
+// record registers the outcome of an allowed request.
+func (cb *circuitBreaker) record(failure bool) {
+	cb.Lock()
+	defer cb.Unlock()
+
+	switch cb.state {
+	case CircuitHalfOpen:
+		if cb.probes > 0 {
+			cb.probes--
+		}
+		if failure {
+			cb.setState(CircuitOpen)
+			return
+		}
+		cb.passed++
+		if cb.passed >= cb.cfg.HalfOpenProbes {
+			cb.setState(CircuitClosed)
+		}
+	case CircuitClosed:
+		b := cb.bucket(time.Now())
+		b.requests++
+		if failure {
+			b.failures++
+		}
+
+		requests, failures := cb.counts(time.Now())
+		if requests >= cb.cfg.MinRequests && float64(failures)/float64(requests) >= cb.cfg.FailureRatio {
+			cb.setState(CircuitOpen)
+		}
+	}
+}
+
+// release registers an allowed request without outcome.
+func (cb *circuitBreaker) release() {
+	cb.Lock()
+	if cb.state == CircuitHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+	cb.Unlock()
+}
+
+// bucket returns the bucket for the time, resetting it when it's stale.
+func (cb *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	size := cb.cfg.Window / time.Duration(len(cb.buckets))
+	if size <= 0 {
+		size = 1
+	}
+	start := now.Truncate(size)
+	b := &cb.buckets[int(now.UnixNano()/int64(size))%len(cb.buckets)]
+	if !b.start.Equal(start) {
+		*b = breakerBucket{start: start}
+	}
+	return b
+}
+
+// counts returns the number of requests and failures within the window.
+func (cb *circuitBreaker) counts(now time.Time) (requests, failures int) {
+	for _, b := range cb.buckets {
+		if now.Sub(b.start) < cb.cfg.Window {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
+
+// setState changes the state and resets the counters.
+func (cb *circuitBreaker) setState(state CircuitState) {
+	if cb.state == state {
+		return
+	}
+
+	prev := cb.state
+	cb.state = state
+	cb.probes, cb.passed = 0, 0
+
+	switch state {
+	case CircuitOpen:
+		cb.openedAt = time.Now()
+	case CircuitClosed:
+		cb.openedAt = time.Time{}
+		for i := range cb.buckets {
+			cb.buckets[i] = breakerBucket{}
+		}
+	}
+
+	if cb.cfg.OnStateChange != nil {
+		go cb.cfg.OnStateChange(cb.node, prev, state)
+	}
+}
+
+func (cb *circuitBreaker) metric() CircuitBreakerMetric {
+	cb.Lock()
+	defer cb.Unlock()
+
+	m := CircuitBreakerMetric{Node: cb.node, State: cb.state, Rejected: cb.rejected}
+	m.Requests, m.Failures = cb.counts(time.Now())
+	if !cb.openedAt.IsZero() {
+		openedAt := cb.openedAt
+		m.OpenedAt = &openedAt
+	}
+	return m
+}
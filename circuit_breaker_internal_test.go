@@ -0,0 +1,173 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Cluster", func(t *testing.T) {
+		var (
+			hits   int32
+			status int32 = http.StatusServiceUnavailable
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.Header().Set("X-Elastic-Product", "Elasticsearch")
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			w.Write([]byte("{}"))
+		}))
+		defer server.Close()
+
+		changes := make(chan CircuitState, 10)
+		c, err := NewClient(Config{
+			Addresses:    []string{server.URL},
+			DisableRetry: true,
+			CircuitBreaker: &CircuitBreakerConfig{
+				MinRequests:   2,
+				OpenTimeout:   50 * time.Millisecond,
+				DisableNodes:  true,
+				OnStateChange: func(node string, from, to CircuitState) { changes <- to },
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			res, err := c.Info()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+		}
+
+		_, err = c.Info()
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected ErrCircuitOpen, got: %v", err)
+		}
+		var cbErr *CircuitBreakerError
+		if !errors.As(err, &cbErr) || cbErr.Node != "" || cbErr.State != CircuitOpen {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+		if n := atomic.LoadInt32(&hits); n != 2 {
+			t.Errorf("Unexpected number of requests: %d", n)
+		}
+
+		m := c.ClientMetrics()
+		if len(m.CircuitBreakers) != 1 || m.CircuitBreakers[0].State != CircuitOpen || m.CircuitBreakers[0].Rejected != 1 {
+			t.Errorf("Unexpected metrics: %s", m)
+		}
+
+		atomic.StoreInt32(&status, http.StatusOK)
+		time.Sleep(60 * time.Millisecond)
+
+		res, err := c.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		m = c.ClientMetrics()
+		if m.CircuitBreakers[0].State != CircuitClosed {
+			t.Errorf("Expected circuit breaker to be closed, got: %s", m.CircuitBreakers[0].State)
+		}
+
+		seen := make(map[CircuitState]bool)
+		for i := 0; i < 3; i++ {
+			select {
+			case s := <-changes:
+				seen[s] = true
+			case <-time.After(time.Second):
+				t.Fatalf("Timeout waiting for state changes, got: %v", seen)
+			}
+		}
+		for _, s := range []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed} {
+			if !seen[s] {
+				t.Errorf("Missing state change to %s", s)
+			}
+		}
+	})
+
+	t.Run("Nodes", func(t *testing.T) {
+		var badHits, goodHits int32
+		bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&badHits, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer bad.Close()
+		good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&goodHits, 1)
+			w.Header().Set("X-Elastic-Product", "Elasticsearch")
+			w.Write([]byte("{}"))
+		}))
+		defer good.Close()
+
+		c, err := NewClient(Config{
+			Addresses: []string{bad.URL, good.URL},
+			CircuitBreaker: &CircuitBreakerConfig{
+				MinRequests:    1,
+				DisableCluster: true,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		for i := 0; i < 6; i++ {
+			res, err := c.Info()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("Unexpected status: %d", res.StatusCode)
+			}
+			res.Body.Close()
+		}
+
+		if n := atomic.LoadInt32(&badHits); n != 1 {
+			t.Errorf("Unexpected number of requests to failing node: %d", n)
+		}
+		if n := atomic.LoadInt32(&goodHits); n != 6 {
+			t.Errorf("Unexpected number of requests to healthy node: %d", n)
+		}
+
+		m := c.ClientMetrics()
+		var found bool
+		for _, cb := range m.CircuitBreakers {
+			if cb.Node == bad.URL {
+				found = true
+				if cb.State != CircuitOpen {
+					t.Errorf("Expected circuit breaker to be open for %s, got: %s", cb.Node, cb.State)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Missing circuit breaker for %s: %s", bad.URL, m)
+		}
+	})
+}
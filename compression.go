@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// ResponseDecoder returns a reader decompressing the response body, see Config.ResponseDecoders.
+type ResponseDecoder func(io.Reader) (io.ReadCloser, error)
+
+// CompressionMetric represents the metric information for the compressed responses.
+type CompressionMetric struct {
+	Responses         int64 `json:"responses"`
+	CompressedBytes   int64 `json:"compressed_bytes"`
+	UncompressedBytes int64 `json:"uncompressed_bytes"`
+}
+
+// String returns the compression information as a string.
+func (m CompressionMetric) String() string {
+	return fmt.Sprintf("{responses=%d compressed_bytes=%d uncompressed_bytes=%d}", m.Responses, m.CompressedBytes, m.UncompressedBytes)
+}
+
+// responseDecompressor requests the compressed responses and decompresses them.
+type responseDecompressor struct {
+	// Accessed atomically, keep first for the 64-bit alignment.
+	responses         int64
+	compressedBytes   int64
+	uncompressedBytes int64
+
+	acceptEncoding string
+	decoders       map[string]ResponseDecoder
+}
+
+func newResponseDecompressor(enabled bool, decoders map[string]ResponseDecoder) *responseDecompressor {
+	if !enabled {
+		return nil
+	}
+
+	d := responseDecompressor{
+		decoders: map[string]ResponseDecoder{"gzip": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }},
+	}
+	var encodings []string
+	for encoding, decoder := range decoders {
+		encoding = strings.ToLower(encoding)
+		if encoding != "gzip" {
+			encodings = append(encodings, encoding)
+		}
+		d.decoders[encoding] = decoder
+	}
+	// Prefer the additional encodings, eg. zstd, and fall back to gzip.
+	sort.Strings(encodings)
+	d.acceptEncoding = strings.Join(append(encodings, "gzip"), ", ")
+
+	return &d
+}
+
+// prepare sets the Accept-Encoding header, unless the request sets it already, and returns true
+// when the response should be decompressed.
+func (d *responseDecompressor) prepare(req *http.Request) bool {
+	if req.Header.Get("Accept-Encoding") != "" {
+		return false
+	}
+	req.Header.Set("Accept-Encoding", d.acceptEncoding)
+	return true
+}
+
+// decompress replaces the compressed response body with the decompressed body.
+func (d *responseDecompressor) decompress(req *http.Request, res *http.Response) {
+	if res == nil || res.Body == nil || res.Body == http.NoBody || req.Method == http.MethodHead {
+		return
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	decoder, ok := d.decoders[encoding]
+	if !ok {
+		return
+	}
+
+	atomic.AddInt64(&d.responses, 1)
+	res.Body = &decompressBody{
+		body:    res.Body,
+		src:     &countingReader{r: res.Body, n: &d.compressedBytes},
+		decoder: decoder,
+		n:       &d.uncompressedBytes,
+	}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+}
+
+func (d *responseDecompressor) metric() CompressionMetric {
+	return CompressionMetric{
+		Responses:         atomic.LoadInt64(&d.responses),
+		CompressedBytes:   atomic.LoadInt64(&d.compressedBytes),
+		UncompressedBytes: atomic.LoadInt64(&d.uncompressedBytes),
+	}
+}
+
+// decompressBody decompresses the body on the first read.
+type decompressBody struct {
+	body    io.ReadCloser
+	src     io.Reader
+	decoder ResponseDecoder
+	n       *int64
+
+	r   io.ReadCloser
+	err error
+}
+
+func (b *decompressBody) Read(p []byte) (int, error) {
+	if b.r == nil && b.err == nil {
+		b.r, b.err = b.decoder(b.src)
+		if b.err != nil && b.err != io.EOF {
+			b.err = fmt.Errorf("cannot decompress the response body: %s", b.err)
+		}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.r.Read(p)
+	atomic.AddInt64(b.n, int64(n))
+	return n, err
+}
+
+func (b *decompressBody) Close() error {
+	if b.r != nil {
+		b.r.Close()
+	}
+	return b.body.Close()
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
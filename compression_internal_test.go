@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressResponseBody(t *testing.T) {
+	body := `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},"hits":{"hits":[]}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		switch {
+		case strings.HasPrefix(r.Header.Get("Accept-Encoding"), "reverse"):
+			w.Header().Set("Content-Encoding", "reverse")
+			w.Write([]byte(reverse(body)))
+		case strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			gw := gzip.NewWriter(w)
+			gw.Write([]byte(body))
+			gw.Close()
+		default:
+			w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Gzip", func(t *testing.T) {
+		c, _ := NewClient(Config{Addresses: []string{server.URL}, CompressResponseBody: true})
+
+		res, err := c.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if string(data) != body {
+			t.Errorf("Unexpected body: %s", data)
+		}
+		if res.Header.Get("X-Accept-Encoding") != "gzip" || res.Header.Get("Content-Encoding") != "" {
+			t.Errorf("Unexpected headers: %v", res.Header)
+		}
+
+		m := c.ClientMetrics()
+		if m.Compression == nil || m.Compression.Responses != 1 {
+			t.Fatalf("Unexpected metrics: %+v", m.Compression)
+		}
+		if m.Compression.UncompressedBytes != int64(len(body)) || m.Compression.CompressedBytes == 0 {
+			t.Errorf("Unexpected metrics: %+v", m.Compression)
+		}
+	})
+
+	t.Run("Typed", func(t *testing.T) {
+		c, _ := NewTypedClient(Config{Addresses: []string{server.URL}, CompressResponseBody: true})
+
+		res, err := c.Search().Do(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Took != 1 {
+			t.Errorf("Unexpected response: %+v", res)
+		}
+	})
+
+	t.Run("Decoders", func(t *testing.T) {
+		c, _ := NewClient(Config{
+			Addresses:            []string{server.URL},
+			CompressResponseBody: true,
+			ResponseDecoders: map[string]ResponseDecoder{
+				"reverse": func(r io.Reader) (io.ReadCloser, error) {
+					data, err := ioutil.ReadAll(r)
+					return ioutil.NopCloser(strings.NewReader(reverse(string(data)))), err
+				},
+			},
+		})
+
+		res, err := c.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(data) != body {
+			t.Errorf("Unexpected body: %s", data)
+		}
+		if res.Header.Get("X-Accept-Encoding") != "reverse, gzip" {
+			t.Errorf("Unexpected Accept-Encoding: %s", res.Header.Get("X-Accept-Encoding"))
+		}
+	})
+
+	t.Run("Explicit header", func(t *testing.T) {
+		c, _ := NewClient(Config{Addresses: []string{server.URL}, CompressResponseBody: true})
+
+		res, err := c.Search(c.Search.WithHeader(map[string]string{"Accept-Encoding": "gzip"}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer res.Body.Close()
+
+		if res.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Expected the response to stay compressed, got: %v", res.Header)
+		}
+		gr, _ := gzip.NewReader(res.Body)
+		data, _ := ioutil.ReadAll(gr)
+		if !bytes.Equal(data, []byte(body)) {
+			t.Errorf("Unexpected body: %s", data)
+		}
+	})
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
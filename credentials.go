@@ -0,0 +1,573 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/security/createapikey"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/security/gettoken"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/accesstokengranttype"
+)
+
+const (
+	defaultCredentialsFileInterval = 10 * time.Second
+	defaultCredentialsRefreshAhead = time.Minute
+)
+
+// Credentials represents the authentication details for a request.
+//
+// When more than one method is set, APIKey takes precedence over
+// ServiceToken, which takes precedence over Username and Password.
+type Credentials struct {
+	Username     string `json:"username,omitempty"`      // Username for HTTP Basic Authentication.
+	Password     string `json:"password,omitempty"`      // Password for HTTP Basic Authentication.
+	APIKey       string `json:"api_key,omitempty"`       // Base64-encoded API key.
+	ServiceToken string `json:"service_token,omitempty"` // Service token or access token, sent as a Bearer token.
+
+	// Expiration is the time after which the credentials must be requested
+	// again from the provider. The zero value means they never expire.
+	Expiration time.Time `json:"-"`
+}
+
+// IsZero returns true when no authentication method is set.
+func (c Credentials) IsZero() bool {
+	return c.APIKey == "" && c.ServiceToken == "" && c.Username == "" && c.Password == ""
+}
+
+// setReqAuth sets the Authorization header of req from the credentials.
+func (c Credentials) setReqAuth(req *http.Request) {
+	switch {
+	case c.APIKey != "":
+		req.Header.Set("Authorization", "APIKey "+c.APIKey)
+	case c.ServiceToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.ServiceToken)
+	case c.Username != "" || c.Password != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// CredentialsProvider defines the interface for supplying request credentials.
+//
+// The client calls Credentials before each request which doesn't carry
+// its own Authorization header, and reuses the returned value until its
+// Expiration. It is safe to rotate the credentials without recreating
+// the client.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsInvalidator is implemented by the providers which keep their own state,
+// eg. the current token, to discard it when the credentials are rejected by the cluster.
+//
+// The client calls InvalidateCredentials with the rejected credentials after a 401
+// response, before requesting new credentials from the provider. The provider should
+// ignore credentials it has already replaced, eg. after a concurrent refresh.
+type CredentialsInvalidator interface {
+	InvalidateCredentials(creds Credentials)
+}
+
+// transportSetter is implemented by providers which perform requests
+// against the cluster, so the client can supply itself as the transport.
+type transportSetter interface {
+	setTransport(elastictransport.Interface)
+}
+
+// skipCredentialsProvider is the context key marking requests which
+// must not be authenticated with the credentials provider.
+type skipCredentialsProvider struct{}
+
+// credentialsCache wraps a provider, caching the credentials until they expire.
+type credentialsCache struct {
+	sync.Mutex
+
+	provider CredentialsProvider
+	current  Credentials
+	valid    bool
+	call     *credentialsCall
+}
+
+// credentialsCall represents a call to the provider, shared by the concurrent requests.
+type credentialsCall struct {
+	done  chan struct{}
+	creds Credentials
+	err   error
+}
+
+func newCredentialsCache(provider CredentialsProvider) *credentialsCache {
+	if provider == nil {
+		return nil
+	}
+	return &credentialsCache{provider: provider}
+}
+
+// get returns the cached credentials, or fetches them from the provider
+// when the cache is empty or expired.
+//
+// The provider is called without holding the lock, once for the concurrent requests:
+// they wait for the call in flight, unless their context is done.
+func (cc *credentialsCache) get(ctx context.Context) (Credentials, error) {
+	for {
+		cc.Lock()
+		if cc.valid && (cc.current.Expiration.IsZero() || time.Now().Before(cc.current.Expiration)) {
+			creds := cc.current
+			cc.Unlock()
+			return creds, nil
+		}
+
+		call := cc.call
+		if call == nil {
+			call = &credentialsCall{done: make(chan struct{})}
+			cc.call = call
+			cc.Unlock()
+
+			call.creds, call.err = cc.provider.Credentials(ctx)
+
+			cc.Lock()
+			if call.err == nil {
+				cc.current, cc.valid = call.creds, true
+			}
+			cc.call = nil
+			cc.Unlock()
+			close(call.done)
+
+			if call.err != nil {
+				return Credentials{}, call.err
+			}
+			return call.creds, nil
+		}
+		cc.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return Credentials{}, ctx.Err()
+		}
+
+		// Call the provider again when the call failed with the context of another request
+		if call.err != nil && (errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+			continue
+		}
+		if call.err != nil {
+			return Credentials{}, call.err
+		}
+		return call.creds, nil
+	}
+}
+
+// invalidate discards the cached credentials when they're the rejected creds,
+// and notifies the provider when it implements CredentialsInvalidator.
+func (cc *credentialsCache) invalidate(creds Credentials) {
+	cc.Lock()
+	if cc.current == creds {
+		cc.valid = false
+	}
+	cc.Unlock()
+
+	if inv, ok := cc.provider.(CredentialsInvalidator); ok {
+		inv.InvalidateCredentials(creds)
+	}
+}
+
+// StaticCredentials returns a provider which always returns creds.
+func StaticCredentials(creds Credentials) CredentialsProvider {
+	return staticCredentials(creds)
+}
+
+type staticCredentials Credentials
+
+// Credentials returns the static credentials.
+func (s staticCredentials) Credentials(context.Context) (Credentials, error) {
+	return Credentials(s), nil
+}
+
+// FileCredentialsProvider reads credentials from a file, and reloads them when the file changes.
+//
+// The file is checked for modifications at most once per Interval, which allows
+// to rotate the credentials by replacing the file, eg. a mounted Kubernetes secret.
+type FileCredentialsProvider struct {
+	Path     string        // Path to the credentials file.
+	Interval time.Duration // How often to check the file for changes. Default: 10s.
+
+	// Optional function to parse the file contents. Default: JSON with the
+	// "username", "password", "api_key" and "service_token" properties.
+	Parse func([]byte) (Credentials, error)
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	current Credentials
+}
+
+// Credentials returns the credentials from the file, re-reading it when it has changed.
+func (p *FileCredentialsProvider) Credentials(context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultCredentialsFileInterval
+	}
+
+	fi, err := os.Stat(p.Path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("cannot read credentials file: %s", err)
+	}
+
+	if p.current.IsZero() || !fi.ModTime().Equal(p.modTime) || fi.Size() != p.size {
+		data, err := ioutil.ReadFile(p.Path)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("cannot read credentials file: %s", err)
+		}
+
+		parse := p.Parse
+		if parse == nil {
+			parse = parseCredentialsJSON
+		}
+
+		creds, err := parse(data)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("cannot parse credentials file: %s", err)
+		}
+		if creds.IsZero() {
+			return Credentials{}, fmt.Errorf("cannot parse credentials file: no credentials in %q", p.Path)
+		}
+
+		p.current, p.modTime, p.size = creds, fi.ModTime(), fi.Size()
+	}
+
+	creds := p.current
+	creds.Expiration = time.Now().Add(interval)
+
+	return creds, nil
+}
+
+// InvalidateCredentials forces the file to be read again on the next call to Credentials.
+func (p *FileCredentialsProvider) InvalidateCredentials(Credentials) {
+	p.mu.Lock()
+	p.current = Credentials{}
+	p.mu.Unlock()
+}
+
+func parseCredentialsJSON(data []byte) (Credentials, error) {
+	var creds Credentials
+	if err := json.Unmarshal(bytes.TrimSpace(data), &creds); err != nil {
+		return Credentials{}, err
+	}
+	return creds, nil
+}
+
+// TokenCredentialsConfig represents the configuration of a TokenCredentialsProvider.
+type TokenCredentialsConfig struct {
+	// The transport used to request tokens. Default: the client using the provider.
+	Transport elastictransport.Interface
+
+	// Credentials used to authenticate the token requests.
+	// Default: the static credentials of the transport, eg. Config.Username and Config.Password.
+	Auth Credentials
+
+	// Grant type of the token request, "password" or "client_credentials". Default: "password"
+	// when Auth has a username and password, "client_credentials" otherwise.
+	GrantType string
+
+	// Duration before the token expiry when it is refreshed. Default: 1m.
+	RefreshBefore time.Duration
+}
+
+// TokenCredentialsProvider supplies OAuth2 access tokens obtained with the Get token API,
+// and refreshes them before they expire.
+//
+// See: https://www.elastic.co/guide/en/elasticsearch/reference/current/security-api-get-token.html
+type TokenCredentialsProvider struct {
+	mu sync.Mutex
+
+	transport     elastictransport.Interface
+	auth          Credentials
+	grantType     accesstokengranttype.AccessTokenGrantType
+	refreshBefore time.Duration
+
+	accessToken  string
+	refreshToken string
+	expires      time.Time
+}
+
+// NewTokenCredentialsProvider creates a new provider for access tokens.
+func NewTokenCredentialsProvider(cfg TokenCredentialsConfig) (*TokenCredentialsProvider, error) {
+	p := TokenCredentialsProvider{
+		transport:     cfg.Transport,
+		auth:          cfg.Auth,
+		refreshBefore: cfg.RefreshBefore,
+	}
+
+	switch {
+	case cfg.GrantType != "":
+		if err := p.grantType.UnmarshalText([]byte(cfg.GrantType)); err != nil {
+			return nil, fmt.Errorf("cannot create token provider: %s", err)
+		}
+		if p.grantType != accesstokengranttype.Password && p.grantType != accesstokengranttype.Clientcredentials {
+			return nil, fmt.Errorf("cannot create token provider: unsupported grant type %q", cfg.GrantType)
+		}
+	case cfg.Auth.Username != "" && cfg.Auth.Password != "":
+		p.grantType = accesstokengranttype.Password
+	default:
+		p.grantType = accesstokengranttype.Clientcredentials
+	}
+
+	if p.grantType == accesstokengranttype.Password && (cfg.Auth.Username == "" || cfg.Auth.Password == "") {
+		return nil, errors.New("cannot create token provider: password grant requires username and password")
+	}
+
+	if p.refreshBefore <= 0 {
+		p.refreshBefore = defaultCredentialsRefreshAhead
+	}
+
+	return &p, nil
+}
+
+func (p *TokenCredentialsProvider) setTransport(tp elastictransport.Interface) {
+	p.mu.Lock()
+	if p.transport == nil {
+		p.transport = tp
+	}
+	p.mu.Unlock()
+}
+
+// Credentials returns the current access token, requesting a new one when it is about to expire.
+func (p *TokenCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.accessToken == "" || !time.Now().Before(p.expires.Add(-p.refreshBefore)) {
+		if err := p.refresh(ctx); err != nil {
+			return Credentials{}, err
+		}
+	}
+
+	return Credentials{
+		ServiceToken: p.accessToken,
+		Expiration:   p.expires.Add(-p.refreshBefore),
+	}, nil
+}
+
+// InvalidateCredentials discards the access token when it's the rejected one, eg. when it was
+// invalidated, so that a new token is requested on the next call to Credentials.
+func (p *TokenCredentialsProvider) InvalidateCredentials(creds Credentials) {
+	p.mu.Lock()
+	if creds.ServiceToken == p.accessToken {
+		p.accessToken = ""
+	}
+	p.mu.Unlock()
+}
+
+// refresh requests a new token, using the refresh token when one is available.
+func (p *TokenCredentialsProvider) refresh(ctx context.Context) error {
+	if p.transport == nil {
+		return errors.New("cannot get token: missing transport")
+	}
+
+	req := gettoken.NewRequest()
+	if p.refreshToken != "" {
+		req.GrantType = &accesstokengranttype.Refreshtoken
+		req.RefreshToken = &p.refreshToken
+	} else {
+		grantType := p.grantType
+		req.GrantType = &grantType
+		if grantType == accesstokengranttype.Password {
+			req.Username = &p.auth.Username
+			req.Password = &p.auth.Password
+		}
+	}
+
+	start := time.Now()
+	res, err := p.do(ctx, gettoken.New(p.transport).Request(req))
+	if err != nil && p.refreshToken != "" {
+		// The refresh token can be used only once and expires after 24h,
+		// start over with the configured grant.
+		p.refreshToken = ""
+		return p.refresh(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot get token: %s", err)
+	}
+
+	p.accessToken = res.AccessToken
+	p.expires = start.Add(time.Duration(res.ExpiresIn) * time.Second)
+	p.refreshToken = ""
+	if res.RefreshToken != nil {
+		p.refreshToken = *res.RefreshToken
+	}
+
+	return nil
+}
+
+func (p *TokenCredentialsProvider) do(ctx context.Context, r *gettoken.GetToken) (*gettoken.Response, error) {
+	if !p.auth.IsZero() {
+		r.Header("Authorization", authHeader(p.auth))
+	}
+	return r.Do(context.WithValue(ctx, skipCredentialsProvider{}, true))
+}
+
+// APIKeyCredentialsConfig represents the configuration of an APIKeyCredentialsProvider.
+type APIKeyCredentialsConfig struct {
+	// The transport used to create API keys. Default: the client using the provider.
+	Transport elastictransport.Interface
+
+	// Credentials used to authenticate the create API key requests.
+	// Default: the static credentials of the transport, eg. Config.Username and Config.Password.
+	Auth Credentials
+
+	Name       string        // Name of the created API keys.
+	Expiration time.Duration // Lifetime of the created API keys. Required.
+
+	// Optional role descriptors restricting the API keys; as expected by the Create API key API.
+	RoleDescriptors json.RawMessage
+
+	// Duration before the key expiry when a new one is created. Default: 1m.
+	RefreshBefore time.Duration
+}
+
+// APIKeyCredentialsProvider supplies API keys created with the Create API key API,
+// and creates a new key before the current one expires.
+//
+// Expired keys are not invalidated by the provider.
+//
+// See: https://www.elastic.co/guide/en/elasticsearch/reference/current/security-api-create-api-key.html
+type APIKeyCredentialsProvider struct {
+	mu sync.Mutex
+
+	transport     elastictransport.Interface
+	auth          Credentials
+	req           createapikey.Request
+	refreshBefore time.Duration
+
+	apiKey  string
+	expires time.Time
+}
+
+// NewAPIKeyCredentialsProvider creates a new provider for API keys.
+func NewAPIKeyCredentialsProvider(cfg APIKeyCredentialsConfig) (*APIKeyCredentialsProvider, error) {
+	if cfg.Expiration <= 0 {
+		return nil, errors.New("cannot create API key provider: missing expiration")
+	}
+
+	p := APIKeyCredentialsProvider{
+		transport:     cfg.Transport,
+		auth:          cfg.Auth,
+		refreshBefore: cfg.RefreshBefore,
+	}
+
+	if p.refreshBefore <= 0 {
+		p.refreshBefore = defaultCredentialsRefreshAhead
+	}
+	if p.refreshBefore >= cfg.Expiration {
+		return nil, errors.New("cannot create API key provider: refresh duration exceeds expiration")
+	}
+
+	if cfg.Name != "" {
+		p.req.Name = &cfg.Name
+	}
+	p.req.Expiration = formatDuration(cfg.Expiration)
+	if len(cfg.RoleDescriptors) > 0 {
+		if err := json.Unmarshal(cfg.RoleDescriptors, &p.req.RoleDescriptors); err != nil {
+			return nil, fmt.Errorf("cannot create API key provider: cannot parse role descriptors: %s", err)
+		}
+	}
+
+	return &p, nil
+}
+
+func (p *APIKeyCredentialsProvider) setTransport(tp elastictransport.Interface) {
+	p.mu.Lock()
+	if p.transport == nil {
+		p.transport = tp
+	}
+	p.mu.Unlock()
+}
+
+// Credentials returns the current API key, creating a new one when it is about to expire.
+func (p *APIKeyCredentialsProvider) Credentials(ctx context.Context) (Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.apiKey == "" || (!p.expires.IsZero() && !time.Now().Before(p.expires.Add(-p.refreshBefore))) {
+		if p.transport == nil {
+			return Credentials{}, errors.New("cannot create API key: missing transport")
+		}
+
+		req := p.req
+		r := createapikey.New(p.transport).Request(&req)
+		if !p.auth.IsZero() {
+			r.Header("Authorization", authHeader(p.auth))
+		}
+
+		res, err := r.Do(context.WithValue(ctx, skipCredentialsProvider{}, true))
+		if err != nil {
+			return Credentials{}, fmt.Errorf("cannot create API key: %s", err)
+		}
+
+		p.apiKey = res.Encoded
+		if res.Expiration != nil {
+			p.expires = time.Unix(0, *res.Expiration*int64(time.Millisecond))
+		} else {
+			p.expires = time.Time{}
+		}
+	}
+
+	creds := Credentials{APIKey: p.apiKey}
+	if !p.expires.IsZero() {
+		creds.Expiration = p.expires.Add(-p.refreshBefore)
+	}
+
+	return creds, nil
+}
+
+// InvalidateCredentials discards the API key when it's the rejected one, eg. when it was
+// invalidated, so that a new key is created on the next call to Credentials.
+func (p *APIKeyCredentialsProvider) InvalidateCredentials(creds Credentials) {
+	p.mu.Lock()
+	if creds.APIKey == p.apiKey {
+		p.apiKey = ""
+	}
+	p.mu.Unlock()
+}
+
+// authHeader returns the value of the Authorization header for creds.
+func authHeader(creds Credentials) string {
+	req := http.Request{Header: make(http.Header)}
+	creds.setReqAuth(&req)
+	return req.Header.Get("Authorization")
+}
+
+// formatDuration converts duration to a string in the format
+// accepted by Elasticsearch.
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return fmt.Sprintf("%dnanos", d)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
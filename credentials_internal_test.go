@@ -0,0 +1,386 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCredentialsProvider(t *testing.T) {
+	t.Run("Static", func(t *testing.T) {
+		var header string
+
+		c, _ := NewClient(Config{
+			Username:            "foo",
+			Password:            "bar",
+			CredentialsProvider: StaticCredentials(Credentials{APIKey: "Zm9vOmJhcg=="}),
+			Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				header = req.Header.Get("Authorization")
+				return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+			}},
+		})
+
+		if _, err := c.Info(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if header != "APIKey Zm9vOmJhcg==" {
+			t.Errorf("Unexpected Authorization header: %q", header)
+		}
+	})
+
+	t.Run("Request header takes precedence", func(t *testing.T) {
+		var header string
+
+		c, _ := NewClient(Config{
+			CredentialsProvider: StaticCredentials(Credentials{ServiceToken: "foo"}),
+			Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				header = req.Header.Get("Authorization")
+				return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+			}},
+		})
+
+		if _, err := c.Info(c.Info.WithHeader(map[string]string{"Authorization": "Bearer bar"})); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if header != "Bearer bar" {
+			t.Errorf("Unexpected Authorization header: %q", header)
+		}
+	})
+
+	t.Run("Invalidate on 401", func(t *testing.T) {
+		var calls int
+		provider := credentialsProviderFunc(func(context.Context) (Credentials, error) {
+			calls++
+			return Credentials{ServiceToken: "foo"}, nil
+		})
+
+		status := http.StatusOK
+		c, _ := NewClient(Config{
+			CredentialsProvider: provider,
+			Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+			}},
+		})
+
+		c.Info() // errcheck exclude
+		c.Info() // errcheck exclude
+		if calls != 1 {
+			t.Errorf("Expected credentials to be cached, got %d calls", calls)
+		}
+
+		status = http.StatusUnauthorized
+		c.Info() // errcheck exclude
+		status = http.StatusOK
+		c.Info() // errcheck exclude
+		if calls != 2 {
+			t.Errorf("Expected credentials to be requested after 401, got %d calls", calls)
+		}
+	})
+}
+
+func TestCredentialsCache(t *testing.T) {
+	var (
+		calls   int32
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	cc := newCredentialsCache(credentialsProviderFunc(func(context.Context) (Credentials, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return Credentials{ServiceToken: "foo"}, nil
+	}))
+
+	var wg sync.WaitGroup
+	results := make([]Credentials, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cc.get(context.Background())
+		}(i)
+	}
+	<-started
+
+	// The provider is called without holding the lock, so a request can give up waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cc.get(ctx); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected 1 call to the provider, got %d", n)
+	}
+	for _, creds := range results {
+		if creds.ServiceToken != "foo" {
+			t.Errorf("Unexpected credentials: %+v", creds)
+		}
+	}
+}
+
+type credentialsProviderFunc func(context.Context) (Credentials, error)
+
+func (f credentialsProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+func TestFileCredentialsProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(path, []byte(`{"api_key":"foo"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &FileCredentialsProvider{Path: path, Interval: time.Millisecond}
+
+	creds, err := p.Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if creds.APIKey != "foo" {
+		t.Errorf("Unexpected API key: %q", creds.APIKey)
+	}
+	if creds.Expiration.IsZero() {
+		t.Errorf("Expected the credentials to expire")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"username":"foo","password":"barbaz"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err = p.Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if creds.APIKey != "" || creds.Username != "foo" || creds.Password != "barbaz" {
+		t.Errorf("Expected credentials to be reloaded, got: %+v", creds)
+	}
+
+	p = &FileCredentialsProvider{
+		Path:  path,
+		Parse: func(b []byte) (Credentials, error) { return Credentials{ServiceToken: string(b)}, nil },
+	}
+	creds, _ = p.Credentials(context.Background())
+	if !strings.Contains(creds.ServiceToken, "barbaz") {
+		t.Errorf("Expected custom parser to be used, got: %+v", creds)
+	}
+
+	p = &FileCredentialsProvider{Path: filepath.Join(dir, "missing.json")}
+	if _, err := p.Credentials(context.Background()); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
+
+func TestTokenCredentialsProvider(t *testing.T) {
+	var (
+		requests []map[string]interface{}
+		headers  []string
+	)
+
+	p, err := NewTokenCredentialsProvider(TokenCredentialsConfig{
+		Auth:          Credentials{Username: "foo", Password: "bar"},
+		RefreshBefore: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c, _ := NewClient(Config{
+		CredentialsProvider: p,
+		Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+			headers = append(headers, req.Header.Get("Authorization"))
+			if req.URL.Path == "/_security/oauth2/token" {
+				var body map[string]interface{}
+				json.NewDecoder(req.Body).Decode(&body) // errcheck exclude
+				requests = append(requests, body)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(
+						`{"access_token":"token-` + string(rune('0'+len(requests))) + `","expires_in":1200,"refresh_token":"refresh","type":"Bearer"}`,
+					)),
+				}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		}},
+	})
+
+	// The token lifetime is shorter than RefreshBefore, so each request triggers a refresh.
+	c.Info() // errcheck exclude
+	c.Info() // errcheck exclude
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 token requests, got %d", len(requests))
+	}
+	if requests[0]["grant_type"] != "password" || requests[0]["username"] != "foo" {
+		t.Errorf("Unexpected token request: %v", requests[0])
+	}
+	if requests[1]["grant_type"] != "refresh_token" || requests[1]["refresh_token"] != "refresh" {
+		t.Errorf("Unexpected refresh request: %v", requests[1])
+	}
+
+	want := []string{authHeader(Credentials{Username: "foo", Password: "bar"}), "Bearer token-1"}
+	if headers[0] != want[0] || headers[1] != want[1] {
+		t.Errorf("Unexpected Authorization headers: %v", headers)
+	}
+	if headers[3] != "Bearer token-2" {
+		t.Errorf("Unexpected Authorization header after refresh: %q", headers[3])
+	}
+}
+
+func TestTokenCredentialsProviderGrantType(t *testing.T) {
+	for _, grantType := range []string{"password", "client_credentials"} {
+		if _, err := NewTokenCredentialsProvider(TokenCredentialsConfig{
+			Auth:      Credentials{Username: "foo", Password: "bar"},
+			GrantType: grantType,
+		}); err != nil {
+			t.Errorf("Unexpected error for %q: %s", grantType, err)
+		}
+	}
+
+	for _, grantType := range []string{"passwd", "refresh_token", "_kerberos"} {
+		_, err := NewTokenCredentialsProvider(TokenCredentialsConfig{GrantType: grantType})
+		if err == nil || !strings.Contains(err.Error(), "unsupported grant type") {
+			t.Errorf("Expected error for %q, got: %v", grantType, err)
+		}
+	}
+}
+
+func TestTokenCredentialsProviderRevoked(t *testing.T) {
+	var (
+		tokens  int
+		revoked = map[string]bool{"Bearer token-1": true}
+		headers []string
+	)
+
+	p, err := NewTokenCredentialsProvider(TokenCredentialsConfig{Auth: Credentials{Username: "foo", Password: "bar"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c, _ := NewClient(Config{
+		CredentialsProvider: p,
+		Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/_security/oauth2/token" {
+				tokens++
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(
+						`{"access_token":"token-` + strconv.Itoa(tokens) + `","expires_in":3600,"refresh_token":"refresh","type":"Bearer"}`,
+					)),
+				}, nil
+			}
+			h := req.Header.Get("Authorization")
+			headers = append(headers, h)
+			if revoked[h] {
+				return &http.Response{StatusCode: http.StatusUnauthorized, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		}},
+	})
+
+	// The token is valid for one hour, but it's revoked: a new one is requested after the 401 response.
+	c.Info() // errcheck exclude
+	c.Info() // errcheck exclude
+	c.Info() // errcheck exclude
+
+	if tokens != 2 {
+		t.Errorf("Expected a new token after the 401 response, got %d token requests", tokens)
+	}
+	if len(headers) != 3 || headers[0] != "Bearer token-1" || headers[1] != "Bearer token-2" || headers[2] != "Bearer token-2" {
+		t.Errorf("Unexpected Authorization headers: %v", headers)
+	}
+
+	// A token which was already replaced is not discarded.
+	p.InvalidateCredentials(Credentials{ServiceToken: "token-1"})
+	c.Info() // errcheck exclude
+	if tokens != 2 {
+		t.Errorf("Expected the current token to be kept, got %d token requests", tokens)
+	}
+}
+
+func TestAPIKeyCredentialsProvider(t *testing.T) {
+	if _, err := NewAPIKeyCredentialsProvider(APIKeyCredentialsConfig{}); err == nil {
+		t.Errorf("Expected error for missing expiration")
+	}
+
+	var created int
+	expiration := time.Now().Add(time.Hour)
+
+	p, err := NewAPIKeyCredentialsProvider(APIKeyCredentialsConfig{
+		Name:       "my-service",
+		Expiration: 2 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	c, _ := NewClient(Config{
+		CredentialsProvider: p,
+		Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/_security/api_key" {
+				created++
+				body, _ := ioutil.ReadAll(req.Body)
+				if !strings.Contains(string(body), `"expiration":"7200000ms"`) {
+					t.Errorf("Unexpected request body: %s", body)
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body: ioutil.NopCloser(strings.NewReader(
+						`{"id":"id","name":"my-service","api_key":"key","encoded":"aWQ6a2V5","expiration":` +
+							strconv.FormatInt(expiration.UnixNano()/int64(time.Millisecond), 10) + `}`,
+					)),
+				}, nil
+			}
+			if h := req.Header.Get("Authorization"); h != "APIKey aWQ6a2V5" {
+				t.Errorf("Unexpected Authorization header: %q", h)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		}},
+	})
+
+	c.Info() // errcheck exclude
+	c.Info() // errcheck exclude
+
+	if created != 1 {
+		t.Errorf("Expected 1 API key to be created, got %d", created)
+	}
+}
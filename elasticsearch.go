@@ -18,6 +18,7 @@
 package elasticsearch
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -32,6 +33,7 @@ import (
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8/typedapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/elastic/go-elasticsearch/v8/internal/version"
@@ -55,10 +57,11 @@ const (
 )
 
 var (
-	esCompatHeader = "ELASTIC_CLIENT_APIVERSIONING"
-	userAgent      string
-	reGoVersion    = regexp.MustCompile(`go(\d+\.\d+\..+)`)
-	reMetaVersion  = regexp.MustCompile("([0-9.]+)(.*)")
+	esCompatHeader       = "ELASTIC_CLIENT_APIVERSIONING"
+	esStrictDeprecations = "ELASTIC_CLIENT_STRICT_DEPRECATIONS"
+	userAgent            string
+	reGoVersion          = regexp.MustCompile(`go(\d+\.\d+\..+)`)
+	reMetaVersion        = regexp.MustCompile("([0-9.]+)(.*)")
 )
 
 func init() {
@@ -76,6 +79,10 @@ type Config struct {
 	ServiceToken           string // Service token for authorization; if set, overrides username/password.
 	CertificateFingerprint string // SHA256 hex fingerprint given by Elasticsearch on first launch.
 
+	// Optional provider of credentials, consulted for each request;
+	// if set, overrides APIKey, ServiceToken and username/password.
+	CredentialsProvider CredentialsProvider
+
 	Header http.Header // Global HTTP request header.
 
 	// PEM-encoded certificate authorities.
@@ -83,6 +90,15 @@ type Config struct {
 	// The option is only valid when the transport is not specified, or when it's http.Transport.
 	CACert []byte
 
+	// PEM-encoded client certificate and key for mutual TLS authentication.
+	// The option is only valid when the transport is not specified, or when it's http.Transport.
+	ClientCert    []byte
+	ClientCertKey []byte
+
+	// Optional source of the certificate authorities and client certificate, consulted
+	// for each request; allows to rotate the certificates at runtime, see FileTLSSource.
+	TLSSource TLSSource
+
 	RetryOnStatus []int                           // List of status codes for retry. Default: 502, 503, 504.
 	DisableRetry  bool                            // Default: false.
 	MaxRetries    int                             // Default: 3.
@@ -91,6 +107,11 @@ type Config struct {
 	CompressRequestBody      bool // Default: false.
 	CompressRequestBodyLevel int  // Default: gzip.DefaultCompression.
 
+	// Request compressed responses with the Accept-Encoding header, and decompress them transparently. Default: false.
+	CompressResponseBody bool
+	// Optional decoders for additional response encodings, eg. "zstd", preferred over gzip. Default: nil.
+	ResponseDecoders map[string]ResponseDecoder
+
 	DiscoverNodesOnStart  bool          // Discover nodes when initializing the client. Default: false.
 	DiscoverNodesInterval time.Duration // Discover nodes periodically. Default: disabled.
 
@@ -102,6 +123,13 @@ type Config struct {
 
 	RetryBackoff func(attempt int) time.Duration // Optional backoff duration. Default: nil.
 
+	CircuitBreaker *CircuitBreakerConfig // Optional circuit breakers for the cluster and the nodes. Default: disabled.
+	RateLimit      *RateLimitConfig      // Optional client-side rate limits and concurrency caps. Default: disabled.
+	Hedging        *HedgingConfig        // Optional hedging of read-only requests across nodes. Default: disabled.
+	Warnings       *WarningsConfig       // Optional handling of the deprecation warnings. Default: disabled.
+
+	Serializer serializer.Serializer // Optional serializer of the typed API request and response bodies. Default: encoding/json.
+
 	Transport http.RoundTripper         // The HTTP transport object.
 	Logger    elastictransport.Logger   // The logger object.
 	Selector  elastictransport.Selector // The selector object.
@@ -119,6 +147,19 @@ type BaseClient struct {
 	disableMetaHeader   bool
 	productCheckMu      sync.RWMutex
 	productCheckSuccess bool
+
+	credentials *credentialsCache
+	retry       retryConfig
+	breakers    *circuitBreakers
+	limiter     *rateLimiter
+	hedger      *hedger
+	warnings    *warningsHandler
+	decompress  *responseDecompressor
+	serializer  serializer.Serializer
+
+	transportConfig  elastictransport.Config
+	nodeTransportsMu sync.Mutex
+	nodeTransports   map[string]*elastictransport.Client
 }
 
 // Client represents the Functional Options API.
@@ -155,13 +196,24 @@ func NewDefaultClient() (*Client, error) {
 //
 // It's an error to set both cfg.Addresses and cfg.CloudID.
 func NewClient(cfg Config) (*Client, error) {
-	tp, err := newTransport(cfg)
+	tpConfig, err := newTransportConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	breakers, hedger, err := wrapTransport(&tpConfig, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tp, err := newTransport(tpConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	compatHeaderEnv := os.Getenv(esCompatHeader)
 	compatibilityHeader, _ := strconv.ParseBool(compatHeaderEnv)
+	strictDeprecations, _ := strconv.ParseBool(os.Getenv(esStrictDeprecations))
 
 	client := &Client{
 		BaseClient: BaseClient{
@@ -169,10 +221,23 @@ func NewClient(cfg Config) (*Client, error) {
 			disableMetaHeader:   cfg.DisableMetaHeader,
 			metaHeader:          initMetaHeader(tp),
 			compatibilityHeader: cfg.EnableCompatibilityMode || compatibilityHeader,
+			credentials:         newCredentialsCache(cfg.CredentialsProvider),
+			retry:               newRetryConfig(cfg),
+			breakers:            breakers,
+			limiter:             newRateLimiter(cfg.RateLimit),
+			hedger:              hedger,
+			warnings:            newWarningsHandler(cfg.Warnings, strictDeprecations),
+			decompress:          newResponseDecompressor(cfg.CompressResponseBody, cfg.ResponseDecoders),
+			serializer:          cfg.Serializer,
+			transportConfig:     tpConfig,
 		},
 	}
 	client.API = esapi.New(client)
 
+	if ts, ok := cfg.CredentialsProvider.(transportSetter); ok {
+		ts.setTransport(client)
+	}
+
 	if cfg.DiscoverNodesOnStart {
 		go client.DiscoverNodes()
 	}
@@ -186,13 +251,24 @@ func NewClient(cfg Config) (*Client, error) {
 //
 // It will return the client with the TypedAPI.
 func NewTypedClient(cfg Config) (*TypedClient, error) {
-	tp, err := newTransport(cfg)
+	tpConfig, err := newTransportConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	breakers, hedger, err := wrapTransport(&tpConfig, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tp, err := newTransport(tpConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	compatHeaderEnv := os.Getenv(esCompatHeader)
 	compatibilityHeader, _ := strconv.ParseBool(compatHeaderEnv)
+	strictDeprecations, _ := strconv.ParseBool(os.Getenv(esStrictDeprecations))
 
 	metaHeader := strings.Join([]string{initMetaHeader(tp), "hl=1"}, ",")
 
@@ -202,10 +278,23 @@ func NewTypedClient(cfg Config) (*TypedClient, error) {
 			disableMetaHeader:   cfg.DisableMetaHeader,
 			metaHeader:          metaHeader,
 			compatibilityHeader: cfg.EnableCompatibilityMode || compatibilityHeader,
+			credentials:         newCredentialsCache(cfg.CredentialsProvider),
+			retry:               newRetryConfig(cfg),
+			breakers:            breakers,
+			limiter:             newRateLimiter(cfg.RateLimit),
+			hedger:              hedger,
+			warnings:            newWarningsHandler(cfg.Warnings, strictDeprecations),
+			decompress:          newResponseDecompressor(cfg.CompressResponseBody, cfg.ResponseDecoders),
+			serializer:          cfg.Serializer,
+			transportConfig:     tpConfig,
 		},
 	}
 	client.API = typedapi.New(client)
 
+	if ts, ok := cfg.CredentialsProvider.(transportSetter); ok {
+		ts.setTransport(client)
+	}
+
 	if cfg.DiscoverNodesOnStart {
 		go client.DiscoverNodes()
 	}
@@ -213,20 +302,78 @@ func NewTypedClient(cfg Config) (*TypedClient, error) {
 	return client, nil
 }
 
-func newTransport(cfg Config) (*elastictransport.Client, error) {
+// newTransport creates the transport from tpConfig.
+func newTransport(tpConfig elastictransport.Config) (*elastictransport.Client, error) {
+	tp, err := elastictransport.New(tpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating transport: %s", err)
+	}
+	return tp, nil
+}
+
+// wrapTransport wraps the HTTP transport of tpConfig with the circuit breakers and the hedging
+// configured in cfg, and returns them; they're nil when disabled.
+func wrapTransport(tpConfig *elastictransport.Config, cfg Config) (*circuitBreakers, *hedger, error) {
+	breakers := newCircuitBreakers(cfg.CircuitBreaker)
+	hedger := newHedger(cfg.Hedging)
+	if breakers == nil && hedger == nil {
+		return nil, nil, nil
+	}
+
+	if err := configureFingerprint(*tpConfig); err != nil {
+		return nil, nil, err
+	}
+
+	if breakers != nil {
+		tpConfig.Transport = breakers.roundTripper(tpConfig.Transport)
+	}
+
+	if hedger != nil {
+		tpConfig.Transport = hedger.roundTripper(tpConfig.Transport)
+	}
+
+	return breakers, hedger, nil
+}
+
+// configureFingerprint lets the transport install the verification of the certificate
+// fingerprint on the HTTP transport of tpConfig, before the client wraps it: elastictransport
+// only verifies the fingerprint when its transport is an *http.Transport.
+func configureFingerprint(tpConfig elastictransport.Config) error {
+	if tpConfig.CertificateFingerprint == "" {
+		return nil
+	}
+	if _, ok := tpConfig.Transport.(*http.Transport); !ok {
+		return nil
+	}
+
+	_, err := elastictransport.New(elastictransport.Config{
+		Transport:              tpConfig.Transport,
+		CertificateFingerprint: tpConfig.CertificateFingerprint,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating transport: %s", err)
+	}
+	return nil
+}
+
+// newTransportConfig returns the transport configuration from cfg.
+//
+// Retries are disabled in the transport, as they are performed by the client,
+// which allows to override the retry policy for a request with RequestOptions.
+func newTransportConfig(cfg Config) (elastictransport.Config, error) {
 	var addrs []string
 
 	if len(cfg.Addresses) == 0 && cfg.CloudID == "" {
 		addrs = addrsFromEnvironment()
 	} else {
 		if len(cfg.Addresses) > 0 && cfg.CloudID != "" {
-			return nil, errors.New("cannot create client: both Addresses and CloudID are set")
+			return elastictransport.Config{}, errors.New("cannot create client: both Addresses and CloudID are set")
 		}
 
 		if cfg.CloudID != "" {
 			cloudAddr, err := addrFromCloudID(cfg.CloudID)
 			if err != nil {
-				return nil, fmt.Errorf("cannot create client: cannot parse CloudID: %s", err)
+				return elastictransport.Config{}, fmt.Errorf("cannot create client: cannot parse CloudID: %s", err)
 			}
 			addrs = append(addrs, cloudAddr)
 		}
@@ -238,7 +385,7 @@ func newTransport(cfg Config) (*elastictransport.Client, error) {
 
 	urls, err := addrsToURLs(addrs)
 	if err != nil {
-		return nil, fmt.Errorf("cannot create client: %s", err)
+		return elastictransport.Config{}, fmt.Errorf("cannot create client: %s", err)
 	}
 
 	if len(urls) == 0 {
@@ -253,7 +400,12 @@ func newTransport(cfg Config) (*elastictransport.Client, error) {
 		cfg.Password = pw
 	}
 
-	tp, err := elastictransport.New(elastictransport.Config{
+	transport, err := configureTLS(cfg)
+	if err != nil {
+		return elastictransport.Config{}, fmt.Errorf("cannot create client: %s", err)
+	}
+
+	return elastictransport.Config{
 		UserAgent: userAgent,
 
 		URLs:                   urls,
@@ -264,13 +416,8 @@ func newTransport(cfg Config) (*elastictransport.Client, error) {
 		CertificateFingerprint: cfg.CertificateFingerprint,
 
 		Header: cfg.Header,
-		CACert: cfg.CACert,
 
-		RetryOnStatus: cfg.RetryOnStatus,
-		DisableRetry:  cfg.DisableRetry,
-		RetryOnError:  cfg.RetryOnError,
-		MaxRetries:    cfg.MaxRetries,
-		RetryBackoff:  cfg.RetryBackoff,
+		DisableRetry: true,
 
 		CompressRequestBody:      cfg.CompressRequestBody,
 		CompressRequestBodyLevel: cfg.CompressRequestBodyLevel,
@@ -280,16 +427,11 @@ func newTransport(cfg Config) (*elastictransport.Client, error) {
 
 		DiscoverNodesInterval: cfg.DiscoverNodesInterval,
 
-		Transport:          cfg.Transport,
+		Transport:          transport,
 		Logger:             cfg.Logger,
 		Selector:           cfg.Selector,
 		ConnectionPoolFunc: cfg.ConnectionPoolFunc,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error creating transport: %s", err)
-	}
-
-	return tp, nil
+	}, nil
 }
 
 // Perform delegates to Transport to execute a request and return a response.
@@ -313,14 +455,108 @@ func (c *BaseClient) Perform(req *http.Request) (*http.Response, error) {
 		req.Header.Del(HeaderClientMeta)
 	}
 
+	// Request options
+	opts, _ := RequestOptionsFromContext(req.Context())
+	if opts.OpaqueID != "" {
+		req.Header.Set(headerOpaqueID, opts.OpaqueID)
+	}
+	if opts.Traceparent != "" {
+		req.Header.Set(headerTraceparent, opts.Traceparent)
+	}
+
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), opts.Timeout)
+		req = req.WithContext(ctx)
+	}
+
+	// Response compression
+	var decompress bool
+	if c.decompress != nil {
+		decompress = c.decompress.prepare(req)
+	}
+
+	// Credentials
+	var (
+		creds           Credentials
+		withCredentials bool
+	)
+	if c.credentials != nil && req.Header.Get("Authorization") == "" && req.Context().Value(skipCredentialsProvider{}) == nil {
+		var err error
+		creds, err = c.credentials.get(req.Context())
+		if err != nil {
+			if cancel != nil {
+				cancel()
+			}
+			return nil, fmt.Errorf("cannot get credentials: %s", err)
+		}
+		creds.setReqAuth(req)
+		withCredentials = true
+	}
+
 	// Retrieve the original request.
-	return c.Transport.Perform(req)
+	var (
+		res *http.Response
+		err error
+	)
+	if c.hedger != nil && !opts.DisableHedging && opts.Node == "" && c.hedger.cfg.Hedgeable(req) {
+		res, err = c.performHedged(req, opts)
+	} else {
+		res, err = c.performWithRetry(req, opts)
+	}
+
+	if decompress && err == nil {
+		c.decompress.decompress(req, res)
+	}
+
+	// Release the timeout context once the response body is consumed.
+	if cancel != nil {
+		if res != nil && res.Body != nil {
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+		} else {
+			cancel()
+		}
+	}
+
+	// Discard the cached credentials when they were rejected, eg. revoked.
+	if withCredentials && res != nil && res.StatusCode == http.StatusUnauthorized {
+		c.credentials.invalidate(creds)
+	}
+
+	if c.warnings != nil && err == nil {
+		res, err = c.warnings.handle(req, res)
+	}
+
+	return res, err
+}
+
+// Serializer returns the serializer of the typed API request and response bodies.
+func (c *BaseClient) Serializer() serializer.Serializer {
+	if c.serializer == nil {
+		return serializer.Default
+	}
+	return c.serializer
 }
 
 // Metrics returns the client metrics.
+//
+// A request is counted once, including its retries, and its failures are counted per attempt.
+// The number of retries is reported by ClientMetrics. The requests pinned to a node
+// with RequestOptions.Node are not counted.
+//
+// The metrics collected by the client itself, eg. for the circuit breakers, are returned by ClientMetrics.
 func (c *BaseClient) Metrics() (elastictransport.Metrics, error) {
 	if mt, ok := c.Transport.(elastictransport.Measurable); ok {
-		return mt.Metrics()
+		m, err := mt.Metrics()
+		if err != nil {
+			return m, err
+		}
+		// The retries are performed by the client, so the transport counts each attempt as a request
+		if n := c.retry.metrics.transportRetries(); n > 0 && m.Requests >= n {
+			m.Requests -= n
+		}
+		return m, nil
 	}
 	return elastictransport.Metrics{}, errors.New("transport is missing method Metrics()")
 }
@@ -28,6 +28,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -37,9 +38,13 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/count"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
 var metaHeaderReValidation = regexp.MustCompile(`^[a-z]{1,}=[a-z0-9\.\-]{1,}(?:,[a-z]{1,}=[a-z0-9\.\-]+)*$`)
@@ -391,6 +396,26 @@ func TestClientMetrics(t *testing.T) {
 	if m.Requests != 0 {
 		t.Errorf("Unexpected output: %s", m)
 	}
+
+	cm := c.ClientMetrics()
+	if cm.String() != "{Retries: {requests=0 retries=0}}" {
+		t.Errorf("Unexpected client metrics: %s", cm)
+	}
+
+	c, _ = NewClient(Config{EnableMetrics: true, DisableRetry: true})
+	cm = c.ClientMetrics()
+	if cm.String() != "{}" {
+		t.Errorf("Unexpected client metrics: %s", cm)
+	}
+
+	c, _ = NewClient(Config{EnableMetrics: true, Hedging: &HedgingConfig{}, CircuitBreaker: &CircuitBreakerConfig{}})
+	if _, err := c.Metrics(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cm = c.ClientMetrics()
+	if cm.Hedging == nil || len(cm.CircuitBreakers) != 1 || !strings.HasPrefix(cm.String(), "{CircuitBreakers: [") {
+		t.Errorf("Unexpected client metrics: %s", cm)
+	}
 }
 
 func TestResponseCheckOnly(t *testing.T) {
@@ -968,3 +993,185 @@ func TestContentTypeOverride(t *testing.T) {
 		search.Do(context.Background(), tp)
 	})
 }
+
+type countingSerializer struct {
+	serializer.JSON
+	marshaled, decoded int
+}
+
+func (s *countingSerializer) Marshal(v interface{}) ([]byte, error) {
+	s.marshaled++
+	return s.JSON.Marshal(v)
+}
+
+func (s *countingSerializer) NewDecoder(r io.Reader) serializer.Decoder {
+	s.decoded++
+	return s.JSON.NewDecoder(r)
+}
+
+func TestTypedClientSerializer(t *testing.T) {
+	transport := &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Header:     http.Header{"X-Elastic-Product": []string{"Elasticsearch"}},
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"count":1,"_shards":{"total":1,"successful":1,"failed":0}}`)),
+		}, nil
+	}}
+
+	s := &countingSerializer{}
+	c, _ := NewTypedClient(Config{Transport: transport, Serializer: s})
+
+	res, err := c.Count().Request(&count.Request{Query: &types.Query{MatchAll: &types.MatchAllQuery{}}}).Do(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if res.Count != 1 {
+		t.Errorf("Unexpected response: %+v", res)
+	}
+	if s.marshaled != 1 || s.decoded != 1 {
+		t.Errorf("Expected the client serializer to be used, got: %d marshaled, %d decoded", s.marshaled, s.decoded)
+	}
+
+	override := &countingSerializer{}
+	if _, err := c.Count().Serializer(override).Do(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if override.decoded != 1 || s.decoded != 1 {
+		t.Errorf("Expected the request serializer to be used, got: %d decoded", override.decoded)
+	}
+}
+
+func TestTypedSearchStream(t *testing.T) {
+	transport := &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Header:     http.Header{"X-Elastic-Product": []string{"Elasticsearch"}},
+			StatusCode: http.StatusOK,
+			Body: ioutil.NopCloser(strings.NewReader(`{
+			  "took": 1, "timed_out": false, "_scroll_id": "abc",
+			  "_shards": {"total": 1, "successful": 1, "failed": 0},
+			  "hits": {"total": {"value": 2, "relation": "eq"}, "hits": [
+			    {"_index": "test", "_id": "1", "_source": {"title": "One"}},
+			    {"_index": "test", "_id": "2", "_source": {"title": "Two"}}
+			  ]},
+			  "aggregations": {"value_count#count": {"value": 2}}
+			}`)),
+		}, nil
+	}}
+
+	c, _ := NewTypedClient(Config{Transport: transport})
+
+	var ids []string
+	res, err := c.Search().Index("test").Scroll("1m").Stream(context.Background(), func(hit types.Hit) error {
+		ids = append(ids, hit.Id_)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if strings.Join(ids, ",") != "1,2" {
+		t.Errorf("Unexpected hits: %v", ids)
+	}
+	if len(res.Hits.Hits) != 0 || res.Hits.Total == nil || res.Hits.Total.Value != 2 {
+		t.Errorf("Unexpected hits metadata: %+v", res.Hits)
+	}
+	if res.ScrollId_ == nil || *res.ScrollId_ != "abc" {
+		t.Errorf("Unexpected scroll ID: %v", res.ScrollId_)
+	}
+	if agg, ok := res.Aggregations["count"].(*types.ValueCountAggregate); !ok || agg.Value != 2 {
+		t.Errorf("Unexpected aggregations: %#v", res.Aggregations)
+	}
+}
+
+func TestTypedRequestReuse(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	transport := &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		requests = append(requests, req.URL.Path+"?"+req.URL.RawQuery+" "+string(body))
+		mu.Unlock()
+		return &http.Response{
+			Header:     http.Header{"X-Elastic-Product": []string{"Elasticsearch"}},
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"count":1,"_shards":{"total":1,"successful":1,"failed":0}}`)),
+		}, nil
+	}}
+
+	c, _ := NewTypedClient(Config{Transport: transport})
+
+	template := c.Count().Index("test").Request(&count.Request{Query: &types.Query{MatchAll: &types.MatchAllQuery{}}})
+
+	t.Run("Reuse", func(t *testing.T) {
+		requests = nil
+		for i := 0; i < 2; i++ {
+			if _, err := template.Do(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+		}
+		if len(requests) != 2 || requests[0] != requests[1] || requests[0] != `/test/_count? {"query":{"match_all":{}}}` {
+			t.Errorf("Unexpected requests: %q", requests)
+		}
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		requests = nil
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				r := template.Clone().Routing(strconv.Itoa(i)).Header("X-Test", strconv.Itoa(i))
+				if _, err := r.Do(context.Background()); err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if len(requests) != 10 {
+			t.Fatalf("Unexpected number of requests: %d", len(requests))
+		}
+		for _, r := range requests {
+			if !strings.HasPrefix(r, "/test/_count?routing=") || !strings.HasSuffix(r, ` {"query":{"match_all":{}}}`) {
+				t.Errorf("Unexpected request: %s", r)
+			}
+		}
+
+		requests = nil
+		if _, err := template.Do(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if requests[0] != `/test/_count? {"query":{"match_all":{}}}` {
+			t.Errorf("Expected the template to be unchanged, got: %s", requests[0])
+		}
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		requests = nil
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := template.Do(context.Background()); err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				if _, err := template.HttpRequest(context.Background()); err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(requests) != 10 {
+			t.Fatalf("Unexpected number of requests: %d", len(requests))
+		}
+		for _, r := range requests {
+			if r != `/test/_count? {"query":{"match_all":{}}}` {
+				t.Errorf("Unexpected request: %s", r)
+			}
+		}
+	})
+}
@@ -0,0 +1,449 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CatIndicesRow represents a row of the cat indices API.
+//
+type CatIndicesRow struct {
+	Health        string    `cat:"health"`
+	Status        string    `cat:"status"`
+	Index         string    `cat:"index"`
+	UUID          string    `cat:"uuid"`
+	Primaries     int       `cat:"pri"`
+	Replicas      int       `cat:"rep"`
+	DocsCount     int64     `cat:"docs.count"`
+	DocsDeleted   int64     `cat:"docs.deleted"`
+	StoreSize     int64     `cat:"store.size,bytes"`
+	PriStoreSize  int64     `cat:"pri.store.size,bytes"`
+	CreationDate  time.Time `cat:"creation.date"`
+	SearchQueries int64     `cat:"search.query_total"`
+}
+
+// CatShardsRow represents a row of the cat shards API.
+//
+type CatShardsRow struct {
+	Index            string        `cat:"index"`
+	Shard            int           `cat:"shard"`
+	PriRep           string        `cat:"prirep"`
+	State            string        `cat:"state"`
+	Docs             int64         `cat:"docs"`
+	Store            int64         `cat:"store,bytes"`
+	IP               string        `cat:"ip"`
+	Node             string        `cat:"node"`
+	UnassignedReason string        `cat:"unassigned.reason"`
+	UnassignedFor    time.Duration `cat:"unassigned.for"`
+}
+
+// CatNodesRow represents a row of the cat nodes API.
+//
+type CatNodesRow struct {
+	ID              string        `cat:"id"`
+	Name            string        `cat:"name"`
+	IP              string        `cat:"ip"`
+	Version         string        `cat:"version"`
+	Roles           string        `cat:"node.role"`
+	Master          string        `cat:"master"`
+	HeapPercent     float64       `cat:"heap.percent,percent"`
+	HeapCurrent     int64         `cat:"heap.current,bytes"`
+	HeapMax         int64         `cat:"heap.max,bytes"`
+	RAMPercent      float64       `cat:"ram.percent,percent"`
+	CPU             float64       `cat:"cpu,percent"`
+	Load1m          float64       `cat:"load_1m"`
+	Load5m          float64       `cat:"load_5m"`
+	Load15m         float64       `cat:"load_15m"`
+	DiskUsed        int64         `cat:"disk.used,bytes"`
+	DiskAvail       int64         `cat:"disk.avail,bytes"`
+	DiskTotal       int64         `cat:"disk.total,bytes"`
+	DiskUsedPercent float64       `cat:"disk.used_percent,percent"`
+	Uptime          time.Duration `cat:"uptime"`
+}
+
+// CatAllocationRow represents a row of the cat allocation API.
+//
+type CatAllocationRow struct {
+	Node        string  `cat:"node"`
+	Host        string  `cat:"host"`
+	IP          string  `cat:"ip"`
+	Shards      int     `cat:"shards"`
+	DiskIndices int64   `cat:"disk.indices,bytes"`
+	DiskUsed    int64   `cat:"disk.used,bytes"`
+	DiskAvail   int64   `cat:"disk.avail,bytes"`
+	DiskTotal   int64   `cat:"disk.total,bytes"`
+	DiskPercent float64 `cat:"disk.percent,percent"`
+}
+
+// CatHealthRow represents a row of the cat health API.
+//
+type CatHealthRow struct {
+	Cluster             string        `cat:"cluster"`
+	Status              string        `cat:"status"`
+	NodeTotal           int           `cat:"node.total"`
+	NodeData            int           `cat:"node.data"`
+	Shards              int           `cat:"shards"`
+	Primaries           int           `cat:"pri"`
+	Relocating          int           `cat:"relo"`
+	Initializing        int           `cat:"init"`
+	Unassigned          int           `cat:"unassign"`
+	PendingTasks        int           `cat:"pending_tasks"`
+	MaxTaskWaitTime     time.Duration `cat:"max_task_wait_time"`
+	ActiveShardsPercent float64       `cat:"active_shards_percent,percent"`
+}
+
+// CatAliasesRow represents a row of the cat aliases API.
+//
+type CatAliasesRow struct {
+	Alias         string `cat:"alias"`
+	Index         string `cat:"index"`
+	Filter        string `cat:"filter"`
+	RoutingIndex  string `cat:"routing.index"`
+	RoutingSearch string `cat:"routing.search"`
+	IsWriteIndex  bool   `cat:"is_write_index"`
+}
+
+// Rows performs the request with the JSON format and the columns of CatIndicesRow,
+// and returns the decoded rows.
+//
+func (r CatIndicesRequest) Rows(ctx context.Context, transport Transport) ([]CatIndicesRow, error) {
+	var rows []CatIndicesRow
+	r.Format, r.H, r.Bytes, r.Time = "json", CatColumns(rows), "b", "ms"
+	return rows, decodeCatResponse(ctx, transport, r, &rows)
+}
+
+// Rows performs the request with the JSON format and the columns of CatShardsRow,
+// and returns the decoded rows.
+//
+func (r CatShardsRequest) Rows(ctx context.Context, transport Transport) ([]CatShardsRow, error) {
+	var rows []CatShardsRow
+	r.Format, r.H, r.Bytes, r.Time = "json", CatColumns(rows), "b", "ms"
+	return rows, decodeCatResponse(ctx, transport, r, &rows)
+}
+
+// Rows performs the request with the JSON format and the columns of CatNodesRow,
+// and returns the decoded rows.
+//
+func (r CatNodesRequest) Rows(ctx context.Context, transport Transport) ([]CatNodesRow, error) {
+	var rows []CatNodesRow
+	r.Format, r.H, r.Bytes, r.Time = "json", CatColumns(rows), "b", "ms"
+	r.FullID = BoolPtr(true)
+	return rows, decodeCatResponse(ctx, transport, r, &rows)
+}
+
+// Rows performs the request with the JSON format and the columns of CatAllocationRow,
+// and returns the decoded rows.
+//
+func (r CatAllocationRequest) Rows(ctx context.Context, transport Transport) ([]CatAllocationRow, error) {
+	var rows []CatAllocationRow
+	r.Format, r.H, r.Bytes = "json", CatColumns(rows), "b"
+	return rows, decodeCatResponse(ctx, transport, r, &rows)
+}
+
+// Rows performs the request with the JSON format and the columns of CatHealthRow,
+// and returns the decoded rows.
+//
+func (r CatHealthRequest) Rows(ctx context.Context, transport Transport) ([]CatHealthRow, error) {
+	var rows []CatHealthRow
+	r.Format, r.H, r.Time = "json", CatColumns(rows), "ms"
+	return rows, decodeCatResponse(ctx, transport, r, &rows)
+}
+
+// Rows performs the request with the JSON format and the columns of CatAliasesRow,
+// and returns the decoded rows.
+//
+func (r CatAliasesRequest) Rows(ctx context.Context, transport Transport) ([]CatAliasesRow, error) {
+	var rows []CatAliasesRow
+	r.Format, r.H = "json", CatColumns(rows)
+	return rows, decodeCatResponse(ctx, transport, r, &rows)
+}
+
+// CatColumns returns the columns of the row struct, or a slice of row structs,
+// from the "cat" tags of the fields, to be passed as the h parameter.
+//
+// The tag contains the name of the column, and the "bytes" or "percent" option
+// for the values to parse as byte sizes or percentages:
+//
+//	type Row struct {
+//		Index string  `cat:"index"`
+//		Size  int64   `cat:"store.size,bytes"`
+//		Disk  float64 `cat:"disk.percent,percent"`
+//	}
+//
+func CatColumns(row interface{}) []string {
+	var columns []string
+	for _, f := range catFields(catRowType(reflect.TypeOf(row))) {
+		columns = append(columns, f.column)
+	}
+	return columns
+}
+
+// DecodeCatRows decodes the JSON body of a cat API response into dest,
+// a pointer to a slice of row structs.
+//
+// The values are converted to the types of the fields: strings, booleans, integers
+// and floats; byte sizes such as "1.5kb" and percentages such as "45%"; durations
+// such as "1.2s", or plain numbers in milliseconds; and time.Time from the epoch in
+// milliseconds. Missing values, null and "-" are decoded as zero values, or nil
+// for pointer fields.
+//
+func DecodeCatRows(body io.Reader, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("cat rows: expected a pointer to a slice, got %T", dest)
+	}
+	typ := catRowType(v.Type())
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("cat rows: expected a slice of structs, got %T", dest)
+	}
+	fields := catFields(typ)
+
+	var rows []map[string]interface{}
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	if err := dec.Decode(&rows); err != nil {
+		return fmt.Errorf("cat rows: %s", err)
+	}
+
+	slice := reflect.MakeSlice(v.Elem().Type(), len(rows), len(rows))
+	for i, row := range rows {
+		elem := slice.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			elem.Set(reflect.New(typ))
+			elem = elem.Elem()
+		}
+		for _, f := range fields {
+			raw, ok := row[f.column]
+			if !ok || raw == nil {
+				continue
+			}
+			if err := setCatValue(elem.FieldByIndex(f.index), fmt.Sprint(raw), f.option); err != nil {
+				return fmt.Errorf("cat rows: column %q: %s", f.column, err)
+			}
+		}
+	}
+	v.Elem().Set(slice)
+
+	return nil
+}
+
+// decodeCatResponse performs the request, and decodes the rows into dest.
+//
+func decodeCatResponse(ctx context.Context, transport Transport, r Request, dest interface{}) error {
+	res, err := r.Do(ctx, transport)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return errors.New(res.String())
+	}
+	return DecodeCatRows(res.Body, dest)
+}
+
+type catField struct {
+	column string
+	option string
+	index  []int
+}
+
+func catRowType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+func catFields(typ reflect.Type) []catField {
+	var fields []catField
+	if typ.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		tag := typ.Field(i).Tag.Get("cat")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		f := catField{column: tag, index: typ.Field(i).Index}
+		if idx := strings.IndexByte(tag, ','); idx > -1 {
+			f.column, f.option = tag[:idx], tag[idx+1:]
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+var (
+	catTimeType     = reflect.TypeOf(time.Time{})
+	catDurationType = reflect.TypeOf(time.Duration(0))
+)
+
+func setCatValue(v reflect.Value, s string, option string) error {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "-" || s == "null" {
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setCatValue(p.Elem(), s, option); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	switch {
+	case v.Type() == catDurationType:
+		d, err := parseCatDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case v.Type() == catTimeType:
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(time.Unix(0, ms*int64(time.Millisecond)).UTC()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var (
+			n   int64
+			err error
+		)
+		if option == "bytes" {
+			n, err = parseCatBytes(s)
+		} else {
+			n, err = strconv.ParseInt(s, 10, 64)
+		}
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var (
+			n   int64
+			err error
+		)
+		if option == "bytes" {
+			n, err = parseCatBytes(s)
+		} else {
+			n, err = strconv.ParseInt(s, 10, 64)
+		}
+		if err != nil {
+			return err
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		if option == "percent" {
+			s = strings.TrimSuffix(s, "%")
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+var catByteUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"pb", 1 << 50},
+	{"tb", 1 << 40},
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// parseCatBytes parses a byte size, eg. "1.5kb", or a number of bytes.
+//
+func parseCatBytes(s string) (int64, error) {
+	s = strings.ToLower(s)
+	for _, u := range catByteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid byte size %q", s)
+			}
+			return int64(math.Round(f * u.size)), nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+var catDurationUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"nanos", time.Nanosecond},
+	{"micros", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// parseCatDuration parses a duration, eg. "1.5s", or a number of milliseconds.
+//
+func parseCatDuration(s string) (time.Duration, error) {
+	for _, u := range catDurationUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			f, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(math.Round(f * float64(u.unit))), nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(math.Round(f * float64(time.Millisecond))), nil
+}
@@ -0,0 +1,181 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type catTransport func(*http.Request) (*http.Response, error)
+
+func (t catTransport) Perform(req *http.Request) (*http.Response, error) { return t(req) }
+
+func catResponse(status int, body string) catTransport {
+	return func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+	}
+}
+
+func TestCatRows(t *testing.T) {
+	t.Run("Indices", func(t *testing.T) {
+		var req *http.Request
+		tp := func(r *http.Request) (*http.Response, error) {
+			req = r
+			return catResponse(200, `[
+				{"health":"green","status":"open","index":"test","uuid":"abc","pri":"1","rep":"1","docs.count":"1200","docs.deleted":"0",
+				 "store.size":"2048","pri.store.size":"1kb","creation.date":"1600000000000","search.query_total":"5"},
+				{"health":"red","status":"close","index":"closed","uuid":"def","pri":"1","rep":"0","docs.count":null,"store.size":null}
+			]`)(r)
+		}
+
+		rows, err := CatIndicesRequest{Index: []string{"test", "closed"}}.Rows(context.Background(), catTransport(tp))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		q := req.URL.Query()
+		if q.Get("format") != "json" || q.Get("bytes") != "b" || q.Get("time") != "ms" || !strings.HasPrefix(q.Get("h"), "health,status,index,") {
+			t.Errorf("Unexpected query: %s", req.URL.RawQuery)
+		}
+
+		if len(rows) != 2 {
+			t.Fatalf("Unexpected rows: %+v", rows)
+		}
+		r := rows[0]
+		if r.Index != "test" || r.Primaries != 1 || r.DocsCount != 1200 || r.StoreSize != 2048 || r.PriStoreSize != 1024 || r.SearchQueries != 5 {
+			t.Errorf("Unexpected row: %+v", r)
+		}
+		if !r.CreationDate.Equal(time.Unix(1600000000, 0)) {
+			t.Errorf("Unexpected creation date: %s", r.CreationDate)
+		}
+		if rows[1].DocsCount != 0 || rows[1].Status != "close" {
+			t.Errorf("Unexpected row: %+v", rows[1])
+		}
+	})
+
+	t.Run("Nodes", func(t *testing.T) {
+		body := `[{"id":"n1","name":"node-1","heap.percent":"45","cpu":"12","load_1m":"1.5","disk.used_percent":"80.5","disk.total":"1.5gb","uptime":"3.2h","node.role":"dim"}]`
+
+		rows, err := CatNodesRequest{}.Rows(context.Background(), catResponse(200, body))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		r := rows[0]
+		if r.HeapPercent != 45 || r.CPU != 12 || r.Load1m != 1.5 || r.DiskUsedPercent != 80.5 || r.Roles != "dim" {
+			t.Errorf("Unexpected row: %+v", r)
+		}
+		if r.DiskTotal != 1610612736 || r.Uptime != 192*time.Minute {
+			t.Errorf("Unexpected row: %+v", r)
+		}
+	})
+
+	t.Run("Health", func(t *testing.T) {
+		body := `[{"cluster":"test","status":"yellow","node.total":"3","unassign":"2","max_task_wait_time":"-","active_shards_percent":"95.5%"}]`
+
+		rows, err := CatHealthRequest{}.Rows(context.Background(), catResponse(200, body))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		r := rows[0]
+		if r.Status != "yellow" || r.NodeTotal != 3 || r.Unassigned != 2 || r.MaxTaskWaitTime != 0 || r.ActiveShardsPercent != 95.5 {
+			t.Errorf("Unexpected row: %+v", r)
+		}
+	})
+
+	t.Run("Aliases", func(t *testing.T) {
+		body := `[{"alias":"logs","index":"logs-1","filter":"-","is_write_index":"true"}]`
+
+		rows, err := CatAliasesRequest{}.Rows(context.Background(), catResponse(200, body))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if r := rows[0]; r.Alias != "logs" || r.Filter != "" || !r.IsWriteIndex {
+			t.Errorf("Unexpected row: %+v", r)
+		}
+	})
+
+	t.Run("Error response", func(t *testing.T) {
+		_, err := CatShardsRequest{}.Rows(context.Background(), catResponse(404, `{"error":"no such index"}`))
+		if err == nil || !strings.Contains(err.Error(), "404") {
+			t.Errorf("Expected error, got: %v", err)
+		}
+	})
+
+	t.Run("Invalid value", func(t *testing.T) {
+		_, err := CatAllocationRequest{}.Rows(context.Background(), catResponse(200, `[{"shards":"many"}]`))
+		if err == nil || !strings.Contains(err.Error(), `column "shards"`) {
+			t.Errorf("Expected error, got: %v", err)
+		}
+	})
+
+	t.Run("Custom rows", func(t *testing.T) {
+		type row struct {
+			Name    string  `cat:"name"`
+			Active  *int    `cat:"active"`
+			Size    uint64  `cat:"size,bytes"`
+			Ignored string  `cat:"-"`
+			Other   float32 `json:"other"`
+		}
+
+		if cols := CatColumns([]row{}); strings.Join(cols, ",") != "name,active,size" {
+			t.Errorf("Unexpected columns: %v", cols)
+		}
+
+		var rows []*row
+		err := DecodeCatRows(strings.NewReader(`[{"name":"search","active":"3","size":"2mb"}]`), &rows)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if rows[0].Name != "search" || rows[0].Active == nil || *rows[0].Active != 3 || rows[0].Size != 2<<20 {
+			t.Errorf("Unexpected row: %+v", rows[0])
+		}
+
+		if err := DecodeCatRows(strings.NewReader(`[]`), rows); err == nil {
+			t.Errorf("Expected error for non-pointer destination")
+		}
+	})
+
+	t.Run("Durations", func(t *testing.T) {
+		var tt = []struct {
+			value    string
+			expected time.Duration
+		}{
+			{"150", 150 * time.Millisecond},
+			{"150ms", 150 * time.Millisecond},
+			{"1.5s", 1500 * time.Millisecond},
+			{"2m", 2 * time.Minute},
+			{"1d", 24 * time.Hour},
+			{"20micros", 20 * time.Microsecond},
+			{"7nanos", 7 * time.Nanosecond},
+		}
+
+		for _, tc := range tt {
+			if d, err := parseCatDuration(tc.value); err != nil || d != tc.expected {
+				t.Errorf("Unexpected duration for %q: %s, %v", tc.value, d, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,212 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esmapping
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/getmapping"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// Difference represents a difference of the actual mapping with the expected one.
+type Difference struct {
+	Path     string      // The path of the field, eg. "user.name" or "title.raw" for multi-fields.
+	Param    string      // The mapping parameter, eg. "analyzer", or empty for missing fields.
+	Expected interface{} // The expected value, or nil when the field or the parameter is unexpected.
+	Actual   interface{} // The actual value, or nil when the field or the parameter is missing.
+}
+
+// String returns the difference as a string.
+func (d Difference) String() string {
+	switch {
+	case d.Param == "" && d.Actual == nil:
+		return fmt.Sprintf("%s: missing field of type %v", d.Path, d.Expected)
+	case d.Param == "" && d.Expected == nil:
+		return fmt.Sprintf("%s: unexpected field of type %v", d.Path, d.Actual)
+	case d.Actual == nil:
+		return fmt.Sprintf("%s: missing %s, expected %s", d.Path, d.Param, jsonString(d.Expected))
+	case d.Expected == nil:
+		return fmt.Sprintf("%s: unexpected %s %s", d.Path, d.Param, jsonString(d.Actual))
+	default:
+		return fmt.Sprintf("%s: %s is %s, expected %s", d.Path, d.Param, jsonString(d.Actual), jsonString(d.Expected))
+	}
+}
+
+// Diff returns the differences of the properties of the actual mapping with the expected one,
+// ordered by path. The fields are compared with their mapping parameters, recursively.
+func Diff(expected, actual *types.TypeMapping) ([]Difference, error) {
+	exp, err := mappingProperties(expected)
+	if err != nil {
+		return nil, err
+	}
+	act, err := mappingProperties(actual)
+	if err != nil {
+		return nil, err
+	}
+	return diffProperties("", exp, act), nil
+}
+
+// Drift returns the differences of the mapping of the index with the expected one.
+//
+// The index can be an alias, or a pattern of indices, in which case the mappings
+// of all the indices are compared, and the paths are prefixed with the index name.
+func Drift(ctx context.Context, tp elastictransport.Interface, index string, expected *types.TypeMapping) ([]Difference, error) {
+	exp, err := mappingProperties(expected)
+	if err != nil {
+		return nil, err
+	}
+
+	// The typed response is decoded as JSON, since the objects are returned without their type.
+	res, err := getmapping.New(tp).Index(index).Perform(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		e := types.NewElasticsearchError()
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+			return nil, fmt.Errorf("get mapping: %s", http.StatusText(res.StatusCode))
+		}
+		return nil, e
+	}
+
+	var indices map[string]struct {
+		Mappings struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("cannot decode the mapping: %s", err)
+	}
+
+	var diff []Difference
+	names := make(map[string]interface{}, len(indices))
+	for name := range indices {
+		names[name] = nil
+	}
+	for _, name := range sortedKeys(names) {
+		prefix := ""
+		if len(indices) > 1 {
+			prefix = name + ":"
+		}
+		for _, d := range diffProperties("", exp, indices[name].Mappings.Properties) {
+			d.Path = prefix + d.Path
+			diff = append(diff, d)
+		}
+	}
+	return diff, nil
+}
+
+// mappingProperties returns the properties of the mapping, in the JSON representation.
+func mappingProperties(m *types.TypeMapping) (map[string]interface{}, error) {
+	if m == nil {
+		return nil, nil
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	return v.Properties, nil
+}
+
+func diffProperties(path string, expected, actual map[string]interface{}) []Difference {
+	var diff []Difference
+
+	names := make(map[string]interface{}, len(expected)+len(actual))
+	for k := range expected {
+		names[k] = nil
+	}
+	for k := range actual {
+		names[k] = nil
+	}
+
+	for _, name := range sortedKeys(names) {
+		p := name
+		if path != "" {
+			p = path + "." + name
+		}
+		exp, _ := expected[name].(map[string]interface{})
+		act, _ := actual[name].(map[string]interface{})
+		switch {
+		case act == nil:
+			diff = append(diff, Difference{Path: p, Expected: propertyType(exp)})
+			continue
+		case exp == nil:
+			diff = append(diff, Difference{Path: p, Actual: propertyType(act)})
+			continue
+		}
+
+		params := make(map[string]interface{})
+		for k := range exp {
+			params[k] = nil
+		}
+		for k := range act {
+			params[k] = nil
+		}
+		for _, param := range sortedKeys(params) {
+			switch param {
+			case "properties", "fields":
+				continue
+			case "type":
+				if et, at := propertyType(exp), propertyType(act); et != at {
+					diff = append(diff, Difference{Path: p, Param: param, Expected: et, Actual: at})
+				}
+				continue
+			}
+			if ev, av := exp[param], act[param]; jsonString(ev) != jsonString(av) {
+				diff = append(diff, Difference{Path: p, Param: param, Expected: ev, Actual: av})
+			}
+		}
+
+		for _, key := range []string{"properties", "fields"} {
+			ep, _ := exp[key].(map[string]interface{})
+			ap, _ := act[key].(map[string]interface{})
+			diff = append(diff, diffProperties(p, ep, ap)...)
+		}
+	}
+
+	return diff
+}
+
+// propertyType returns the type of the property; the objects are returned without type.
+func propertyType(prop map[string]interface{}) interface{} {
+	if t, ok := prop["type"]; ok {
+		return t
+	}
+	return "object"
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esmapping
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/estest"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestDrift(t *testing.T) {
+	expected, err := FromStruct(Article{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// The objects are returned without type, and a field was added dynamically.
+	actual := map[string]interface{}{
+		"articles-v1": map[string]interface{}{"mappings": map[string]interface{}{"properties": map[string]interface{}{
+			"created_at": map[string]interface{}{"type": "date"},
+			"updated_at": map[string]interface{}{"type": "date", "format": "epoch_millis"},
+			"id":         map[string]interface{}{"type": "keyword"},
+			"title": map[string]interface{}{"type": "text", "analyzer": "standard", "fields": map[string]interface{}{
+				"raw": map[string]interface{}{"type": "keyword"},
+			}},
+			"views":     map[string]interface{}{"type": "long", "doc_values": false},
+			"rating":    map[string]interface{}{"type": "float"},
+			"published": map[string]interface{}{"type": "boolean"},
+			"tags": map[string]interface{}{"type": "nested", "properties": map[string]interface{}{
+				"name":  map[string]interface{}{"type": "keyword"},
+				"score": map[string]interface{}{"type": "float"},
+			}},
+			"author": map[string]interface{}{"properties": map[string]interface{}{
+				"name":  map[string]interface{}{"type": "text", "fields": map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword"}}},
+				"email": map[string]interface{}{"type": "keyword"},
+			}},
+			"labels":    map[string]interface{}{"type": "object", "enabled": false},
+			"thumbnail": map[string]interface{}{"type": "binary"},
+			"client_ip": map[string]interface{}{"type": "ip"},
+			"extra":     map[string]interface{}{"type": "text"},
+		}}},
+	}
+
+	mock := estest.NewMockTransport()
+	mock.Expect("GET", "/articles/_mapping").Respond(200, actual)
+
+	diff, err := Drift(context.Background(), mock, "articles", expected)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	var messages []string
+	for _, d := range diff {
+		messages = append(messages, d.String())
+	}
+	want := []string{
+		`author.email: missing ignore_above, expected 256`,
+		`extra: unexpected field of type text`,
+		`rating: type is "float", expected "double"`,
+		`title: analyzer is "standard", expected "english"`,
+		`title.plain: missing field of type text`,
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("Unexpected differences:\n%q\nwant:\n%q", messages, want)
+	}
+	mock.AssertExpectations(t)
+
+	t.Run("Multiple indices", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/articles-*/_mapping").Respond(200, map[string]interface{}{
+			"articles-v1": map[string]interface{}{"mappings": map[string]interface{}{"properties": map[string]interface{}{"id": map[string]interface{}{"type": "keyword"}}}},
+			"articles-v2": map[string]interface{}{"mappings": map[string]interface{}{"properties": map[string]interface{}{"id": map[string]interface{}{"type": "long"}}}},
+		})
+
+		m, _ := FromStruct(struct {
+			ID string `json:"id"`
+		}{})
+		diff, err := Drift(context.Background(), mock, "articles-*", m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(diff) != 1 || diff[0].Path != "articles-v2:id" || diff[0].Actual != "long" {
+			t.Errorf("Unexpected differences: %+v", diff)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/missing/_mapping").RespondError(404, "index_not_found_exception", "no such index [missing]")
+
+		_, err := Drift(context.Background(), mock, "missing", expected)
+		var e *types.ElasticsearchError
+		if !errors.As(err, &e) || e.Status != 404 {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+	})
+}
+
+func TestDiff(t *testing.T) {
+	expected, _ := FromStruct(Author{})
+	actual, _ := FromStruct(Author{})
+	if diff, err := Diff(expected, actual); err != nil || len(diff) != 0 {
+		t.Errorf("Expected no differences, got: %v, %v", diff, err)
+	}
+
+	actual.Properties["phone"] = types.NewKeywordProperty()
+	diff, err := Diff(expected, actual)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(diff) != 1 || diff[0] != (Difference{Path: "phone", Actual: "keyword"}) {
+		t.Errorf("Unexpected differences: %+v", diff)
+	}
+}
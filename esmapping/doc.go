@@ -0,0 +1,53 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/*
+Package esmapping derives the index mappings from Go structs, and detects the drift
+of the mappings in the cluster.
+
+The mapping is derived from the exported fields, with the names from the "es" or the
+"json" tags, and the types inferred from the Go types or set with the "es" tag:
+
+	type Article struct {
+	  ID        string    `json:"id"`
+	  Title     string    `json:"title" es:",type=text,analyzer=english,fields=raw:keyword"`
+	  Body      string    `json:"body" es:",type=text,index_options=offsets"`
+	  Views     int64     `json:"views" es:",doc_values=false"`
+	  Published time.Time `json:"published" es:",format=strict_date_optional_time"`
+	  Tags      []Tag     `json:"tags" es:",nested"`
+	  Internal  string    `json:"-"`
+	}
+
+	mapping, err := esmapping.FromStruct(Article{})
+	if err != nil {
+	  log.Fatalf("Error: %s", err)
+	}
+	res, err := es.Indices.Create("articles").Request(&create.Request{Mappings: mapping}).Do(ctx)
+
+The strings are mapped as keyword, the integers as long, integer, short or byte,
+the floating point numbers as double or float, time.Time as date, []byte as binary,
+and the structs as object, or nested with the "nested" option; the slices are mapped
+as their elements, and the pointers as the values. See FromStruct for the options.
+
+The mapping of an index is compared with Drift:
+
+	diff, err := esmapping.Drift(ctx, es, "articles", mapping)
+	for _, d := range diff {
+	  log.Printf("Mapping drift: %s", d)
+	}
+*/
+package esmapping
@@ -0,0 +1,284 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esmapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// FromStruct returns the mapping of the struct, or the pointer to struct.
+//
+// The "es" tag contains the name of the field, which defaults to the name in the
+// "json" tag, or the name of the Go field, followed by the options:
+//
+//	type=<type>        The field type, eg. text, keyword, ip or geo_point.
+//	nested             The nested type, for structs and slices of structs.
+//	object             The object type, for fields without mapped properties, eg. maps.
+//	fields=<fields>    The multi-fields, separated by "|", as name:type[:analyzer],
+//	                   eg. "raw:keyword|english:text:english".
+//	<param>=<value>    The other mapping parameters, eg. analyzer=english, index=false,
+//	                   doc_values=false, format=epoch_millis, ignore_above=256.
+//
+// The fields with the "-" name in the "es" tag, or in the "json" tag without
+// the "es" tag, are skipped, as the unexported fields and the interfaces without
+// the type option. The embedded structs without a name are inlined.
+func FromStruct(v interface{}) (*types.TypeMapping, error) {
+	typ := reflect.TypeOf(v)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, got %T", v)
+	}
+
+	props, err := structProperties(typ, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"properties": props})
+	if err != nil {
+		return nil, err
+	}
+	m := types.NewTypeMapping()
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %s", err)
+	}
+	return m, nil
+}
+
+// structProperties returns the properties of the struct fields, in the JSON representation.
+func structProperties(typ reflect.Type, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	if visiting[typ] {
+		return nil, fmt.Errorf("recursive type %s", typ)
+	}
+	visiting[typ] = true
+	defer delete(visiting, typ)
+
+	props := make(map[string]interface{})
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, opts, skip := fieldName(f)
+		if skip {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded, err := structProperties(ft, visiting)
+				if err != nil {
+					return nil, err
+				}
+				for k, v := range embedded {
+					if _, ok := props[k]; !ok {
+						props[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop, err := fieldProperty(f.Type, opts, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", typ.Name(), f.Name, err)
+		}
+		if prop != nil {
+			props[name] = prop
+		}
+	}
+	return props, nil
+}
+
+// fieldName returns the name and the options of the field from the tags.
+func fieldName(f reflect.StructField) (string, []string, bool) {
+	tag, ok := f.Tag.Lookup("es")
+	if !ok {
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		return name, nil, name == "-"
+	}
+	parts := strings.Split(tag, ",")
+	if parts[0] == "-" && len(parts) == 1 {
+		return "", nil, true
+	}
+	name := parts[0]
+	if name == "" {
+		name = strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			name = ""
+		}
+	}
+	return name, parts[1:], false
+}
+
+// fieldProperty returns the property of the field, or nil to skip the field.
+func fieldProperty(typ reflect.Type, opts []string, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	prop := make(map[string]interface{})
+	for _, opt := range opts {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		idx := strings.IndexByte(opt, '=')
+		if idx < 0 {
+			switch opt {
+			case "nested", "object":
+				prop["type"] = opt
+			default:
+				return nil, fmt.Errorf("invalid option %q", opt)
+			}
+			continue
+		}
+		key, value := opt[:idx], opt[idx+1:]
+		switch key {
+		case "type":
+			prop["type"] = value
+		case "fields":
+			fields, err := multiFields(value)
+			if err != nil {
+				return nil, err
+			}
+			prop["fields"] = fields
+		default:
+			prop[key] = paramValue(value)
+		}
+	}
+
+	for typ.Kind() == reflect.Ptr || (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) && typ.Elem().Kind() != reflect.Uint8 {
+		typ = typ.Elem()
+	}
+
+	if _, ok := prop["type"]; !ok {
+		t := fieldType(typ)
+		if t == "" {
+			return nil, nil
+		}
+		prop["type"] = t
+	}
+
+	switch prop["type"] {
+	case "object", "nested":
+		if typ.Kind() == reflect.Struct && typ != timeType {
+			props, err := structProperties(typ, visiting)
+			if err != nil {
+				return nil, err
+			}
+			prop["properties"] = props
+		}
+	}
+
+	return prop, nil
+}
+
+// fieldType returns the field type inferred from the Go type, or an empty string.
+func fieldType(typ reflect.Type) string {
+	switch {
+	case typ == timeType:
+		return "date"
+	case typ == rawMessageType:
+		return "object"
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return "keyword"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "long"
+	case reflect.Int32, reflect.Uint16:
+		return "integer"
+	case reflect.Int16, reflect.Uint8:
+		return "short"
+	case reflect.Int8:
+		return "byte"
+	case reflect.Uint, reflect.Uint64:
+		return "unsigned_long"
+	case reflect.Float64:
+		return "double"
+	case reflect.Float32:
+		return "float"
+	case reflect.Slice, reflect.Array:
+		return "binary"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return ""
+}
+
+// multiFields parses the multi-fields, eg. "raw:keyword|english:text:english".
+func multiFields(s string) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for _, f := range strings.Split(s, "|") {
+		parts := strings.Split(f, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid multi-field %q", f)
+		}
+		field := map[string]interface{}{"type": parts[1]}
+		if len(parts) == 3 {
+			field["analyzer"] = parts[2]
+		}
+		fields[parts[0]] = field
+	}
+	return fields, nil
+}
+
+// paramValue returns the value of the parameter as a boolean, a number or a string.
+func paramValue(s string) interface{} {
+	if b, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+		return b
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strings.Contains(s, ".") {
+		return f
+	}
+	return s
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
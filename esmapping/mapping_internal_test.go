@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esmapping
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Tag struct {
+	Name  string  `json:"name"`
+	Score float32 `json:"score"`
+}
+
+type Audit struct {
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty" es:",format=epoch_millis"`
+}
+
+type Article struct {
+	Audit
+	ID        string            `json:"id"`
+	Title     string            `json:"title" es:",type=text,analyzer=english,fields=raw:keyword|plain:text:standard"`
+	Views     int64             `json:"views" es:",doc_values=false"`
+	Rating    float64           `json:"rating"`
+	Published bool              `json:"published"`
+	Tags      []Tag             `json:"tags" es:",nested"`
+	Author    *Author           `json:"author"`
+	Labels    map[string]string `json:"labels" es:",enabled=false"`
+	Thumbnail []byte            `json:"thumbnail"`
+	IP        string            `es:"client_ip,type=ip"`
+	Extra     interface{}       `json:"extra"`
+	Internal  string            `json:"-"`
+	Skipped   string            `json:"skipped" es:"-"`
+	private   string
+}
+
+type Author struct {
+	Name  string `json:"name" es:",type=text,fields=keyword:keyword"`
+	Email string `json:"email" es:",ignore_above=256"`
+}
+
+type Node struct {
+	Children []Node `json:"children"`
+}
+
+func TestFromStruct(t *testing.T) {
+	t.Run("Properties", func(t *testing.T) {
+		m, err := FromStruct(&Article{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		body, _ := json.Marshal(m)
+		var actual map[string]interface{}
+		json.Unmarshal(body, &actual)
+
+		var expected map[string]interface{}
+		json.Unmarshal([]byte(`{"properties": {
+			"created_at": {"type": "date"},
+			"updated_at": {"type": "date", "format": "epoch_millis"},
+			"id": {"type": "keyword"},
+			"title": {"type": "text", "analyzer": "english", "fields": {"raw": {"type": "keyword"}, "plain": {"type": "text", "analyzer": "standard"}}},
+			"views": {"type": "long", "doc_values": false},
+			"rating": {"type": "double"},
+			"published": {"type": "boolean"},
+			"tags": {"type": "nested", "properties": {"name": {"type": "keyword"}, "score": {"type": "float"}}},
+			"author": {"type": "object", "properties": {"name": {"type": "text", "fields": {"keyword": {"type": "keyword"}}}, "email": {"type": "keyword", "ignore_above": 256}}},
+			"labels": {"type": "object", "enabled": false},
+			"thumbnail": {"type": "binary"},
+			"client_ip": {"type": "ip"}
+		}}`), &expected)
+
+		if jsonString(actual) != jsonString(expected) {
+			t.Errorf("Unexpected mapping:\n%s\nwant:\n%s", jsonString(actual), jsonString(expected))
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		var tt = []struct {
+			value interface{}
+			err   string
+		}{
+			{"string", "expected a struct"},
+			{Node{}, "recursive type"},
+			{struct {
+				A string `es:",bogus"`
+			}{}, `invalid option "bogus"`},
+			{struct {
+				A string `es:",fields=raw"`
+			}{}, `invalid multi-field "raw"`},
+			{struct {
+				A string `es:",index=maybe"`
+			}{}, "invalid mapping"},
+		}
+
+		for _, tc := range tt {
+			if _, err := FromStruct(tc.value); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected error containing %q for %T, got: %v", tc.err, tc.value, err)
+			}
+		}
+	})
+}
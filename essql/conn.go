@@ -0,0 +1,282 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package essql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/sql/query"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	// ErrReadOnly is returned for the statements executed with Exec.
+	ErrReadOnly = errors.New("essql: the SQL API is read-only, use Query")
+
+	// ErrNoTransactions is returned when starting a transaction.
+	ErrNoTransactions = errors.New("essql: transactions are not supported")
+)
+
+var (
+	_ driver.Conn             = (*conn)(nil)
+	_ driver.QueryerContext   = (*conn)(nil)
+	_ driver.Pinger           = (*conn)(nil)
+	_ driver.StmtQueryContext = (*stmt)(nil)
+)
+
+// conn represents a connection to the cluster; the connections share the client.
+type conn struct {
+	client *elasticsearch.Client
+	cfg    Config
+}
+
+// Prepare returns a statement for the query; the query is sent to the cluster when executed.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+// Close closes the connection.
+func (c *conn) Close() error {
+	return nil
+}
+
+// Begin returns ErrNoTransactions.
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, ErrNoTransactions
+}
+
+// QueryContext runs the query with the positional parameters.
+func (c *conn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	params, err := queryParams(args)
+	if err != nil {
+		return nil, err
+	}
+
+	body := queryRequest{
+		Query:                   q,
+		Params:                  params,
+		FetchSize:               c.cfg.FetchSize,
+		TimeZone:                c.cfg.TimeZone,
+		Catalog:                 c.cfg.Catalog,
+		RequestTimeout:          formatDuration(c.cfg.RequestTimeout),
+		PageTimeout:             formatDuration(c.cfg.PageTimeout),
+		FieldMultiValueLeniency: c.cfg.FieldMultiValueLeniency,
+	}
+
+	res, err := runQuery(ctx, c.client, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRows(ctx, c, res), nil
+}
+
+// Ping checks the connection to the cluster.
+func (c *conn) Ping(ctx context.Context) error {
+	res, err := c.client.Ping(c.client.Ping.WithContext(ctx))
+	if err != nil {
+		return driver.ErrBadConn
+	}
+	res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("essql: ping: %s", res.Status())
+	}
+	return nil
+}
+
+// queryRequest represents the body of the SQL query requests.
+type queryRequest struct {
+	Query                    string       `json:"query,omitempty"`
+	Cursor                   string       `json:"cursor,omitempty"`
+	Params                   []queryParam `json:"params,omitempty"`
+	Filter                   *types.Query `json:"filter,omitempty"`
+	FetchSize                int          `json:"fetch_size,omitempty"`
+	TimeZone                 string       `json:"time_zone,omitempty"`
+	Catalog                  string       `json:"catalog,omitempty"`
+	RequestTimeout           string       `json:"request_timeout,omitempty"`
+	PageTimeout              string       `json:"page_timeout,omitempty"`
+	FieldMultiValueLeniency  bool         `json:"field_multi_value_leniency,omitempty"`
+	WaitForCompletionTimeout string       `json:"wait_for_completion_timeout,omitempty"`
+	KeepAlive                string       `json:"keep_alive,omitempty"`
+}
+
+// queryParam represents a typed parameter of a query.
+type queryParam struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// runQuery runs the SQL query request, and returns the decoded response.
+func runQuery(ctx context.Context, tp esapi.Transport, body queryRequest) (*query.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := esapi.SQLQueryRequest{Body: bytes.NewReader(data), Format: "json"}.Do(ctx, tp)
+	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(res)
+}
+
+// getAsync waits for the results of the async query.
+func getAsync(ctx context.Context, tp esapi.Transport, id string, wait time.Duration) (*query.Response, error) {
+	res, err := esapi.SQLGetAsyncRequest{DocumentID: id, Format: "json", WaitForCompletionTimeout: wait}.Do(ctx, tp)
+	if err != nil {
+		return nil, err
+	}
+	return decodeResponse(res)
+}
+
+// deleteAsync deletes the async query and its results.
+func deleteAsync(ctx context.Context, tp esapi.Transport, id string) error {
+	res, err := esapi.SQLDeleteAsyncRequest{DocumentID: id}.Do(ctx, tp)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != 404 {
+		return decodeError(res)
+	}
+	return nil
+}
+
+// clearCursor releases the resources of the cursor in the cluster.
+func clearCursor(ctx context.Context, tp esapi.Transport, cursor string) error {
+	data, _ := json.Marshal(map[string]string{"cursor": cursor})
+
+	res, err := esapi.SQLClearCursorRequest{Body: bytes.NewReader(data)}.Do(ctx, tp)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeError(res)
+	}
+	return nil
+}
+
+// decodeResponse decodes the SQL query response, or returns the error.
+func decodeResponse(res *esapi.Response) (*query.Response, error) {
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, decodeError(res)
+	}
+
+	response := query.NewResponse()
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("essql: cannot decode the response: %s", err)
+	}
+	return response, nil
+}
+
+// stmt represents a statement; the statements are not prepared in the cluster.
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+// Close closes the statement.
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1, the number of parameters is not checked by the driver.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+// Exec returns ErrReadOnly.
+func (s *stmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, ErrReadOnly
+}
+
+// Query runs the statement with the positional parameters.
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return s.conn.QueryContext(context.Background(), s.query, named)
+}
+
+// QueryContext runs the statement with the positional parameters.
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+// queryParams returns the typed parameters for the arguments.
+func queryParams(args []driver.NamedValue) ([]queryParam, error) {
+	params := make([]queryParam, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("essql: named parameters are not supported, use ? for %q", arg.Name)
+		}
+
+		var p queryParam
+		switch v := arg.Value.(type) {
+		case nil:
+			p = queryParam{Type: "null", Value: nil}
+		case bool:
+			p = queryParam{Type: "boolean", Value: v}
+		case int64:
+			p = queryParam{Type: "long", Value: v}
+		case float64:
+			p = queryParam{Type: "double", Value: v}
+		case string:
+			p = queryParam{Type: "keyword", Value: v}
+		case []byte:
+			p = queryParam{Type: "keyword", Value: string(v)}
+		case time.Time:
+			p = queryParam{Type: "datetime", Value: v.Format("2006-01-02T15:04:05.000Z07:00")}
+		default:
+			return nil, fmt.Errorf("essql: unsupported parameter type %T", v)
+		}
+		params[i] = p
+	}
+	return params, nil
+}
+
+// decodeError returns the error from the response.
+func decodeError(res *esapi.Response) error {
+	e := types.NewElasticsearchError()
+	if err := json.NewDecoder(res.Body).Decode(e); err != nil || e.ErrorCause.Type == "" {
+		return fmt.Errorf("essql: %s", res.Status())
+	}
+	return e
+}
+
+// formatDuration formats the duration in milliseconds, or returns an empty string.
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package essql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// DriverName is the name of the driver registered with database/sql.
+const DriverName = "elasticsearch"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+var (
+	_ driver.Driver        = (*Driver)(nil)
+	_ driver.DriverContext = (*Driver)(nil)
+	_ driver.Connector     = (*connector)(nil)
+)
+
+// Config represents the configuration of the driver.
+type Config struct {
+	Client elasticsearch.Config // Configuration of the client.
+
+	FetchSize               int           // Number of rows per page. Default: 1000.
+	TimeZone                string        // Time zone of the queries, eg. "Europe/Prague". Default: UTC.
+	Catalog                 string        // Cluster of the queries, for cross-cluster search. Default: the local cluster.
+	RequestTimeout          time.Duration // Timeout of the queries. Default: 90s.
+	PageTimeout             time.Duration // Timeout of the cursors between the pages. Default: 45s.
+	FieldMultiValueLeniency bool          // Return the first value of multi-valued fields instead of an error.
+}
+
+// Driver implements the database/sql/driver interfaces for the Elasticsearch SQL API.
+type Driver struct{}
+
+// Open returns a new connection to the cluster configured with the DSN.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector returns a connector for the cluster configured with the DSN.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnector(cfg)
+}
+
+// NewConnector returns a connector for the configuration, to be used with sql.OpenDB:
+//
+//	c, _ := essql.NewConnector(essql.Config{Client: elasticsearch.Config{CloudID: "..."}, FetchSize: 500})
+//	db := sql.OpenDB(c)
+func NewConnector(cfg Config) (driver.Connector, error) {
+	es, err := elasticsearch.NewClient(cfg.Client)
+	if err != nil {
+		return nil, err
+	}
+	return &connector{client: es, cfg: cfg}, nil
+}
+
+type connector struct {
+	client *elasticsearch.Client
+	cfg    Config
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{client: c.client, cfg: c.cfg}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// ParseDSN returns the configuration from the DSN, in the format:
+//
+//	scheme://[username[:password]@]host[:port][,host[:port]...][/][?option=value&...]
+//
+// The options are:
+//
+//	fetch_size                  Number of rows per page.
+//	time_zone                   Time zone of the queries.
+//	catalog                     Cluster of the queries.
+//	request_timeout             Timeout of the queries, eg. "30s".
+//	page_timeout                Timeout of the cursors, eg. "1m".
+//	field_multi_value_leniency  Return the first value of multi-valued fields, "true" or "false".
+//	api_key                     Base64-encoded API key.
+//	service_token               Service token.
+//	ca_cert                     Path to the PEM-encoded certificate authorities.
+//	cert_fingerprint            SHA256 hex fingerprint of the certificate.
+func ParseDSN(dsn string) (Config, error) {
+	var cfg Config
+
+	i := strings.Index(dsn, "://")
+	if i < 0 {
+		return cfg, fmt.Errorf("essql: invalid DSN %q: missing scheme", dsn)
+	}
+	scheme, rest := dsn[:i], dsn[i+3:]
+
+	var query string
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+	rest = strings.TrimSuffix(rest, "/")
+	if strings.Contains(rest, "/") {
+		return cfg, fmt.Errorf("essql: invalid DSN %q: unexpected path", dsn)
+	}
+
+	if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+		userinfo := rest[:i]
+		rest = rest[i+1:]
+
+		username, password := userinfo, ""
+		if i := strings.IndexByte(userinfo, ':'); i >= 0 {
+			username, password = userinfo[:i], userinfo[i+1:]
+		}
+		var err error
+		if cfg.Client.Username, err = url.PathUnescape(username); err != nil {
+			return cfg, fmt.Errorf("essql: invalid username: %s", err)
+		}
+		if cfg.Client.Password, err = url.PathUnescape(password); err != nil {
+			return cfg, fmt.Errorf("essql: invalid password: %s", err)
+		}
+	}
+
+	for _, host := range strings.Split(rest, ",") {
+		if host == "" {
+			return cfg, fmt.Errorf("essql: invalid DSN %q: missing host", dsn)
+		}
+		cfg.Client.Addresses = append(cfg.Client.Addresses, scheme+"://"+host)
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return cfg, fmt.Errorf("essql: invalid DSN options: %s", err)
+	}
+	for key := range values {
+		value := values.Get(key)
+		switch key {
+		case "fetch_size":
+			cfg.FetchSize, err = strconv.Atoi(value)
+		case "time_zone":
+			cfg.TimeZone = value
+		case "catalog":
+			cfg.Catalog = value
+		case "request_timeout":
+			cfg.RequestTimeout, err = time.ParseDuration(value)
+		case "page_timeout":
+			cfg.PageTimeout, err = time.ParseDuration(value)
+		case "field_multi_value_leniency":
+			cfg.FieldMultiValueLeniency, err = strconv.ParseBool(value)
+		case "api_key":
+			cfg.Client.APIKey = value
+		case "service_token":
+			cfg.Client.ServiceToken = value
+		case "ca_cert":
+			cfg.Client.CACert, err = ioutil.ReadFile(value)
+		case "cert_fingerprint":
+			cfg.Client.CertificateFingerprint = value
+		default:
+			return cfg, fmt.Errorf("essql: unknown DSN option %q", key)
+		}
+		if err != nil {
+			return cfg, fmt.Errorf("essql: invalid DSN option %q: %s", key, err)
+		}
+	}
+
+	return cfg, nil
+}
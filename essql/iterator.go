@@ -0,0 +1,318 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package essql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/sql/query"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var defaultWaitForCompletionTimeout = time.Second
+
+// Request represents an SQL query for the Iterator.
+type Request struct {
+	Query     string        // SQL query, with ? for the positional parameters.
+	Params    []interface{} // Values of the positional parameters.
+	Filter    *types.Query  // Optional Query DSL for additional filtering.
+	FetchSize int           // Number of rows per page. Default: 1000.
+	TimeZone  string        // Time zone of the query. Default: UTC.
+	Catalog   string        // Cluster of the query. Default: the local cluster.
+
+	RequestTimeout          time.Duration // Timeout of the query. Default: 90s.
+	PageTimeout             time.Duration // Timeout of the cursor between the pages. Default: 45s.
+	FieldMultiValueLeniency bool          // Return the first value of multi-valued fields instead of an error.
+
+	// Run the query asynchronously, and wait for the results with the get async API:
+	// each request waits for WaitForCompletionTimeout, until the query completes.
+	// The query is deleted when the iterator is closed.
+	Async                    bool
+	WaitForCompletionTimeout time.Duration // Default: 1s.
+	KeepAlive                time.Duration // Retention of the async query. Default: 5d.
+}
+
+// Iterator iterates over the rows of all the pages of an SQL query.
+//
+//	it := essql.NewIterator(es, essql.Request{Query: "SELECT name, age FROM people"})
+//	defer it.Close()
+//
+//	for it.Next(ctx) {
+//	  var p struct {
+//	    Name string `sql:"name"`
+//	    Age  int    `sql:"age"`
+//	  }
+//	  if err := it.Scan(&p); err != nil {
+//	    log.Fatal(err)
+//	  }
+//	}
+//	if err := it.Err(); err != nil {
+//	  log.Fatal(err)
+//	}
+type Iterator struct {
+	tp  esapi.Transport
+	req Request
+
+	started bool
+	columns []types.Column
+	rows    [][]json.RawMessage
+	pos     int
+	cursor  string
+	asyncID string
+	partial bool
+	err     error
+}
+
+// NewIterator returns an iterator for the query; the query runs on the first call to Next.
+func NewIterator(tp esapi.Transport, req Request) *Iterator {
+	return &Iterator{tp: tp, req: req}
+}
+
+// Next advances to the next row, fetching the next page when needed; it returns
+// false when there are no more rows, or on error.
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+
+	if !it.started {
+		it.started = true
+		if it.err = it.start(ctx); it.err != nil {
+			return false
+		}
+	} else {
+		it.pos++
+	}
+
+	for it.pos >= len(it.rows) {
+		if it.cursor == "" {
+			return false
+		}
+
+		res, err := runQuery(ctx, it.tp, queryRequest{Cursor: it.cursor})
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.setPage(res)
+	}
+
+	return true
+}
+
+// start runs the query, and waits for the results of an async query.
+func (it *Iterator) start(ctx context.Context) error {
+	params := make([]driver.NamedValue, len(it.req.Params))
+	for i, p := range it.req.Params {
+		v, err := driver.DefaultParameterConverter.ConvertValue(p)
+		if err != nil {
+			return fmt.Errorf("essql: invalid parameter %d: %s", i+1, err)
+		}
+		params[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	qp, err := queryParams(params)
+	if err != nil {
+		return err
+	}
+
+	body := queryRequest{
+		Query:                   it.req.Query,
+		Params:                  qp,
+		Filter:                  it.req.Filter,
+		FetchSize:               it.req.FetchSize,
+		TimeZone:                it.req.TimeZone,
+		Catalog:                 it.req.Catalog,
+		RequestTimeout:          formatDuration(it.req.RequestTimeout),
+		PageTimeout:             formatDuration(it.req.PageTimeout),
+		FieldMultiValueLeniency: it.req.FieldMultiValueLeniency,
+	}
+
+	wait := it.req.WaitForCompletionTimeout
+	if wait <= 0 {
+		wait = defaultWaitForCompletionTimeout
+	}
+	if it.req.Async {
+		body.WaitForCompletionTimeout = formatDuration(wait)
+		body.KeepAlive = formatDuration(it.req.KeepAlive)
+	}
+
+	res, err := runQuery(ctx, it.tp, body)
+	if err != nil {
+		return err
+	}
+	if res.Id != nil {
+		it.asyncID = *res.Id
+	}
+
+	for res.IsRunning != nil && *res.IsRunning {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if res, err = getAsync(ctx, it.tp, it.asyncID, wait); err != nil {
+			return err
+		}
+	}
+
+	it.columns = res.Columns
+	it.partial = res.IsPartial != nil && *res.IsPartial
+	it.setPage(res)
+
+	return nil
+}
+
+func (it *Iterator) setPage(res *query.Response) {
+	it.rows, it.pos, it.cursor = res.Rows, 0, ""
+	if res.Cursor != nil && len(res.Rows) > 0 {
+		it.cursor = *res.Cursor
+	}
+}
+
+// Columns returns the columns of the query, after the first call to Next.
+func (it *Iterator) Columns() []types.Column {
+	return it.columns
+}
+
+// Partial returns true when the results of the async query are partial, eg. because of a timeout.
+func (it *Iterator) Partial() bool {
+	return it.partial
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Values returns the values of the current row, converted like with the database/sql driver.
+func (it *Iterator) Values() ([]interface{}, error) {
+	row, err := it.row()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(row))
+	for i, raw := range row {
+		if values[i], err = convertValue(it.columns[i].Type, raw); err != nil {
+			return nil, fmt.Errorf("essql: cannot convert column %q: %s", it.columns[i].Name, err)
+		}
+	}
+	return values, nil
+}
+
+// Scan copies the values of the current row into the struct pointed to by dest,
+// or into a map, when dest is a *map[string]interface{}.
+//
+// The columns are matched with the struct fields by the name in the "sql" tag,
+// or by the name of the field, case-insensitively; use `sql:"-"` to skip a field.
+// The values are decoded like JSON into the fields, the date and datetime values are
+// parsed into time.Time, and the fields implementing sql.Scanner are supported.
+func (it *Iterator) Scan(dest interface{}) error {
+	row, err := it.row()
+	if err != nil {
+		return err
+	}
+
+	if m, ok := dest.(*map[string]interface{}); ok {
+		values, err := it.Values()
+		if err != nil {
+			return err
+		}
+		if *m == nil {
+			*m = make(map[string]interface{}, len(values))
+		}
+		for i, v := range values {
+			(*m)[it.columns[i].Name] = v
+		}
+		return nil
+	}
+
+	return scanStruct(dest, it.columns, row)
+}
+
+func (it *Iterator) row() ([]json.RawMessage, error) {
+	if !it.started || it.pos >= len(it.rows) {
+		return nil, errors.New("essql: no current row, call Next")
+	}
+	row := it.rows[it.pos]
+	if len(row) != len(it.columns) {
+		return nil, fmt.Errorf("essql: unexpected number of values: %d, columns: %d", len(row), len(it.columns))
+	}
+	return row, nil
+}
+
+// Close clears the cursor, when the rows weren't consumed, and deletes the async query.
+func (it *Iterator) Close() error {
+	var err error
+
+	// The iteration context may be cancelled already; release the resources regardless.
+	if it.cursor != "" {
+		err = clearCursor(context.Background(), it.tp, it.cursor)
+		it.cursor = ""
+	}
+	if it.asyncID != "" {
+		if e := deleteAsync(context.Background(), it.tp, it.asyncID); e != nil && err == nil {
+			err = e
+		}
+		it.asyncID = ""
+	}
+
+	it.rows = nil
+	return err
+}
+
+// ScanAll runs the query and scans all the rows into the slice pointed to by dest,
+// whose elements are structs or pointers to structs; see Iterator.Scan.
+func ScanAll(ctx context.Context, tp esapi.Transport, req Request, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("essql: expected a pointer to a slice, got %T", dest)
+	}
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+
+	it := NewIterator(tp, req)
+	defer it.Close()
+
+	for it.Next(ctx) {
+		var elem reflect.Value
+		if elemType.Kind() == reflect.Ptr {
+			elem = reflect.New(elemType.Elem())
+			if err := it.Scan(elem.Interface()); err != nil {
+				return err
+			}
+		} else {
+			elem = reflect.New(elemType)
+			if err := it.Scan(elem.Interface()); err != nil {
+				return err
+			}
+			elem = elem.Elem()
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return it.Close()
+}
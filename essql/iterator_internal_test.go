@@ -0,0 +1,169 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package essql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/estest"
+)
+
+type person struct {
+	Name     string
+	Age      int            `sql:"age"`
+	Email    sql.NullString `sql:"contact.email"`
+	Born     *time.Time     `sql:"born"`
+	Tags     []string       `sql:"tags"`
+	Internal string         `sql:"-"`
+}
+
+func TestIterator(t *testing.T) {
+	ctx := context.Background()
+
+	newClient := func(t *testing.T, mock *estest.MockTransport) *elasticsearch.Client {
+		es, err := elasticsearch.NewClient(elasticsearch.Config{Transport: mock})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return es
+	}
+
+	columns := `[{"name": "NAME", "type": "keyword"}, {"name": "age", "type": "integer"}, {"name": "contact.email", "type": "keyword"},
+	  {"name": "born", "type": "datetime"}, {"name": "tags", "type": "keyword"}, {"name": "Internal", "type": "keyword"}]`
+
+	t.Run("Scan", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_sql").
+			WithBody(`{"query":"SELECT * FROM people WHERE age > ?","params":[{"type":"long","value":30}],"fetch_size":1}`).
+			Respond(200, `{"columns": `+columns+`, "rows": [["Alice", 42, "alice@example.com", "1980-01-02T03:04:05.000Z", ["a", "b"], "x"]], "cursor": "c1"}`)
+		mock.Expect("POST", "/_sql").
+			WithBody(`{"cursor":"c1"}`).
+			Respond(200, `{"rows": [["Bob", 35, null, null, null, "y"]]}`)
+
+		it := NewIterator(newClient(t, mock), Request{Query: "SELECT * FROM people WHERE age > ?", Params: []interface{}{30}, FetchSize: 1})
+		defer it.Close()
+
+		var people []person
+		for it.Next(ctx) {
+			var p person
+			if err := it.Scan(&p); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			people = append(people, p)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if len(people) != 2 {
+			t.Fatalf("Unexpected number of rows: %d", len(people))
+		}
+		alice, bob := people[0], people[1]
+		if alice.Name != "Alice" || alice.Age != 42 || alice.Email.String != "alice@example.com" || alice.Internal != "" {
+			t.Errorf("Unexpected values: %+v", alice)
+		}
+		if alice.Born == nil || !alice.Born.Equal(time.Date(1980, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Errorf("Unexpected time: %v", alice.Born)
+		}
+		if !reflect.DeepEqual(alice.Tags, []string{"a", "b"}) {
+			t.Errorf("Unexpected tags: %v", alice.Tags)
+		}
+		if bob.Name != "Bob" || bob.Email.Valid || bob.Born != nil || bob.Tags != nil {
+			t.Errorf("Unexpected values: %+v", bob)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Scan into map", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_sql").Respond(200, `{"columns": [{"name": "name", "type": "keyword"}, {"name": "age", "type": "long"}], "rows": [["Alice", 42]], "cursor": "c1"}`)
+		mock.Expect("POST", "/_sql/close").WithBody(`{"cursor":"c1"}`)
+
+		it := NewIterator(newClient(t, mock), Request{Query: "SELECT name, age FROM people"})
+		if !it.Next(ctx) {
+			t.Fatalf("Unexpected error: %v", it.Err())
+		}
+		var m map[string]interface{}
+		if err := it.Scan(&m); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if m["name"] != "Alice" || m["age"] != int64(42) {
+			t.Errorf("Unexpected values: %v", m)
+		}
+
+		if err := it.Close(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Async", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_sql").
+			WithBody(`{"query":"SELECT * FROM people","wait_for_completion_timeout":"10ms","keep_alive":"60000ms"}`).
+			Respond(200, `{"id": "a1", "is_running": true, "is_partial": true, "rows": []}`)
+		mock.Expect("GET", "/_sql/async/a1").
+			WithQuery("wait_for_completion_timeout", "10ms").
+			Respond(200, `{"id": "a1", "is_running": true, "is_partial": true, "rows": []}`)
+		mock.Expect("GET", "/_sql/async/a1").
+			Respond(200, `{"id": "a1", "is_running": false, "is_partial": false, "columns": `+columns+`, "rows": [["Alice", 42, null, null, null, null]]}`)
+		mock.Expect("DELETE", "/_sql/async/delete/a1").Respond(200, `{"acknowledged": true}`)
+
+		var people []*person
+		err := ScanAll(ctx, newClient(t, mock), Request{
+			Query:                    "SELECT * FROM people",
+			Async:                    true,
+			WaitForCompletionTimeout: 10 * time.Millisecond,
+			KeepAlive:                time.Minute,
+		}, &people)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if len(people) != 1 || people[0].Name != "Alice" {
+			t.Errorf("Unexpected rows: %+v", people)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_sql").RespondError(400, "parsing_exception", "line 1:1: mismatched input")
+
+		it := NewIterator(newClient(t, mock), Request{Query: "SELEC"})
+		if it.Next(ctx) || it.Err() == nil {
+			t.Errorf("Expected error, got: %v", it.Err())
+		}
+		if err := it.Scan(&person{}); err == nil {
+			t.Errorf("Expected error without current row")
+		}
+
+		var people []person
+		if err := ScanAll(ctx, newClient(t, mock), Request{}, people); err == nil {
+			t.Errorf("Expected error for non-pointer destination")
+		}
+	})
+}
@@ -0,0 +1,191 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package essql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/sql/query"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	_ driver.Rows                           = (*rows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*rows)(nil)
+)
+
+// rows represents the result of a query, fetched page by page with the cursor.
+type rows struct {
+	ctx  context.Context
+	conn *conn
+
+	columns []types.Column
+	values  [][]json.RawMessage
+	pos     int
+	cursor  string
+}
+
+func newRows(ctx context.Context, c *conn, res *query.Response) *rows {
+	r := rows{ctx: ctx, conn: c, columns: res.Columns, values: res.Rows}
+	if res.Cursor != nil {
+		r.cursor = *res.Cursor
+	}
+	return &r
+}
+
+// Columns returns the names of the columns.
+func (r *rows) Columns() []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Next fetches the next row, and the next page when the current one is consumed.
+func (r *rows) Next(dest []driver.Value) error {
+	for r.pos >= len(r.values) {
+		if r.cursor == "" {
+			return io.EOF
+		}
+
+		res, err := runQuery(r.ctx, r.conn.client, queryRequest{Cursor: r.cursor})
+		if err != nil {
+			return err
+		}
+
+		r.values, r.pos, r.cursor = res.Rows, 0, ""
+		if res.Cursor != nil {
+			r.cursor = *res.Cursor
+		}
+		if len(r.values) == 0 {
+			r.cursor = ""
+		}
+	}
+
+	row := r.values[r.pos]
+	r.pos++
+
+	if len(row) != len(r.columns) {
+		return fmt.Errorf("essql: unexpected number of values: %d, columns: %d", len(row), len(r.columns))
+	}
+	for i, raw := range row {
+		v, err := convertValue(r.columns[i].Type, raw)
+		if err != nil {
+			return fmt.Errorf("essql: cannot convert column %q: %s", r.columns[i].Name, err)
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+// Close clears the cursor, when the rows weren't consumed.
+func (r *rows) Close() error {
+	if r.cursor == "" {
+		return nil
+	}
+	cursor := r.cursor
+	r.cursor, r.values = "", nil
+
+	// The query context may be cancelled already; clear the cursor regardless.
+	return clearCursor(context.Background(), r.conn.client, cursor)
+}
+
+// ColumnTypeDatabaseTypeName returns the SQL type of the column, eg. "KEYWORD".
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(r.columns[index].Type)
+}
+
+// ColumnTypeScanType returns the Go type of the column values.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	switch r.columns[index].Type {
+	case "boolean":
+		return reflect.TypeOf(false)
+	case "byte", "short", "integer", "long":
+		return reflect.TypeOf(int64(0))
+	case "double", "float", "half_float", "scaled_float":
+		return reflect.TypeOf(float64(0))
+	case "date", "datetime":
+		return reflect.TypeOf(time.Time{})
+	default:
+		return reflect.TypeOf("")
+	}
+}
+
+// ColumnTypeNullable returns true, the values of all the columns can be null.
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return true, true
+}
+
+// convertValue converts the JSON value according to the SQL type.
+func convertValue(typ string, raw json.RawMessage) (driver.Value, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	switch typ {
+	case "boolean":
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		return v, err
+
+	case "byte", "short", "integer", "long":
+		return strconv.ParseInt(string(raw), 10, 64)
+
+	case "unsigned_long":
+		if v, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+			return v, nil
+		}
+		// Values out of the int64 range are returned as strings.
+		return string(raw), nil
+
+	case "double", "float", "half_float", "scaled_float":
+		var v float64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+
+	case "date", "datetime":
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+		return time.Parse("2006-01-02", s)
+
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s, nil
+		}
+		// Arrays, objects and the other values are returned as JSON.
+		return string(raw), nil
+	}
+}
@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package essql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+
+	structFieldsCache sync.Map // map[reflect.Type]map[string][]int
+)
+
+// scanStruct copies the row values into the fields of the struct pointed to by dest.
+func scanStruct(dest interface{}, columns []types.Column, row []json.RawMessage) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("essql: expected a pointer to a struct, got %T", dest)
+	}
+	v = v.Elem()
+	fields := structFields(v.Type())
+
+	for i, column := range columns {
+		index, ok := fields[column.Name]
+		if !ok {
+			index, ok = fields[strings.ToLower(column.Name)]
+		}
+		if !ok {
+			continue
+		}
+
+		if err := scanValue(v.FieldByIndex(index), column.Type, row[i]); err != nil {
+			return fmt.Errorf("essql: cannot scan column %q: %s", column.Name, err)
+		}
+	}
+	return nil
+}
+
+// scanValue copies the raw value of the SQL type into the field.
+func scanValue(field reflect.Value, typ string, raw json.RawMessage) error {
+	v, err := convertValue(typ, raw)
+	if err != nil {
+		return err
+	}
+
+	if field.Addr().Type().Implements(scannerType) {
+		return field.Addr().Interface().(sql.Scanner).Scan(v)
+	}
+	if v == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	if t, ok := v.(time.Time); ok {
+		switch {
+		case field.Type() == timeType:
+			field.Set(reflect.ValueOf(t))
+			return nil
+		case field.Kind() == reflect.Ptr && field.Type().Elem() == timeType:
+			field.Set(reflect.ValueOf(&t))
+			return nil
+		}
+	}
+
+	return json.Unmarshal(raw, field.Addr().Interface())
+}
+
+// structFields returns the index of the fields by column name, and by lowercase field name.
+func structFields(t reflect.Type) map[string][]int {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	collectFields(t, nil, fields)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, fields map[string][]int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("sql")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			collectFields(f.Type, fieldIndex, fields)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if tag != "" {
+			fields[tag] = fieldIndex
+		} else if _, ok := fields[strings.ToLower(f.Name)]; !ok {
+			fields[strings.ToLower(f.Name)] = fieldIndex
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+/*
+Package estest provides utilities for testing code using the Go client for Elasticsearch.
+
+The Recorder records the requests and responses to a cassette file, and replays them
+in the tests, without a running cluster:
+
+	rec, err := estest.NewRecorder(estest.RecorderConfig{
+	  Cassette: "testdata/search.json",
+	  Mode:     estest.ModeReplayOrRecord,
+	})
+	if err != nil {
+	  log.Fatalf("Error creating the recorder: %s", err)
+	}
+	defer rec.Close()
+
+	es, _ := elasticsearch.NewClient(elasticsearch.Config{Transport: rec})
+
+The Server implements a subset of the REST API in memory, to exercise the clients
+and the helpers end-to-end:
+
+	srv := estest.NewServer()
+	defer srv.Close()
+
+	es, _ := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+
+The MockTransport responds to the requests according to the expectations declared
+in the test, to exercise the error handling, timeouts and partial failures:
+
+	mock := estest.NewMockTransport()
+	mock.Expect("POST", "/my-index/_doc").WithBody(`{"title":"Test"}`).Respond(201, index.Response{Id_: "1"})
+	mock.Expect("POST", "/_bulk").RespondBulk(estest.BulkFailure{Item: 1})
+
+	es, _ := elasticsearch.NewClient(elasticsearch.Config{Transport: mock})
+	// ...
+	mock.AssertExpectations(t)
+*/
+package estest
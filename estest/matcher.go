@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package estest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// Matcher returns true when the actual request matches the recorded request.
+type Matcher func(actual, recorded Request) bool
+
+// DefaultMatchers match the requests on the method, the path, the query and the JSON body.
+var DefaultMatchers = []Matcher{MatchMethod, MatchPath, MatchQuery, MatchJSONBody}
+
+// MatchMethod matches the requests with the same HTTP method.
+func MatchMethod(actual, recorded Request) bool {
+	return actual.Method == recorded.Method
+}
+
+// MatchPath matches the requests with the same URL path.
+func MatchPath(actual, recorded Request) bool {
+	return actual.Path == recorded.Path
+}
+
+// MatchQuery matches the requests with the same query parameters, in any order.
+func MatchQuery(actual, recorded Request) bool {
+	a, b := actual.Query, recorded.Query
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok {
+			return false
+		}
+		v, w = append([]string(nil), v...), append([]string(nil), w...)
+		sort.Strings(v)
+		sort.Strings(w)
+		if !reflect.DeepEqual(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchBody matches the requests with the same body.
+func MatchBody(actual, recorded Request) bool {
+	return bytes.Equal(actual.Body, recorded.Body)
+}
+
+// MatchJSONBody matches the requests with the same body, after normalizing the JSON
+// documents, so the order of the keys and the whitespace are ignored.
+//
+// The bodies with newline-delimited JSON, such as the bulk requests, are compared line by line.
+// The bodies which are not valid JSON are compared as is.
+func MatchJSONBody(actual, recorded Request) bool {
+	if bytes.Equal(actual.Body, recorded.Body) {
+		return true
+	}
+
+	a, ok := normalizeJSON(actual.Body)
+	if !ok {
+		return false
+	}
+	b, ok := normalizeJSON(recorded.Body)
+	if !ok {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// normalizeJSON decodes the JSON documents from body.
+func normalizeJSON(body []byte) ([]interface{}, bool) {
+	var docs []interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	for dec.More() {
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil, false
+		}
+		docs = append(docs, doc)
+	}
+
+	// Ensure there's no trailing garbage
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	return docs, true
+}
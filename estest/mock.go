@@ -0,0 +1,444 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package estest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	_ esapi.Transport            = (*MockTransport)(nil)
+	_ elastictransport.Interface = (*MockTransport)(nil)
+	_ http.RoundTripper          = (*MockTransport)(nil)
+)
+
+// TestingT is the subset of testing.TB used by the mock transport.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// MockTransport represents a transport responding to the requests according to the expectations.
+//
+// It implements esapi.Transport and elastictransport.Interface, to be used with esapi
+// requests and typedapi.New, and http.RoundTripper, to be used as the Transport in the
+// client configuration:
+//
+//	mock := estest.NewMockTransport()
+//	mock.Expect("POST", "/my-index/_doc").
+//	  WithBody(`{"title":"Test"}`).
+//	  Respond(201, index.Response{Id_: "1", Result: result.Created})
+//
+//	es, _ := elasticsearch.NewClient(elasticsearch.Config{Transport: mock})
+//	// ...
+//	mock.AssertExpectations(t)
+//
+// The expectations are matched in the order of declaration. Requests without
+// a matching expectation fail with an error, and they are reported by AssertExpectations.
+type MockTransport struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	requests     []Request
+	unexpected   []Request
+}
+
+// NewMockTransport returns a new mock transport without expectations.
+func NewMockTransport() *MockTransport {
+	return &MockTransport{}
+}
+
+// Expectation represents an expected request, and the response to return.
+type Expectation struct {
+	method   string
+	path     string
+	matchers []func(Request) bool
+	criteria []string
+
+	times int // Expected number of calls, or -1 for any number
+	calls int
+
+	respond func(*http.Request, Request) (*http.Response, error)
+	delay   time.Duration
+}
+
+// Expect adds an expectation for a request with the method and the URL path, eg. "/my-index/_search".
+//
+// The expectation responds with 200 and an empty JSON object, unless configured otherwise.
+func (m *MockTransport) Expect(method, path string) *Expectation {
+	e := &Expectation{
+		method: method,
+		path:   path,
+		times:  1,
+	}
+	e.Respond(http.StatusOK, nil)
+
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+
+	return e
+}
+
+// WithQuery expects the query parameter to have the value.
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.criteria = append(e.criteria, fmt.Sprintf("query %s=%s", key, value))
+	e.matchers = append(e.matchers, func(r Request) bool { return r.Query.Get(key) == value })
+	return e
+}
+
+// WithHeader expects the header to have the value.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.criteria = append(e.criteria, fmt.Sprintf("header %s: %s", key, value))
+	e.matchers = append(e.matchers, func(r Request) bool { return r.Header.Get(key) == value })
+	return e
+}
+
+// WithBody expects the body to match, after normalizing the JSON documents; see MatchJSONBody.
+//
+// The body can be a string, a byte slice, or a value encoded to JSON, eg. a typedapi request.
+func (e *Expectation) WithBody(body interface{}) *Expectation {
+	expected := encodeBody(body)
+	e.criteria = append(e.criteria, fmt.Sprintf("body %s", expected))
+	e.matchers = append(e.matchers, func(r Request) bool { return MatchJSONBody(r, Request{Body: expected}) })
+	return e
+}
+
+// WithBodyMatching expects the body to satisfy the function.
+func (e *Expectation) WithBodyMatching(fn func(body []byte) bool) *Expectation {
+	e.criteria = append(e.criteria, "body matching function")
+	e.matchers = append(e.matchers, func(r Request) bool { return fn(r.Body) })
+	return e
+}
+
+// Times sets the expected number of calls. Default: 1.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes allows any number of calls, including none.
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+// Delay delays the response, eg. to test timeouts. The delay is interrupted when the request context is done.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// Respond sets the response status and body; see NewResponse.
+func (e *Expectation) Respond(status int, body interface{}) *Expectation {
+	data := encodeBody(body)
+	e.respond = func(*http.Request, Request) (*http.Response, error) {
+		return newResponse(status, data), nil
+	}
+	return e
+}
+
+// RespondError sets an error response with the Elasticsearch error format; see NewErrorResponse.
+func (e *Expectation) RespondError(status int, errorType, reason string) *Expectation {
+	e.respond = func(*http.Request, Request) (*http.Response, error) {
+		return NewErrorResponse(status, errorType, reason), nil
+	}
+	return e
+}
+
+// RespondWith sets the function returning the response, eg. for a response depending on the request.
+func (e *Expectation) RespondWith(fn func(*http.Request) (*http.Response, error)) *Expectation {
+	e.respond = func(req *http.Request, _ Request) (*http.Response, error) {
+		return fn(req)
+	}
+	return e
+}
+
+// ReturnError makes the transport return the error, eg. to simulate a network failure.
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.respond = func(*http.Request, Request) (*http.Response, error) {
+		return nil, err
+	}
+	return e
+}
+
+// BulkFailure represents a failed item of a bulk response.
+type BulkFailure struct {
+	Item   int    // Position of the item in the bulk request, starting with 0.
+	Status int    // Status of the item. Default: 429.
+	Type   string // Type of the error. Default: es_rejected_execution_exception.
+	Reason string // Reason of the error.
+}
+
+// RespondBulk sets a bulk response for the items of the bulk request, where
+// the items listed in failures fail, and the other items succeed.
+func (e *Expectation) RespondBulk(failures ...BulkFailure) *Expectation {
+	e.respond = func(_ *http.Request, r Request) (*http.Response, error) {
+		body, err := bulkResponse(r, failures)
+		if err != nil {
+			return nil, err
+		}
+		return newResponse(http.StatusOK, body), nil
+	}
+	return e
+}
+
+func (e *Expectation) String() string {
+	s := e.method + " " + e.path
+	if len(e.criteria) > 0 {
+		s += " (" + strings.Join(e.criteria, ", ") + ")"
+	}
+	return s
+}
+
+func (e *Expectation) matches(r Request) bool {
+	if r.Method != e.method || r.Path != e.path {
+		return false
+	}
+	for _, m := range e.matchers {
+		if !m(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Perform executes the request, see RoundTrip.
+func (m *MockTransport) Perform(req *http.Request) (*http.Response, error) {
+	return m.RoundTrip(req)
+}
+
+// RoundTrip returns the response of the first expectation matching the request.
+func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	r := Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	}
+
+	m.mu.Lock()
+	m.requests = append(m.requests, r)
+	var matched *Expectation
+	for _, e := range m.expectations {
+		if (e.times < 0 || e.calls < e.times) && e.matches(r) {
+			e.calls++
+			matched = e
+			break
+		}
+	}
+	if matched == nil {
+		m.unexpected = append(m.unexpected, r)
+	}
+	m.mu.Unlock()
+
+	if matched == nil {
+		return nil, fmt.Errorf("unexpected request: %s %s", req.Method, req.URL.RequestURI())
+	}
+
+	if matched.delay > 0 {
+		timer := time.NewTimer(matched.delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	res, err := matched.respond(req, r)
+	if res != nil {
+		res.Request = req
+	}
+	return res, err
+}
+
+// Requests returns the requests received by the transport.
+func (m *MockTransport) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Request(nil), m.requests...)
+}
+
+// AssertExpectations reports the unmet expectations and the unexpected requests as test errors.
+// It returns true when all the expectations are met.
+func (m *MockTransport) AssertExpectations(t TestingT) bool {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ok := true
+	for _, e := range m.expectations {
+		if e.times >= 0 && e.calls != e.times {
+			t.Errorf("Expected %d calls for %s, got %d", e.times, e, e.calls)
+			ok = false
+		}
+	}
+	for _, r := range m.unexpected {
+		t.Errorf("Unexpected request: %s %s", r.Method, r.Path)
+		ok = false
+	}
+	return ok
+}
+
+// NewResponse returns a response with the status and the body, and the headers of an Elasticsearch response.
+//
+// The body can be nil, a string, a byte slice, an io.Reader, or a value encoded to JSON,
+// eg. a typedapi response:
+//
+//	estest.NewResponse(200, search.Response{Hits: types.HitsMetadata{Hits: []types.Hit{...}}})
+func NewResponse(status int, body interface{}) *http.Response {
+	return newResponse(status, encodeBody(body))
+}
+
+// NewErrorResponse returns a response with the status and an Elasticsearch error.
+func NewErrorResponse(status int, errorType, reason string) *http.Response {
+	cause := types.ErrorCause{Type: errorType, Reason: &reason}
+	cause.RootCause = []types.ErrorCause{{Type: errorType, Reason: &reason}}
+	return NewResponse(status, types.ElasticsearchError{ErrorCause: cause, Status: status})
+}
+
+func newResponse(status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"X-Elastic-Product": []string{"Elasticsearch"},
+			"Content-Type":      []string{"application/json"},
+		},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+// encodeBody returns the body as bytes, encoding the values to JSON.
+func encodeBody(body interface{}) []byte {
+	switch b := body.(type) {
+	case nil:
+		return []byte("{}")
+	case string:
+		return []byte(b)
+	case []byte:
+		return b
+	case io.Reader:
+		data, _ := ioutil.ReadAll(b)
+		return data
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			panic(fmt.Sprintf("estest: cannot encode body: %s", err))
+		}
+		return data
+	}
+}
+
+// bulkResponse returns the response for the items of the bulk request.
+func bulkResponse(r Request, failures []BulkFailure) ([]byte, error) {
+	failed := make(map[int]BulkFailure, len(failures))
+	for _, f := range failures {
+		if f.Status == 0 {
+			f.Status = http.StatusTooManyRequests
+		}
+		if f.Type == "" {
+			f.Type = "es_rejected_execution_exception"
+		}
+		if f.Reason == "" {
+			f.Reason = "rejected execution"
+		}
+		failed[f.Item] = f
+	}
+
+	var items []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(r.Body))
+	scanner.Buffer(make([]byte, 64*1024), len(r.Body)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return nil, fmt.Errorf("cannot parse bulk action %q", line)
+		}
+
+		for typ, meta := range action {
+			if typ != "delete" {
+				scanner.Scan() // Skip the document
+			}
+			if meta.Index == "" {
+				meta.Index = strings.TrimSuffix(strings.TrimPrefix(r.Path, "/"), "/_bulk")
+			}
+			if meta.ID == "" {
+				meta.ID = fmt.Sprintf("%d", len(items)+1)
+			}
+
+			item := map[string]interface{}{
+				"_index":        meta.Index,
+				"_id":           meta.ID,
+				"_version":      1,
+				"_seq_no":       len(items),
+				"_primary_term": 1,
+				"_shards":       map[string]int{"total": 2, "successful": 1, "failed": 0},
+			}
+			switch typ {
+			case "create", "index":
+				item["result"], item["status"] = "created", http.StatusCreated
+			case "update":
+				item["result"], item["status"] = "updated", http.StatusOK
+			case "delete":
+				item["result"], item["status"] = "deleted", http.StatusOK
+			}
+			if f, ok := failed[len(items)]; ok {
+				item = map[string]interface{}{
+					"_index": meta.Index,
+					"_id":    meta.ID,
+					"status": f.Status,
+					"error":  map[string]string{"type": f.Type, "reason": f.Reason},
+				}
+			}
+			items = append(items, map[string]interface{}{typ: item})
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{"took": 1, "errors": len(failed) > 0, "items": items})
+}
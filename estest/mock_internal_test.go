@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package estest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/index"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/result"
+)
+
+type mockT struct {
+	errors []string
+}
+
+func (t *mockT) Helper() {}
+
+func (t *mockT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMockTransport(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Expectations", func(t *testing.T) {
+		mock := NewMockTransport()
+		mock.Expect("POST", "/my-index/_doc").
+			WithQuery("refresh", "true").
+			WithBody(`{"title" : "Test"}`).
+			Respond(201, index.Response{Id_: "1", Index_: "my-index", Result: result.Created})
+		mock.Expect("GET", "/my-index/_doc/1").RespondError(404, "index_not_found_exception", "no such index [my-index]")
+
+		es, err := elasticsearch.NewTypedClient(elasticsearch.Config{Transport: mock, DisableRetry: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		res, err := es.Index("my-index").Refresh(refresh.True).Request(map[string]string{"title": "Test"}).Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Id_ != "1" || res.Result != result.Created {
+			t.Errorf("Unexpected response: %+v", res)
+		}
+
+		_, err = es.Get("my-index", "1").Do(ctx)
+		var esErr *types.ElasticsearchError
+		if !errors.As(err, &esErr) || esErr.Status != 404 || esErr.ErrorCause.Type != "index_not_found_exception" {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+
+		_, err = es.Get("my-index", "1").Do(ctx)
+		if err == nil || !strings.Contains(err.Error(), "unexpected request: GET /my-index/_doc/1") {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		var mt mockT
+		if mock.AssertExpectations(&mt) {
+			t.Errorf("Expected the unexpected request to be reported")
+		}
+		if len(mt.errors) != 1 || !strings.Contains(mt.errors[0], "Unexpected request: GET /my-index/_doc/1") {
+			t.Errorf("Unexpected errors: %q", mt.errors)
+		}
+		if len(mock.Requests()) != 3 {
+			t.Errorf("Unexpected number of requests: %d", len(mock.Requests()))
+		}
+	})
+
+	t.Run("Unmet expectations", func(t *testing.T) {
+		mock := NewMockTransport()
+		mock.Expect("GET", "/").Times(2)
+		mock.Expect("GET", "/_cluster/health").AnyTimes()
+		mock.Expect("DELETE", "/my-index")
+
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{Transport: mock})
+		for i := 0; i < 2; i++ {
+			res, err := es.Info()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+		}
+
+		var mt mockT
+		mock.AssertExpectations(&mt)
+		if len(mt.errors) != 1 || mt.errors[0] != "Expected 1 calls for DELETE /my-index, got 0" {
+			t.Errorf("Unexpected errors: %q", mt.errors)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		mock := NewMockTransport()
+		mock.Expect("GET", "/").ReturnError(errors.New("connection refused"))
+
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{Transport: mock, DisableRetry: true})
+		_, err := es.Info()
+		if err == nil || !strings.Contains(err.Error(), "connection refused") {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		mock := NewMockTransport()
+		mock.Expect("POST", "/_search").Delay(time.Second)
+
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{Transport: mock, DisableRetry: true})
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := es.Search(es.Search.WithContext(ctx))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Errorf("Expected the delay to be interrupted, took %s", time.Since(start))
+		}
+	})
+
+	t.Run("Bulk", func(t *testing.T) {
+		mock := NewMockTransport()
+		mock.Expect("POST", "/my-index/_bulk").RespondBulk(BulkFailure{Item: 1, Status: 400, Type: "mapper_parsing_exception", Reason: "failed to parse"})
+
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{Transport: mock})
+		bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{Client: es, Index: "my-index"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		var failed []string
+		for i := 1; i <= 3; i++ {
+			err := bi.Add(ctx, esutil.BulkIndexerItem{
+				Action:     "index",
+				DocumentID: fmt.Sprintf("%d", i),
+				Body:       strings.NewReader(`{"title":"Test"}`),
+				OnFailure: func(_ context.Context, item esutil.BulkIndexerItem, res esutil.BulkIndexerResponseItem, err error) {
+					failed = append(failed, item.DocumentID+": "+res.Error.Type)
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+		}
+		if err := bi.Close(ctx); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		stats := bi.Stats()
+		if stats.NumIndexed != 2 || stats.NumFailed != 1 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+		if len(failed) != 1 || failed[0] != "2: mapper_parsing_exception" {
+			t.Errorf("Unexpected failures: %q", failed)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Response", func(t *testing.T) {
+		res := NewResponse(200, `{"acknowledged":true}`)
+		body, _ := ioutil.ReadAll(res.Body)
+		if res.StatusCode != 200 || string(body) != `{"acknowledged":true}` {
+			t.Errorf("Unexpected response: %d %s", res.StatusCode, body)
+		}
+		if res.Header.Get("X-Elastic-Product") != "Elasticsearch" {
+			t.Errorf("Unexpected headers: %v", res.Header)
+		}
+	})
+}
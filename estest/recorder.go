@@ -0,0 +1,455 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package estest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode defines whether the recorder records or replays the interactions.
+type Mode int
+
+// The recorder modes.
+const (
+	ModeReplay         Mode = iota // Replay the interactions from the cassette, fail for unmatched requests.
+	ModeRecord                     // Record all the interactions, replacing the cassette.
+	ModeReplayOrRecord             // Replay the matching interactions, and record the other ones.
+	ModePassthrough                // Execute the requests, without recording them.
+)
+
+// String returns the mode as a string.
+func (m Mode) String() string {
+	switch m {
+	case ModeReplay:
+		return "replay"
+	case ModeRecord:
+		return "record"
+	case ModeReplayOrRecord:
+		return "replay_or_record"
+	case ModePassthrough:
+		return "passthrough"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// ParseMode returns the mode for s, eg. from an environment variable.
+func ParseMode(s string) (Mode, error) {
+	for _, m := range []Mode{ModeReplay, ModeRecord, ModeReplayOrRecord, ModePassthrough} {
+		if strings.EqualFold(s, m.String()) {
+			return m, nil
+		}
+	}
+	return ModeReplay, fmt.Errorf("unknown mode: %q", s)
+}
+
+// Redacted replaces the values of the redacted headers.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedHeaders are the headers redacted in the cassettes.
+var DefaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// Cassette represents the recorded interactions.
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction represents a recorded request and response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request represents a recorded request.
+type Request struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  url.Values  `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"-"` // See recordedBody for the encoding in the cassette.
+}
+
+// Response represents a recorded response.
+type Response struct {
+	StatusCode int           `json:"status_code"`
+	Header     http.Header   `json:"header,omitempty"`
+	Body       []byte        `json:"-"` // See recordedBody for the encoding in the cassette.
+	Duration   time.Duration `json:"duration,omitempty"`
+}
+
+// recordedBody represents a body in the cassette: the body is saved as a JSON value
+// when it's a compact JSON document, to keep the cassette readable, and encoded with
+// base64 otherwise, eg. for the compressed or newline-delimited bodies, so that it's
+// replayed unchanged.
+type recordedBody struct {
+	Body       json.RawMessage `json:"body,omitempty"`
+	BodyBase64 []byte          `json:"body_base64,omitempty"`
+}
+
+func newRecordedBody(body []byte) recordedBody {
+	var b bytes.Buffer
+	if len(body) > 0 && json.Compact(&b, body) == nil && bytes.Equal(b.Bytes(), body) {
+		return recordedBody{Body: body}
+	}
+	return recordedBody{BodyBase64: body}
+}
+
+// bytes returns the body; the JSON value is compacted, as the cassette is indented.
+func (b recordedBody) bytes() ([]byte, error) {
+	if len(b.Body) == 0 {
+		return b.BodyBase64, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b.Body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON encodes the request for the cassette.
+func (r Request) MarshalJSON() ([]byte, error) {
+	type request Request
+	return json.Marshal(struct {
+		request
+		recordedBody
+	}{request(r), newRecordedBody(r.Body)})
+}
+
+// UnmarshalJSON decodes the request from the cassette.
+func (r *Request) UnmarshalJSON(data []byte) error {
+	type request Request
+	var v struct {
+		*request
+		recordedBody
+	}
+	v.request = (*request)(r)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	body, err := v.bytes()
+	r.Body = body
+	return err
+}
+
+// MarshalJSON encodes the response for the cassette.
+func (r Response) MarshalJSON() ([]byte, error) {
+	type response Response
+	return json.Marshal(struct {
+		response
+		recordedBody
+	}{response(r), newRecordedBody(r.Body)})
+}
+
+// UnmarshalJSON decodes the response from the cassette.
+func (r *Response) UnmarshalJSON(data []byte) error {
+	type response Response
+	var v struct {
+		*response
+		recordedBody
+	}
+	v.response = (*response)(r)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	body, err := v.bytes()
+	r.Body = body
+	return err
+}
+
+// RecorderConfig represents the configuration of the recorder.
+type RecorderConfig struct {
+	Cassette string // Path of the cassette file.
+	Mode     Mode   // Default: ModeReplay.
+
+	// Transport executing the requests to record. Default: http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// Matchers for replaying the interactions; all of them must match. Default: DefaultMatchers.
+	Matchers []Matcher
+
+	// Replay the interactions repeatedly; by default, each interaction is replayed once.
+	Repeat bool
+
+	// Headers redacted in the cassette, in addition to DefaultRedactedHeaders.
+	RedactHeaders []string
+
+	// Optional function called before an interaction is saved to the cassette, eg. to redact the bodies.
+	Redact func(*Interaction)
+}
+
+// Recorder represents a transport which records and replays the requests and responses.
+//
+// It implements http.RoundTripper, to be used as the Transport in the client configuration,
+// and the Perform method, to be used as the transport for esapi requests and typedapi.New.
+type Recorder struct {
+	cfg      RecorderConfig
+	redacted []string
+
+	mu       sync.Mutex
+	cassette Cassette
+	replayed map[*Interaction]bool
+	recorded bool
+}
+
+// NewRecorder creates a new recorder with the configuration from cfg.
+//
+// The cassette is loaded unless the mode is ModeRecord; it's an error for
+// a missing cassette in ModeReplay. Call Close to save the recorded interactions.
+func NewRecorder(cfg RecorderConfig) (*Recorder, error) {
+	if cfg.Cassette == "" {
+		return nil, errors.New("cannot create recorder: missing cassette")
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = http.DefaultTransport
+	}
+	if len(cfg.Matchers) == 0 {
+		cfg.Matchers = DefaultMatchers
+	}
+
+	r := Recorder{
+		cfg:      cfg,
+		redacted: append(append([]string(nil), DefaultRedactedHeaders...), cfg.RedactHeaders...),
+		cassette: Cassette{Version: 1},
+		replayed: make(map[*Interaction]bool),
+	}
+
+	if cfg.Mode == ModeReplay || cfg.Mode == ModeReplayOrRecord {
+		data, err := ioutil.ReadFile(cfg.Cassette)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &r.cassette); err != nil {
+				return nil, fmt.Errorf("cannot load cassette %s: %s", cfg.Cassette, err)
+			}
+		case os.IsNotExist(err) && cfg.Mode == ModeReplayOrRecord:
+		default:
+			return nil, fmt.Errorf("cannot load cassette: %s", err)
+		}
+	}
+
+	return &r, nil
+}
+
+// Perform executes the request, see RoundTrip.
+func (r *Recorder) Perform(req *http.Request) (*http.Response, error) {
+	return r.RoundTrip(req)
+}
+
+// RoundTrip replays the response for the request from the cassette,
+// or executes the request with the transport and records the interaction,
+// according to the mode.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	actual := Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	}
+
+	if r.cfg.Mode == ModeReplay || r.cfg.Mode == ModeReplayOrRecord {
+		if i := r.match(actual); i != nil {
+			return i.Response.toHTTP(req), nil
+		}
+		if r.cfg.Mode == ModeReplay {
+			return nil, fmt.Errorf("no interaction in cassette %s matches the request %s %s", r.cfg.Cassette, req.Method, req.URL.RequestURI())
+		}
+	}
+
+	start := time.Now()
+	res, err := r.cfg.Transport.RoundTrip(req)
+	if err != nil || r.cfg.Mode == ModePassthrough {
+		return res, err
+	}
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	i := &Interaction{
+		Request: actual,
+		Response: Response{
+			StatusCode: res.StatusCode,
+			Header:     res.Header.Clone(),
+			Body:       resBody,
+			Duration:   time.Since(start),
+		},
+	}
+	r.redact(i)
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, i)
+	r.replayed[i] = true
+	r.recorded = true
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+// match returns the first interaction matching the request, or nil.
+func (r *Recorder) match(actual Request) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched *Interaction
+	for _, i := range r.cassette.Interactions {
+		if !r.matches(actual, i.Request) {
+			continue
+		}
+		if !r.replayed[i] {
+			r.replayed[i] = true
+			return i
+		}
+		if r.cfg.Repeat && matched == nil {
+			matched = i
+		}
+	}
+	return matched
+}
+
+func (r *Recorder) matches(actual, recorded Request) bool {
+	for _, m := range r.cfg.Matchers {
+		if !m(actual, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// redact replaces the values of the redacted headers, and calls the Redact function.
+func (r *Recorder) redact(i *Interaction) {
+	for _, h := range []http.Header{i.Request.Header, i.Response.Header} {
+		for _, name := range r.redacted {
+			if h.Get(name) != "" {
+				h.Set(name, Redacted)
+			}
+		}
+	}
+	if r.cfg.Redact != nil {
+		r.cfg.Redact(i)
+	}
+}
+
+// Interactions returns the interactions of the cassette.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interactions := make([]Interaction, 0, len(r.cassette.Interactions))
+	for _, i := range r.cassette.Interactions {
+		interactions = append(interactions, *i)
+	}
+	return interactions
+}
+
+// Unplayed returns the interactions of the cassette which were not replayed.
+func (r *Recorder) Unplayed() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var interactions []Interaction
+	for _, i := range r.cassette.Interactions {
+		if !r.replayed[i] {
+			interactions = append(interactions, *i)
+		}
+	}
+	return interactions
+}
+
+// Close saves the cassette, when interactions were recorded.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recorded {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot save cassette: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.cfg.Cassette), 0755); err != nil {
+		return fmt.Errorf("cannot save cassette: %s", err)
+	}
+	tmp := r.cfg.Cassette + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot save cassette: %s", err)
+	}
+	if err := os.Rename(tmp, r.cfg.Cassette); err != nil {
+		return fmt.Errorf("cannot save cassette: %s", err)
+	}
+
+	r.recorded = false
+	return nil
+}
+
+// toHTTP returns the recorded response as a HTTP response for req.
+func (res Response) toHTTP(req *http.Request) *http.Response {
+	header := res.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode)),
+		StatusCode:    res.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(res.Body)),
+		ContentLength: int64(len(res.Body)),
+		Request:       req,
+	}
+}
+
+// readBody reads the request body, and replaces it so the request can be executed.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
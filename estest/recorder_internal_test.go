@@ -0,0 +1,281 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package estest
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+func TestRecorder(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hits":{"total":{"value":1}}}`))
+	}))
+	defer server.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassettes", "search.json")
+
+	t.Run("Record", func(t *testing.T) {
+		rec, err := NewRecorder(RecorderConfig{Cassette: cassette, Mode: ModeRecord})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{
+			Addresses: []string{server.URL},
+			Username:  "elastic",
+			Password:  "secret",
+			Transport: rec,
+		})
+
+		res, err := es.Search(
+			es.Search.WithIndex("test"),
+			es.Search.WithBody(strings.NewReader(`{"query":{"match":{"title":"foo"}}}`)),
+			es.Search.WithSize(10),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		if err := rec.Close(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		data, err := ioutil.ReadFile(cassette)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if strings.Contains(string(data), "Basic ") || !strings.Contains(string(data), Redacted) {
+			t.Errorf("Expected the Authorization header to be redacted:\n%s", data)
+		}
+		if !strings.Contains(string(data), `"path": "/test/_search"`) {
+			t.Errorf("Expected the request path in the cassette:\n%s", data)
+		}
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		rec, err := NewRecorder(RecorderConfig{Cassette: cassette})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer rec.Close()
+
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{
+			Addresses: []string{"http://localhost:1"},
+			Transport: rec,
+		})
+
+		res, err := es.Search(
+			es.Search.WithIndex("test"),
+			es.Search.WithBody(strings.NewReader(`{ "query": { "match": { "title": "foo" } } }`)),
+			es.Search.WithSize(10),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != 200 || string(body) != `{"hits":{"total":{"value":1}}}` {
+			t.Errorf("Unexpected response: %d %s", res.StatusCode, body)
+		}
+		if res.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected response header: %v", res.Header)
+		}
+		if requests != 1 {
+			t.Errorf("Unexpected number of requests to the server: %d", requests)
+		}
+		if n := len(rec.Unplayed()); n != 0 {
+			t.Errorf("Unexpected number of unplayed interactions: %d", n)
+		}
+
+		// Each interaction is replayed once
+		_, err = es.Search(
+			es.Search.WithIndex("test"),
+			es.Search.WithBody(strings.NewReader(`{"query":{"match":{"title":"foo"}}}`)),
+			es.Search.WithSize(10),
+		)
+		if err == nil || !strings.Contains(err.Error(), "no interaction") {
+			t.Errorf("Expected error for unmatched request, got: %v", err)
+		}
+	})
+
+	t.Run("Replay with a missing cassette", func(t *testing.T) {
+		if _, err := NewRecorder(RecorderConfig{Cassette: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+			t.Errorf("Expected error for missing cassette")
+		}
+	})
+
+	t.Run("Replay or record", func(t *testing.T) {
+		rec, err := NewRecorder(RecorderConfig{Cassette: cassette, Mode: ModeReplayOrRecord, Repeat: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}, Transport: rec})
+
+		for i := 0; i < 2; i++ {
+			res, err := es.Search(
+				es.Search.WithIndex("test"),
+				es.Search.WithBody(strings.NewReader(`{"query":{"match":{"title":"foo"}}}`)),
+				es.Search.WithSize(10),
+			)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+		}
+
+		res, err := es.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		if requests != 2 {
+			t.Errorf("Unexpected number of requests to the server: %d", requests)
+		}
+		if err := rec.Close(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if n := len(rec.Interactions()); n != 2 {
+			t.Errorf("Unexpected number of interactions: %d", n)
+		}
+	})
+}
+
+func TestMatchers(t *testing.T) {
+	t.Run("JSON body", func(t *testing.T) {
+		tests := []struct {
+			a, b string
+			want bool
+		}{
+			{`{"a":1,"b":[1,2]}`, `{ "b": [1, 2], "a": 1 }`, true},
+			{`{"a":1}`, `{"a":2}`, false},
+			{`{"index":{}}` + "\n" + `{"a":1}` + "\n", `{"index":{}}` + "\n" + `{ "a": 1 }` + "\n", true},
+			{`{"index":{}}` + "\n" + `{"a":1}` + "\n", `{"index":{}}` + "\n", false},
+			{`{"a":1}}`, `{"a":1}`, false},
+			{`foo`, `foo`, true},
+			{``, ``, true},
+		}
+		for _, tt := range tests {
+			if got := MatchJSONBody(Request{Body: []byte(tt.a)}, Request{Body: []byte(tt.b)}); got != tt.want {
+				t.Errorf("Unexpected result for %q and %q: %v", tt.a, tt.b, got)
+			}
+		}
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		a, _ := url.ParseQuery("size=10&filter_path=a&filter_path=b")
+		b, _ := url.ParseQuery("filter_path=b&filter_path=a&size=10")
+		if !MatchQuery(Request{Query: a}, Request{Query: b}) {
+			t.Errorf("Expected the queries to match")
+		}
+		c, _ := url.ParseQuery("size=10")
+		if MatchQuery(Request{Query: a}, Request{Query: c}) {
+			t.Errorf("Expected the queries not to match")
+		}
+	})
+
+	t.Run("Mode", func(t *testing.T) {
+		if m, err := ParseMode("REPLAY_OR_RECORD"); err != nil || m != ModeReplayOrRecord {
+			t.Errorf("Unexpected mode: %s, %v", m, err)
+		}
+		if _, err := ParseMode("foo"); err == nil {
+			t.Errorf("Expected error for unknown mode")
+		}
+	})
+}
+
+func TestRecorderBinaryBody(t *testing.T) {
+	const doc = `{"hits":{"total":{"value":1}}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte(doc))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte(doc))
+		gw.Close()
+	}))
+	defer server.Close()
+
+	cassette := filepath.Join(t.TempDir(), "search.json")
+
+	search := func(rec *Recorder, addr string) string {
+		es, _ := elasticsearch.NewClient(elasticsearch.Config{
+			Addresses:            []string{addr},
+			CompressResponseBody: true,
+			Transport:            rec,
+		})
+		res, err := es.Search(es.Search.WithIndex("test"), es.Search.WithBody(strings.NewReader(`{"size":1}`)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return string(body)
+	}
+
+	rec, err := NewRecorder(RecorderConfig{Cassette: cassette, Mode: ModeRecord})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if body := search(rec, server.URL); body != doc {
+		t.Errorf("Unexpected recorded response: %q", body)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	data, _ := ioutil.ReadFile(cassette)
+	if !strings.Contains(string(data), `"body": {`) || !strings.Contains(string(data), `"body_base64": "`) {
+		t.Errorf("Expected the JSON request body and the base64 response body in the cassette:\n%s", data)
+	}
+
+	rec, err = NewRecorder(RecorderConfig{Cassette: cassette})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if body := search(rec, "http://localhost:1"); body != doc {
+		t.Errorf("Unexpected replayed response: %q", body)
+	}
+}
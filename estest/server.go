@@ -0,0 +1,999 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package estest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v8/internal/version"
+)
+
+// Server represents an in-process Elasticsearch server for tests.
+//
+// It implements a subset of the REST API in memory: the document APIs (index, create,
+// get, delete, update), bulk, search with a subset of the query DSL (match_all, term,
+// terms, match, range, exists, ids, prefix and bool), count, index creation and
+// deletion, mappings, aliases, refresh, cluster health and info. The documents are visible
+// to search immediately, without refreshing the index.
+//
+// Use the URL of the server in the client configuration:
+//
+//	srv := estest.NewServer()
+//	defer srv.Close()
+//
+//	es, _ := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	indices map[string]*fakeIndex
+	aliases map[string]map[string]fakeAlias // Alias to index names
+}
+
+// NewServer starts and returns a new server. The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{}
+	s.Reset()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Reset deletes all the indices and aliases.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.indices = make(map[string]*fakeIndex)
+	s.aliases = make(map[string]map[string]fakeAlias)
+}
+
+// fakeAlias holds the properties of an alias for an index.
+type fakeAlias struct {
+	IsWriteIndex *bool `json:"is_write_index,omitempty"`
+}
+
+// fakeIndex holds the documents of an index.
+type fakeIndex struct {
+	name     string
+	mappings map[string]interface{}
+	settings map[string]interface{}
+	docs     map[string]*fakeDocument
+	order    []string // Document IDs in the order of creation
+	seqNo    int64
+}
+
+type fakeDocument struct {
+	id      string
+	source  json.RawMessage
+	fields  map[string]interface{}
+	version int64
+	seqNo   int64
+}
+
+// fakeError represents an error response.
+type fakeError struct {
+	status int
+	typ    string
+	reason string
+	index  string
+}
+
+func (e *fakeError) Error() string { return e.reason }
+
+func (e *fakeError) body() map[string]interface{} {
+	cause := map[string]interface{}{"type": e.typ, "reason": e.reason}
+	if e.index != "" {
+		cause["index"] = e.index
+	}
+	errBody := map[string]interface{}{"root_cause": []interface{}{cause}}
+	for k, v := range cause {
+		errBody[k] = v
+	}
+	return map[string]interface{}{"error": errBody, "status": e.status}
+}
+
+func errIndexNotFound(index string) *fakeError {
+	return &fakeError{status: 404, typ: "index_not_found_exception", reason: fmt.Sprintf("no such index [%s]", index), index: index}
+}
+
+func errBadRequest(typ, format string, args ...interface{}) *fakeError {
+	return &fakeError{status: 400, typ: typ, reason: fmt.Sprintf(format, args...)}
+}
+
+// serveHTTP routes the request to the handler for the endpoint.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, r, errBadRequest("parse_exception", "cannot read request body: %s", err))
+		return
+	}
+
+	s.mu.Lock()
+	status, res := s.route(r, body)
+	s.mu.Unlock()
+
+	if e, ok := res.(*fakeError); ok {
+		s.writeError(w, r, e)
+		return
+	}
+	s.write(w, r, status, res)
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, status int, res interface{}) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	if strings.Contains(r.Header.Get("Accept"), "compatible-with") {
+		w.Header().Set("Content-Type", "application/vnd.elasticsearch+json;compatible-with=8")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead && res != nil {
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, e *fakeError) {
+	s.write(w, r, e.status, e.body())
+}
+
+// route returns the response status and body for the request.
+func (s *Server) route(r *http.Request, body []byte) (int, interface{}) {
+	var segments []string
+	for _, p := range strings.Split(strings.Trim(r.URL.Path, "/"), "/") {
+		if p != "" {
+			segments = append(segments, p)
+		}
+	}
+	q := r.URL.Query()
+	m := r.Method
+	read := m == http.MethodGet || m == http.MethodPost
+
+	if len(segments) == 0 {
+		if m == http.MethodGet || m == http.MethodHead {
+			return s.info()
+		}
+		return s.noHandler(r)
+	}
+
+	// Endpoints without index
+	switch {
+	case segments[0] == "_bulk" && len(segments) == 1 && (m == http.MethodPost || m == http.MethodPut):
+		return s.bulk("", body, q)
+	case segments[0] == "_search" && len(segments) == 1 && read:
+		return s.search("_all", body, q)
+	case segments[0] == "_count" && len(segments) == 1 && read:
+		return s.count("_all", body, q)
+	case segments[0] == "_mget" && len(segments) == 1 && read:
+		return s.mget("", body)
+	case segments[0] == "_refresh" && len(segments) == 1 && read:
+		return s.refresh("_all")
+	case segments[0] == "_aliases" && len(segments) == 1 && m == http.MethodPost:
+		return s.updateAliases(body)
+	case segments[0] == "_alias" && len(segments) <= 2 && (m == http.MethodGet || m == http.MethodHead):
+		return s.getAliases("_all", segmentAt(segments, 1))
+	case segments[0] == "_cluster" && len(segments) >= 2 && segments[1] == "health" && m == http.MethodGet:
+		return s.clusterHealth()
+	case strings.HasPrefix(segments[0], "_"):
+		return s.noHandler(r)
+	}
+
+	index := segments[0]
+	if len(segments) == 1 {
+		switch m {
+		case http.MethodPut:
+			return s.createIndex(index, body)
+		case http.MethodDelete:
+			return s.deleteIndex(index)
+		case http.MethodGet, http.MethodHead:
+			return s.getIndex(index)
+		}
+		return s.noHandler(r)
+	}
+
+	id := segmentAt(segments, 2)
+	switch endpoint := segments[1]; {
+	case endpoint == "_doc" && len(segments) == 2 && m == http.MethodPost:
+		return s.put(index, "", body, false, q)
+	case endpoint == "_doc" && len(segments) == 3 && (m == http.MethodPut || m == http.MethodPost):
+		return s.put(index, id, body, q.Get("op_type") == "create", q)
+	case endpoint == "_create" && len(segments) == 3 && (m == http.MethodPut || m == http.MethodPost):
+		return s.put(index, id, body, true, q)
+	case (endpoint == "_doc" || endpoint == "_source") && len(segments) == 3 && (m == http.MethodGet || m == http.MethodHead):
+		return s.getDocument(index, id, endpoint == "_source")
+	case endpoint == "_doc" && len(segments) == 3 && m == http.MethodDelete:
+		return s.deleteDocument(index, id)
+	case endpoint == "_update" && len(segments) == 3 && m == http.MethodPost:
+		return s.updateDocument(index, id, body)
+	case endpoint == "_bulk" && len(segments) == 2 && (m == http.MethodPost || m == http.MethodPut):
+		return s.bulk(index, body, q)
+	case endpoint == "_search" && len(segments) == 2 && read:
+		return s.search(index, body, q)
+	case endpoint == "_count" && len(segments) == 2 && read:
+		return s.count(index, body, q)
+	case endpoint == "_mget" && len(segments) == 2 && read:
+		return s.mget(index, body)
+	case endpoint == "_refresh" && len(segments) == 2 && read:
+		return s.refresh(index)
+	case (endpoint == "_alias" || endpoint == "_aliases") && len(segments) == 3 && (m == http.MethodPut || m == http.MethodPost):
+		return s.updateAliases(aliasAction("add", index, id))
+	case (endpoint == "_alias" || endpoint == "_aliases") && len(segments) == 3 && m == http.MethodDelete:
+		return s.updateAliases(aliasAction("remove", index, id))
+	case (endpoint == "_alias" || endpoint == "_aliases") && len(segments) <= 3 && (m == http.MethodGet || m == http.MethodHead):
+		return s.getAliases(index, id)
+	case endpoint == "_mapping" && len(segments) == 2 && m == http.MethodGet:
+		return s.getMapping(index)
+	case endpoint == "_mapping" && len(segments) == 2 && (m == http.MethodPut || m == http.MethodPost):
+		return s.putMapping(index, body)
+	}
+
+	return s.noHandler(r)
+}
+
+func segmentAt(segments []string, i int) string {
+	if i < len(segments) {
+		return segments[i]
+	}
+	return ""
+}
+
+func (s *Server) noHandler(r *http.Request) (int, interface{}) {
+	return 400, map[string]interface{}{
+		"error":  fmt.Sprintf("no handler found for uri [%s] and method [%s]", r.URL.RequestURI(), r.Method),
+		"status": 400,
+	}
+}
+
+func (s *Server) info() (int, interface{}) {
+	number := strings.SplitN(version.Client, "-", 2)[0]
+	return 200, map[string]interface{}{
+		"name":         "estest",
+		"cluster_name": "estest",
+		"cluster_uuid": "estest",
+		"version": map[string]interface{}{
+			"number":                              number,
+			"build_flavor":                        "default",
+			"build_type":                          "docker",
+			"build_hash":                          "estest",
+			"build_date":                          "2023-01-01T00:00:00.000000000Z",
+			"build_snapshot":                      false,
+			"lucene_version":                      "9.5.0",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	}
+}
+
+func (s *Server) clusterHealth() (int, interface{}) {
+	return 200, map[string]interface{}{
+		"cluster_name":                     "estest",
+		"status":                           "green",
+		"timed_out":                        false,
+		"number_of_nodes":                  1,
+		"number_of_data_nodes":             1,
+		"active_primary_shards":            len(s.indices),
+		"active_shards":                    len(s.indices),
+		"relocating_shards":                0,
+		"initializing_shards":              0,
+		"unassigned_shards":                0,
+		"delayed_unassigned_shards":        0,
+		"number_of_pending_tasks":          0,
+		"number_of_in_flight_fetch":        0,
+		"task_max_waiting_in_queue_millis": 0,
+		"active_shards_percent_as_number":  100.0,
+	}
+}
+
+func shards() map[string]interface{} {
+	return map[string]interface{}{"total": 1, "successful": 1, "skipped": 0, "failed": 0}
+}
+
+// resolve returns the names of the indices for the expression, eg. "logs-*,my-alias".
+func (s *Server) resolve(expr string) ([]string, *fakeError) {
+	names := make(map[string]bool)
+	for _, part := range strings.Split(expr, ",") {
+		switch {
+		case part == "_all" || part == "*" || part == "":
+			for name := range s.indices {
+				names[name] = true
+			}
+		case strings.ContainsAny(part, "*?"):
+			for name := range s.indices {
+				if ok, _ := path.Match(part, name); ok {
+					names[name] = true
+				}
+			}
+			for alias, indices := range s.aliases {
+				if ok, _ := path.Match(part, alias); ok {
+					for name := range indices {
+						names[name] = true
+					}
+				}
+			}
+		case s.indices[part] != nil:
+			names[part] = true
+		case s.aliases[part] != nil:
+			for name := range s.aliases[part] {
+				names[name] = true
+			}
+		default:
+			return nil, errIndexNotFound(part)
+		}
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// writeIndex returns the index for writing to name, creating it when it doesn't exist.
+func (s *Server) writeIndex(name string) (*fakeIndex, *fakeError) {
+	if idx := s.indices[name]; idx != nil {
+		return idx, nil
+	}
+	if indices := s.aliases[name]; indices != nil {
+		index := aliasWriteIndex(indices)
+		if index == "" {
+			return nil, errBadRequest("illegal_argument_exception", "no write index is defined for alias [%s]", name)
+		}
+		return s.indices[index], nil
+	}
+	if err := validateIndexName(name); err != nil {
+		return nil, err
+	}
+	s.indices[name] = newFakeIndex(name)
+	return s.indices[name], nil
+}
+
+func validateIndexName(name string) *fakeError {
+	if name == "" || strings.ToLower(name) != name || strings.ContainsAny(name, `\/*?"<>| ,#:`) || strings.HasPrefix(name, "_") {
+		return &fakeError{status: 400, typ: "invalid_index_name_exception", reason: fmt.Sprintf("Invalid index name [%s]", name), index: name}
+	}
+	return nil
+}
+
+func newFakeIndex(name string) *fakeIndex {
+	return &fakeIndex{
+		name:     name,
+		mappings: map[string]interface{}{},
+		settings: map[string]interface{}{"index": map[string]interface{}{"number_of_shards": "1", "number_of_replicas": "1"}},
+		docs:     make(map[string]*fakeDocument),
+	}
+}
+
+func (s *Server) createIndex(name string, body []byte) (int, interface{}) {
+	if s.indices[name] != nil || s.aliases[name] != nil {
+		return 0, &fakeError{status: 400, typ: "resource_already_exists_exception", reason: fmt.Sprintf("index [%s] already exists", name), index: name}
+	}
+	if err := validateIndexName(name); err != nil {
+		return 0, err
+	}
+
+	var req struct {
+		Mappings map[string]interface{} `json:"mappings"`
+		Settings map[string]interface{} `json:"settings"`
+		Aliases  map[string]fakeAlias   `json:"aliases"`
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, errBadRequest("parse_exception", "failed to parse request body: %s", err)
+		}
+	}
+
+	idx := newFakeIndex(name)
+	if req.Mappings != nil {
+		idx.mappings = req.Mappings
+	}
+	if req.Settings != nil {
+		idx.settings = req.Settings
+	}
+	s.indices[name] = idx
+	for alias, a := range req.Aliases {
+		s.addAlias(alias, name, a)
+	}
+
+	return 200, map[string]interface{}{"acknowledged": true, "shards_acknowledged": true, "index": name}
+}
+
+func (s *Server) deleteIndex(expr string) (int, interface{}) {
+	names, err := s.resolve(expr)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range names {
+		delete(s.indices, name)
+		for alias, indices := range s.aliases {
+			delete(indices, name)
+			if len(indices) == 0 {
+				delete(s.aliases, alias)
+			}
+		}
+	}
+	return 200, map[string]interface{}{"acknowledged": true}
+}
+
+func (s *Server) getIndex(expr string) (int, interface{}) {
+	names, err := s.resolve(expr)
+	if err != nil {
+		return 0, err
+	}
+	res := make(map[string]interface{})
+	for _, name := range names {
+		idx := s.indices[name]
+		res[name] = map[string]interface{}{
+			"aliases":  s.indexAliases(name),
+			"mappings": idx.mappings,
+			"settings": idx.settings,
+		}
+	}
+	return 200, res
+}
+
+func (s *Server) getMapping(expr string) (int, interface{}) {
+	names, err := s.resolve(expr)
+	if err != nil {
+		return 0, err
+	}
+	res := make(map[string]interface{})
+	for _, name := range names {
+		res[name] = map[string]interface{}{"mappings": s.indices[name].mappings}
+	}
+	return 200, res
+}
+
+func (s *Server) putMapping(expr string, body []byte) (int, interface{}) {
+	names, err := s.resolve(expr)
+	if err != nil {
+		return 0, err
+	}
+	var mappings map[string]interface{}
+	if err := json.Unmarshal(body, &mappings); err != nil {
+		return 0, errBadRequest("parse_exception", "failed to parse request body: %s", err)
+	}
+	for _, name := range names {
+		mergeObject(s.indices[name].mappings, mappings)
+	}
+	return 200, map[string]interface{}{"acknowledged": true}
+}
+
+func (s *Server) refresh(expr string) (int, interface{}) {
+	if _, err := s.resolve(expr); err != nil {
+		return 0, err
+	}
+	return 200, map[string]interface{}{"_shards": shards()}
+}
+
+// Aliases
+
+func aliasAction(action, index, alias string) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"actions": []interface{}{map[string]interface{}{action: map[string]string{"index": index, "alias": alias}}},
+	})
+	return b
+}
+
+func (s *Server) addAlias(alias, index string, a fakeAlias) {
+	if s.aliases[alias] == nil {
+		s.aliases[alias] = make(map[string]fakeAlias)
+	}
+	s.aliases[alias][index] = a
+}
+
+func (s *Server) indexAliases(index string) map[string]interface{} {
+	aliases := make(map[string]interface{})
+	for alias, indices := range s.aliases {
+		if a, ok := indices[index]; ok {
+			aliases[alias] = a
+		}
+	}
+	return aliases
+}
+
+// aliasWriteIndex returns the index of the alias with is_write_index set to true,
+// or its only index unless is_write_index is set to false, or an empty string.
+func aliasWriteIndex(indices map[string]fakeAlias) string {
+	for index, a := range indices {
+		if a.IsWriteIndex != nil && *a.IsWriteIndex {
+			return index
+		}
+	}
+	if len(indices) == 1 {
+		for index, a := range indices {
+			if a.IsWriteIndex == nil {
+				return index
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Server) updateAliases(body []byte) (int, interface{}) {
+	var req struct {
+		Actions []map[string]struct {
+			Index   string   `json:"index"`
+			Indices []string `json:"indices"`
+			Alias   string   `json:"alias"`
+			Aliases []string `json:"aliases"`
+
+			IsWriteIndex *bool `json:"is_write_index"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, errBadRequest("parse_exception", "failed to parse request body: %s", err)
+	}
+
+	// Validate all the actions first, as they're applied atomically
+	type change struct {
+		add          bool
+		index, alias string
+		props        fakeAlias
+	}
+	var changes []change
+	for _, action := range req.Actions {
+		for typ, a := range action {
+			if typ != "add" && typ != "remove" && typ != "remove_index" {
+				return 0, errBadRequest("illegal_argument_exception", "unsupported alias action [%s]", typ)
+			}
+			var names []string
+			for _, expr := range append(a.Indices, a.Index) {
+				if expr == "" {
+					continue
+				}
+				resolved, err := s.resolve(expr)
+				if err != nil {
+					return 0, err
+				}
+				names = append(names, resolved...)
+			}
+			if typ == "remove_index" {
+				for _, name := range names {
+					changes = append(changes, change{index: name})
+				}
+				continue
+			}
+			for _, alias := range append(a.Aliases, a.Alias) {
+				if alias == "" {
+					continue
+				}
+				for _, name := range names {
+					if _, ok := s.aliases[alias][name]; typ == "remove" && !ok {
+						return 0, &fakeError{status: 404, typ: "aliases_not_found_exception", reason: fmt.Sprintf("aliases [%s] missing", alias)}
+					}
+					changes = append(changes, change{add: typ == "add", index: name, alias: alias, props: fakeAlias{IsWriteIndex: a.IsWriteIndex}})
+				}
+			}
+		}
+	}
+
+	// Validate the write indices of the updated aliases
+	updated := make(map[string]map[string]fakeAlias)
+	for _, c := range changes {
+		if c.alias == "" {
+			continue
+		}
+		if updated[c.alias] == nil {
+			updated[c.alias] = make(map[string]fakeAlias)
+			for index, a := range s.aliases[c.alias] {
+				updated[c.alias][index] = a
+			}
+		}
+		if c.add {
+			updated[c.alias][c.index] = c.props
+		} else {
+			delete(updated[c.alias], c.index)
+		}
+	}
+	for alias, indices := range updated {
+		var writeIndices []string
+		for index, a := range indices {
+			if a.IsWriteIndex != nil && *a.IsWriteIndex {
+				writeIndices = append(writeIndices, index)
+			}
+		}
+		if len(writeIndices) > 1 {
+			sort.Strings(writeIndices)
+			return 0, errBadRequest("illegal_state_exception", "alias [%s] has more than one write index [%s]", alias, strings.Join(writeIndices, ","))
+		}
+	}
+
+	for _, c := range changes {
+		switch {
+		case c.add:
+			s.addAlias(c.alias, c.index, c.props)
+		case c.alias == "":
+			s.deleteIndex(c.index)
+		default:
+			delete(s.aliases[c.alias], c.index)
+			if len(s.aliases[c.alias]) == 0 {
+				delete(s.aliases, c.alias)
+			}
+		}
+	}
+
+	return 200, map[string]interface{}{"acknowledged": true}
+}
+
+func (s *Server) getAliases(expr, name string) (int, interface{}) {
+	names, err := s.resolve(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	res := make(map[string]interface{})
+	for _, index := range names {
+		aliases := s.indexAliases(index)
+		if name != "" {
+			for alias := range aliases {
+				if ok, _ := path.Match(name, alias); !ok && alias != name {
+					delete(aliases, alias)
+				}
+			}
+			if len(aliases) == 0 {
+				continue
+			}
+		}
+		res[index] = map[string]interface{}{"aliases": aliases}
+	}
+	if name != "" && len(res) == 0 {
+		return 404, map[string]interface{}{"error": fmt.Sprintf("alias [%s] missing", name), "status": 404}
+	}
+	return 200, res
+}
+
+// Documents
+
+func newID() string {
+	b := make([]byte, 15)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *Server) docResponse(idx *fakeIndex, doc *fakeDocument, result string) map[string]interface{} {
+	return map[string]interface{}{
+		"_index":        idx.name,
+		"_id":           doc.id,
+		"_version":      doc.version,
+		"result":        result,
+		"_shards":       map[string]interface{}{"total": 2, "successful": 1, "failed": 0},
+		"_seq_no":       doc.seqNo,
+		"_primary_term": 1,
+	}
+}
+
+// put stores the document, returning the response status and body.
+func (s *Server) put(index, id string, source []byte, create bool, q map[string][]string) (int, interface{}) {
+	idx, ferr := s.writeIndex(index)
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(source, &fields); err != nil || fields == nil {
+		return 0, &fakeError{status: 400, typ: "mapper_parsing_exception", reason: "failed to parse", index: idx.name}
+	}
+
+	if id == "" {
+		id = newID()
+	}
+	existing := idx.docs[id]
+	if existing != nil && create {
+		return 0, &fakeError{
+			status: 409,
+			typ:    "version_conflict_engine_exception",
+			reason: fmt.Sprintf("[%s]: version conflict, document already exists (current version [%d])", id, existing.version),
+			index:  idx.name,
+		}
+	}
+	if err := checkSeqNo(idx, id, existing, q); err != nil {
+		return 0, err
+	}
+
+	idx.seqNo++
+	doc := &fakeDocument{id: id, source: append(json.RawMessage(nil), source...), fields: fields, version: 1, seqNo: idx.seqNo - 1}
+	status, result := 201, "created"
+	if existing != nil {
+		doc.version = existing.version + 1
+		status, result = 200, "updated"
+	} else {
+		idx.order = append(idx.order, id)
+	}
+	idx.docs[id] = doc
+
+	return status, s.docResponse(idx, doc, result)
+}
+
+// checkSeqNo checks the if_seq_no and if_primary_term parameters.
+func checkSeqNo(idx *fakeIndex, id string, doc *fakeDocument, q map[string][]string) *fakeError {
+	v, ok := q["if_seq_no"]
+	if !ok || len(v) == 0 {
+		return nil
+	}
+	seqNo, _ := strconv.ParseInt(v[0], 10, 64)
+	if doc == nil || doc.seqNo != seqNo {
+		return &fakeError{
+			status: 409,
+			typ:    "version_conflict_engine_exception",
+			reason: fmt.Sprintf("[%s]: version conflict, required seqNo [%d]", id, seqNo),
+			index:  idx.name,
+		}
+	}
+	return nil
+}
+
+func (s *Server) getDocument(expr, id string, sourceOnly bool) (int, interface{}) {
+	idx := s.indices[expr]
+	if idx == nil {
+		if indices := s.aliases[expr]; len(indices) == 1 {
+			for name := range indices {
+				idx = s.indices[name]
+			}
+		}
+	}
+	if idx == nil {
+		return 0, errIndexNotFound(expr)
+	}
+
+	doc := idx.docs[id]
+	if doc == nil {
+		if sourceOnly {
+			return 0, &fakeError{status: 404, typ: "resource_not_found_exception", reason: fmt.Sprintf("Document not found [%s]/[%s]", idx.name, id)}
+		}
+		return 404, map[string]interface{}{"_index": idx.name, "_id": id, "found": false}
+	}
+	if sourceOnly {
+		return 200, doc.source
+	}
+	return 200, map[string]interface{}{
+		"_index":        idx.name,
+		"_id":           doc.id,
+		"_version":      doc.version,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": 1,
+		"found":         true,
+		"_source":       doc.source,
+	}
+}
+
+func (s *Server) deleteDocument(index, id string) (int, interface{}) {
+	idx, ferr := s.writeIndex(index)
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	doc := idx.docs[id]
+	if doc == nil {
+		idx.seqNo++
+		return 404, s.docResponse(idx, &fakeDocument{id: id, version: 1, seqNo: idx.seqNo - 1}, "not_found")
+	}
+
+	delete(idx.docs, id)
+	for i, docID := range idx.order {
+		if docID == id {
+			idx.order = append(idx.order[:i], idx.order[i+1:]...)
+			break
+		}
+	}
+	idx.seqNo++
+	doc.version++
+	doc.seqNo = idx.seqNo - 1
+
+	return 200, s.docResponse(idx, doc, "deleted")
+}
+
+func (s *Server) updateDocument(index, id string, body []byte) (int, interface{}) {
+	var req struct {
+		Doc         map[string]interface{} `json:"doc"`
+		DocAsUpsert bool                   `json:"doc_as_upsert"`
+		Upsert      map[string]interface{} `json:"upsert"`
+		Script      interface{}            `json:"script"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, errBadRequest("x_content_parse_exception", "failed to parse request body: %s", err)
+	}
+	if req.Script != nil {
+		return 0, errBadRequest("illegal_argument_exception", "scripted updates are not supported")
+	}
+	if req.Doc == nil && req.Upsert == nil {
+		return 0, errBadRequest("action_request_validation_exception", "Validation Failed: 1: script or doc is missing;")
+	}
+
+	idx, ferr := s.writeIndex(index)
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	doc := idx.docs[id]
+	if doc == nil {
+		upsert := req.Upsert
+		if req.DocAsUpsert {
+			upsert = req.Doc
+		}
+		if upsert == nil {
+			return 0, &fakeError{status: 404, typ: "document_missing_exception", reason: fmt.Sprintf("[%s]: document missing", id), index: idx.name}
+		}
+		source, _ := json.Marshal(upsert)
+		return s.put(idx.name, id, source, true, nil)
+	}
+
+	fields := deepCopy(doc.fields).(map[string]interface{})
+	mergeObject(fields, req.Doc)
+	source, _ := json.Marshal(fields)
+	if current, _ := json.Marshal(doc.fields); bytes.Equal(current, source) {
+		return 200, s.docResponse(idx, doc, "noop")
+	}
+	return s.put(idx.name, id, source, false, nil)
+}
+
+func (s *Server) mget(index string, body []byte) (int, interface{}) {
+	var req struct {
+		Docs []struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		} `json:"docs"`
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, errBadRequest("parse_exception", "failed to parse request body: %s", err)
+	}
+	for _, id := range req.IDs {
+		req.Docs = append(req.Docs, struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{ID: id})
+	}
+
+	docs := make([]interface{}, 0, len(req.Docs))
+	for _, d := range req.Docs {
+		if d.Index == "" {
+			d.Index = index
+		}
+		_, res := s.getDocument(d.Index, d.ID, false)
+		if e, ok := res.(*fakeError); ok {
+			res = map[string]interface{}{"_index": d.Index, "_id": d.ID, "error": e.body()["error"]}
+		}
+		docs = append(docs, res)
+	}
+	return 200, map[string]interface{}{"docs": docs}
+}
+
+// bulk executes the bulk operations.
+func (s *Server) bulk(index string, body []byte, q map[string][]string) (int, interface{}) {
+	var (
+		items  []interface{}
+		errors bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return 0, errBadRequest("illegal_argument_exception", "Malformed action/metadata line")
+		}
+
+		for typ, meta := range action {
+			if meta.Index == "" {
+				meta.Index = index
+			}
+
+			var source []byte
+			if typ != "delete" {
+				if !scanner.Scan() {
+					return 0, errBadRequest("illegal_argument_exception", "The bulk request must be terminated by a newline [\\n]")
+				}
+				source = append([]byte(nil), scanner.Bytes()...)
+			}
+
+			var (
+				status int
+				res    interface{}
+			)
+			switch {
+			case meta.Index == "":
+				status, res = 0, errBadRequest("action_request_validation_exception", "Validation Failed: 1: index is missing;")
+			case typ == "index":
+				status, res = s.put(meta.Index, meta.ID, source, false, nil)
+			case typ == "create":
+				status, res = s.put(meta.Index, meta.ID, source, true, nil)
+			case typ == "update":
+				status, res = s.updateDocument(meta.Index, meta.ID, source)
+			case typ == "delete":
+				status, res = s.deleteDocument(meta.Index, meta.ID)
+			default:
+				return 0, errBadRequest("illegal_argument_exception", "Malformed action/metadata line, expected one of [create, delete, index, update] but found [%s]", typ)
+			}
+
+			item, ok := res.(map[string]interface{})
+			if e, isErr := res.(*fakeError); isErr {
+				errors = true
+				status = e.status
+				item = map[string]interface{}{
+					"_index": meta.Index,
+					"_id":    meta.ID,
+					"error":  e.body()["error"].(map[string]interface{}),
+				}
+				delete(item["error"].(map[string]interface{}), "root_cause")
+			} else if !ok {
+				item = map[string]interface{}{}
+			}
+			if status >= 300 && typ != "delete" {
+				errors = true
+			}
+			item["status"] = status
+			items = append(items, map[string]interface{}{typ: item})
+		}
+	}
+
+	return 200, map[string]interface{}{"took": 1, "errors": errors, "items": items}
+}
+
+// mergeObject merges src into dst recursively.
+func mergeObject(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sv, ok := v.(map[string]interface{}); ok {
+			if dv, ok := dst[k].(map[string]interface{}); ok {
+				mergeObject(dv, sv)
+				continue
+			}
+		}
+		dst[k] = deepCopy(v)
+	}
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = deepCopy(e)
+		}
+		return a
+	default:
+		return v
+	}
+}
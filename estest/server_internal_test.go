@@ -0,0 +1,349 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package estest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/esutil"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/count"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	es, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	typed, err := elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	t.Run("Info", func(t *testing.T) {
+		res, err := es.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		if res.Header.Get("X-Elastic-Product") != "Elasticsearch" {
+			t.Errorf("Missing X-Elastic-Product header: %v", res.Header)
+		}
+
+		info, err := typed.Info().Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if info.Version.Int == "" || info.Tagline == "" {
+			t.Errorf("Unexpected response: %+v", info)
+		}
+
+		health, err := typed.Cluster.Health().Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if health.Status.Name != "green" {
+			t.Errorf("Unexpected cluster health: %s", health.Status)
+		}
+	})
+
+	t.Run("Index management", func(t *testing.T) {
+		res, err := es.Indices.Create("articles-1", es.Indices.Create.WithBody(strings.NewReader(
+			`{"mappings":{"properties":{"title":{"type":"text"}}},"aliases":{"articles":{}}}`,
+		)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		if res.IsError() {
+			t.Fatalf("Unexpected response: %s", res)
+		}
+
+		res, _ = es.Indices.Create("articles-1")
+		res.Body.Close()
+		if res.StatusCode != 400 {
+			t.Errorf("Expected error for existing index, got: %s", res)
+		}
+
+		exists, err := typed.Indices.Exists("articles").IsSuccess(ctx)
+		if err != nil || !exists {
+			t.Errorf("Expected the alias to exist: %v", err)
+		}
+
+		res, _ = es.Indices.Delete([]string{"missing"})
+		res.Body.Close()
+		if res.StatusCode != 404 {
+			t.Errorf("Expected error for missing index, got: %s", res)
+		}
+	})
+
+	t.Run("Documents", func(t *testing.T) {
+		indexed, err := typed.Index("articles").Id("1").Request(map[string]interface{}{"title": "Hello World", "views": 10}).Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if indexed.Index_ != "articles-1" || indexed.Result.Name != "created" {
+			t.Errorf("Unexpected response: %+v", indexed)
+		}
+
+		doc, err := typed.Get("articles", "1").Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if !doc.Found || !strings.Contains(string(doc.Source_), "Hello World") {
+			t.Errorf("Unexpected response: %+v", doc)
+		}
+
+		res, err := es.Update("articles", "1", strings.NewReader(`{"doc":{"views":11}}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		res, _ = es.Create("articles", "1", strings.NewReader(`{"title":"Duplicate"}`))
+		res.Body.Close()
+		if res.StatusCode != 409 {
+			t.Errorf("Expected conflict, got: %s", res)
+		}
+
+		res, _ = es.Get("articles", "1")
+		var body struct {
+			Version int                    `json:"_version"`
+			Source  map[string]interface{} `json:"_source"`
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+		if body.Version != 2 || body.Source["views"] != 11.0 || body.Source["title"] != "Hello World" {
+			t.Errorf("Unexpected document: %+v", body)
+		}
+
+		res, _ = es.Delete("articles", "1")
+		res.Body.Close()
+		res, _ = es.Get("articles", "1")
+		res.Body.Close()
+		if res.StatusCode != 404 {
+			t.Errorf("Expected missing document, got: %s", res)
+		}
+	})
+
+	t.Run("Bulk indexer", func(t *testing.T) {
+		bi, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{Client: es, Index: "articles"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		for i := 1; i <= 10; i++ {
+			err := bi.Add(ctx, esutil.BulkIndexerItem{
+				Action:     "index",
+				DocumentID: fmt.Sprintf("%d", i),
+				Body:       strings.NewReader(fmt.Sprintf(`{"title":"Article %d","tags":["go","test"],"views":%d}`, i, i*10)),
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+		}
+		if err := bi.Add(ctx, esutil.BulkIndexerItem{Action: "update", DocumentID: "missing", Body: strings.NewReader(`{"doc":{}}`)}); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if err := bi.Close(ctx); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		stats := bi.Stats()
+		if stats.NumIndexed != 10 || stats.NumFailed != 1 {
+			t.Errorf("Unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		gte := types.Float64(50)
+		res, err := typed.Search().Index("articles").Request(&search.Request{
+			Query: &types.Query{
+				Bool: &types.BoolQuery{
+					Must:   []types.Query{{Match: map[string]types.MatchQuery{"title": {Query: "article"}}}},
+					Filter: []types.Query{{Range: map[string]types.RangeQuery{"views": types.NumberRangeQuery{Gte: &gte}}}},
+					MustNot: []types.Query{{Term: map[string]types.TermQuery{"_id": {Value: "7"}}},
+						{Term: map[string]types.TermQuery{"views": {Value: 70}}}},
+				},
+			},
+			Sort: []types.SortCombinations{map[string]interface{}{"views": "desc"}},
+		}).Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Hits.Total.Value != 5 || len(res.Hits.Hits) != 5 {
+			t.Fatalf("Unexpected hits: %+v", res.Hits)
+		}
+		if res.Hits.Hits[0].Id_ != "10" || res.Hits.Hits[4].Id_ != "5" {
+			t.Errorf("Unexpected order: %s, %s", res.Hits.Hits[0].Id_, res.Hits.Hits[4].Id_)
+		}
+
+		counted, err := typed.Count().Index("art*").Request(&count.Request{Query: &types.Query{
+			Terms: &types.TermsQuery{TermsQuery: map[string]types.TermsQueryField{"tags": []types.FieldValue{"go"}}},
+		}}).Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if counted.Count != 10 {
+			t.Errorf("Unexpected count: %d", counted.Count)
+		}
+
+		r, _ := es.Search(es.Search.WithIndex("articles"), es.Search.WithBody(strings.NewReader(`{"query":{"unknown":{}}}`)))
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if r.StatusCode != 400 || !strings.Contains(string(body), "unknown query [unknown]") {
+			t.Errorf("Unexpected response: %s", body)
+		}
+
+		_, err = typed.Search().Index("missing").Do(ctx)
+		var esErr *types.ElasticsearchError
+		if !errors.As(err, &esErr) || esErr.Status != 404 {
+			t.Errorf("Expected index not found error, got: %v", err)
+		}
+	})
+
+	t.Run("Aliases", func(t *testing.T) {
+		res, err := es.Indices.Create("articles-2")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		res, err = es.Indices.UpdateAliases(strings.NewReader(`{"actions":[
+			{"remove":{"index":"articles-1","alias":"articles"}},
+			{"add":{"index":"articles-2","alias":"articles"}}
+		]}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		counted, err := typed.Count().Index("articles").Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if counted.Count != 0 {
+			t.Errorf("Expected the alias to point to the new index, got: %d documents", counted.Count)
+		}
+
+		aliases, err := typed.Indices.GetAlias().Name("articles").Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, ok := aliases["articles-2"]; !ok || len(aliases) != 1 {
+			t.Errorf("Unexpected aliases: %+v", aliases)
+		}
+	})
+
+	t.Run("Write index", func(t *testing.T) {
+		for index, body := range map[string]string{
+			"logs-1": `{"aliases":{"logs":{"is_write_index":true}}}`,
+			"logs-2": `{"aliases":{"logs":{}}}`,
+		} {
+			res, err := es.Indices.Create(index, es.Indices.Create.WithBody(strings.NewReader(body)))
+			if err != nil || res.IsError() {
+				t.Fatalf("Unexpected response: %s, %v", res, err)
+			}
+			res.Body.Close()
+		}
+
+		count := func(index string) int64 {
+			counted, err := typed.Count().Index(index).Do(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			return counted.Count
+		}
+		write := func() *esapi.Response {
+			res, err := es.Index("logs", strings.NewReader(`{"message":"foo"}`))
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+			return res
+		}
+
+		if res := write(); res.IsError() {
+			t.Fatalf("Unexpected response: %s", res)
+		}
+		if count("logs-1") != 1 || count("logs-2") != 0 {
+			t.Errorf("Expected the document in the write index")
+		}
+
+		aliases, err := typed.Indices.GetAlias().Name("logs").Do(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if a := aliases["logs-1"].Aliases["logs"]; a.IsWriteIndex == nil || !*a.IsWriteIndex {
+			t.Errorf("Unexpected aliases: %+v", aliases)
+		}
+
+		res, err := es.Indices.UpdateAliases(strings.NewReader(`{"actions":[
+			{"add":{"index":"logs-2","alias":"logs","is_write_index":true}}
+		]}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 400 {
+			t.Errorf("Expected error for two write indices, got: %s", res)
+		}
+
+		res, err = es.Indices.UpdateAliases(strings.NewReader(`{"actions":[
+			{"add":{"index":"logs-1","alias":"logs","is_write_index":false}},
+			{"add":{"index":"logs-2","alias":"logs","is_write_index":true}}
+		]}`))
+		if err != nil || res.IsError() {
+			t.Fatalf("Unexpected response: %s, %v", res, err)
+		}
+		res.Body.Close()
+
+		write()
+		if count("logs-1") != 1 || count("logs-2") != 1 {
+			t.Errorf("Expected the document in the new write index")
+		}
+
+		res, err = es.Indices.UpdateAliases(strings.NewReader(`{"actions":[
+			{"add":{"index":"logs-2","alias":"logs"}}
+		]}`))
+		if err != nil || res.IsError() {
+			t.Fatalf("Unexpected response: %s, %v", res, err)
+		}
+		res.Body.Close()
+
+		if res := write(); res.StatusCode != 400 {
+			t.Errorf("Expected error without write index, got: %s", res)
+		}
+	})
+}
@@ -0,0 +1,619 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package estest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// leafQueries are the supported queries on a field.
+var leafQueries = map[string]bool{"term": true, "terms": true, "prefix": true, "match": true, "match_phrase": true, "range": true}
+
+// queryFunc returns whether the document matches the query, and its score.
+type queryFunc func(doc *fakeDocument) (bool, float64)
+
+type searchHit struct {
+	index string
+	doc   *fakeDocument
+	score float64
+	sort  []interface{}
+}
+
+type sortField struct {
+	field string
+	desc  bool
+}
+
+// search executes the search request on the indices.
+func (s *Server) search(expr string, body []byte, q map[string][]string) (int, interface{}) {
+	var req struct {
+		Query        interface{} `json:"query"`
+		Size         *int        `json:"size"`
+		From         int         `json:"from"`
+		Sort         interface{} `json:"sort"`
+		Aggregations interface{} `json:"aggregations"`
+		Aggs         interface{} `json:"aggs"`
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, errBadRequest("parsing_exception", "failed to parse search request: %s", err)
+		}
+	}
+	if req.Aggregations != nil || req.Aggs != nil {
+		return 0, errBadRequest("illegal_argument_exception", "aggregations are not supported")
+	}
+	if v, ok := q["size"]; ok && len(v) > 0 {
+		size, _ := strconv.Atoi(v[0])
+		req.Size = &size
+	}
+	if v, ok := q["from"]; ok && len(v) > 0 {
+		req.From, _ = strconv.Atoi(v[0])
+	}
+	if v, ok := q["sort"]; ok && len(v) > 0 {
+		var specs []interface{}
+		for _, spec := range strings.Split(v[0], ",") {
+			parts := strings.SplitN(spec, ":", 2)
+			if len(parts) == 2 {
+				specs = append(specs, map[string]interface{}{parts[0]: parts[1]})
+			} else {
+				specs = append(specs, parts[0])
+			}
+		}
+		req.Sort = specs
+	}
+	size := 10
+	if req.Size != nil {
+		size = *req.Size
+	}
+
+	hits, ferr := s.match(expr, req.Query)
+	if ferr != nil {
+		return 0, ferr
+	}
+
+	sortFields, ferr := parseSort(req.Sort)
+	if ferr != nil {
+		return 0, ferr
+	}
+	sortHits(hits, sortFields)
+
+	var maxScore interface{}
+	for _, h := range hits {
+		if maxScore == nil || h.score > maxScore.(float64) {
+			maxScore = h.score
+		}
+	}
+
+	total := len(hits)
+	if req.From > len(hits) {
+		req.From = len(hits)
+	}
+	hits = hits[req.From:]
+	if size < len(hits) {
+		hits = hits[:size]
+	}
+
+	results := make([]interface{}, 0, len(hits))
+	for _, h := range hits {
+		hit := map[string]interface{}{
+			"_index":  h.index,
+			"_id":     h.doc.id,
+			"_score":  h.score,
+			"_source": h.doc.source,
+		}
+		if len(sortFields) > 0 {
+			hit["sort"] = h.sort
+		}
+		results = append(results, hit)
+	}
+
+	return 200, map[string]interface{}{
+		"took":      1,
+		"timed_out": false,
+		"_shards":   shards(),
+		"hits": map[string]interface{}{
+			"total":     map[string]interface{}{"value": total, "relation": "eq"},
+			"max_score": maxScore,
+			"hits":      results,
+		},
+	}
+}
+
+// count returns the number of documents matching the query.
+func (s *Server) count(expr string, body []byte, q map[string][]string) (int, interface{}) {
+	var req struct {
+		Query interface{} `json:"query"`
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, errBadRequest("parsing_exception", "failed to parse count request: %s", err)
+		}
+	}
+
+	hits, ferr := s.match(expr, req.Query)
+	if ferr != nil {
+		return 0, ferr
+	}
+	return 200, map[string]interface{}{"count": len(hits), "_shards": shards()}
+}
+
+// match returns the documents of the indices matching the query, in the order of creation.
+func (s *Server) match(expr string, query interface{}) ([]searchHit, *fakeError) {
+	names, ferr := s.resolve(expr)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	fn := matchAll
+	if query != nil {
+		if fn, ferr = compileQuery(query); ferr != nil {
+			return nil, ferr
+		}
+	}
+
+	var hits []searchHit
+	for _, name := range names {
+		idx := s.indices[name]
+		for _, id := range idx.order {
+			doc := idx.docs[id]
+			if ok, score := fn(doc); ok {
+				hits = append(hits, searchHit{index: name, doc: doc, score: score})
+			}
+		}
+	}
+	return hits, nil
+}
+
+func matchAll(*fakeDocument) (bool, float64) { return true, 1 }
+
+// compileQuery returns the function evaluating the query DSL clause.
+func compileQuery(query interface{}) (queryFunc, *fakeError) {
+	clause, ok := query.(map[string]interface{})
+	if !ok || len(clause) != 1 {
+		return nil, errBadRequest("parsing_exception", "query malformed, must start with a single query name")
+	}
+
+	var (
+		typ    string
+		params interface{}
+	)
+	for typ, params = range clause {
+	}
+
+	switch typ {
+	case "match_all":
+		return matchAll, nil
+	case "match_none":
+		return func(*fakeDocument) (bool, float64) { return false, 0 }, nil
+	case "bool":
+		return compileBool(params)
+	case "ids":
+		p, _ := params.(map[string]interface{})
+		values, _ := p["values"].([]interface{})
+		return func(doc *fakeDocument) (bool, float64) {
+			for _, v := range values {
+				if fmt.Sprint(v) == doc.id {
+					return true, 1
+				}
+			}
+			return false, 0
+		}, nil
+	case "exists":
+		p, _ := params.(map[string]interface{})
+		field, _ := p["field"].(string)
+		if field == "" {
+			return nil, errBadRequest("parsing_exception", "[exists] must be provided with a [field]")
+		}
+		return func(doc *fakeDocument) (bool, float64) {
+			return len(fieldValues(doc.fields, field)) > 0, 1
+		}, nil
+	}
+
+	if !leafQueries[typ] {
+		return nil, errBadRequest("parsing_exception", "unknown query [%s]", typ)
+	}
+
+	field, value, options, ferr := fieldParams(typ, params)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	switch typ {
+	case "term":
+		return func(doc *fakeDocument) (bool, float64) {
+			for _, v := range fieldValues(doc.fields, field) {
+				if equalValues(v, value) {
+					return true, 1
+				}
+			}
+			return false, 0
+		}, nil
+	case "terms":
+		values, ok := value.([]interface{})
+		if !ok {
+			return nil, errBadRequest("parsing_exception", "[terms] query requires an array of values")
+		}
+		return func(doc *fakeDocument) (bool, float64) {
+			for _, v := range fieldValues(doc.fields, field) {
+				for _, w := range values {
+					if equalValues(v, w) {
+						return true, 1
+					}
+				}
+			}
+			return false, 0
+		}, nil
+	case "prefix":
+		prefix := fmt.Sprint(value)
+		return func(doc *fakeDocument) (bool, float64) {
+			for _, v := range fieldValues(doc.fields, field) {
+				if str, ok := v.(string); ok && strings.HasPrefix(str, prefix) {
+					return true, 1
+				}
+			}
+			return false, 0
+		}, nil
+	case "match":
+		tokens := tokenize(fmt.Sprint(value))
+		and := strings.EqualFold(fmt.Sprint(options["operator"]), "and")
+		return func(doc *fakeDocument) (bool, float64) {
+			docTokens := make(map[string]bool)
+			for _, v := range fieldValues(doc.fields, field) {
+				for _, t := range tokenize(fmt.Sprint(v)) {
+					docTokens[t] = true
+				}
+			}
+			var matched int
+			for _, t := range tokens {
+				if docTokens[t] {
+					matched++
+				}
+			}
+			if matched == 0 || (and && matched < len(tokens)) {
+				return false, 0
+			}
+			return true, float64(matched)
+		}, nil
+	case "match_phrase":
+		phrase := strings.Join(tokenize(fmt.Sprint(value)), " ")
+		return func(doc *fakeDocument) (bool, float64) {
+			for _, v := range fieldValues(doc.fields, field) {
+				if strings.Contains(" "+strings.Join(tokenize(fmt.Sprint(v)), " ")+" ", " "+phrase+" ") {
+					return true, 1
+				}
+			}
+			return false, 0
+		}, nil
+	case "range":
+		return func(doc *fakeDocument) (bool, float64) {
+			for _, v := range fieldValues(doc.fields, field) {
+				if inRange(v, options) {
+					return true, 1
+				}
+			}
+			return false, 0
+		}, nil
+	}
+
+	return nil, errBadRequest("parsing_exception", "unknown query [%s]", typ)
+}
+
+// fieldParams returns the field and the value of a leaf query, eg. {"title": "foo"} or {"title": {"query": "foo"}}.
+func fieldParams(typ string, params interface{}) (string, interface{}, map[string]interface{}, *fakeError) {
+	p, ok := params.(map[string]interface{})
+	if !ok || len(p) == 0 {
+		return "", nil, nil, errBadRequest("parsing_exception", "[%s] query malformed, no field specified", typ)
+	}
+
+	for field, v := range p {
+		if typ == "terms" || typ == "range" {
+			options, _ := v.(map[string]interface{})
+			return field, v, options, nil
+		}
+		if options, ok := v.(map[string]interface{}); ok {
+			for _, key := range []string{"value", "query"} {
+				if value, ok := options[key]; ok {
+					return field, value, options, nil
+				}
+			}
+			return "", nil, nil, errBadRequest("parsing_exception", "[%s] query does not support the value for [%s]", typ, field)
+		}
+		return field, v, map[string]interface{}{}, nil
+	}
+	return "", nil, nil, nil
+}
+
+func compileBool(params interface{}) (queryFunc, *fakeError) {
+	p, ok := params.(map[string]interface{})
+	if !ok {
+		return nil, errBadRequest("parsing_exception", "[bool] query malformed")
+	}
+
+	clauses := make(map[string][]queryFunc)
+	for _, occur := range []string{"must", "filter", "should", "must_not"} {
+		v, ok := p[occur]
+		if !ok {
+			continue
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v}
+		}
+		for _, q := range list {
+			fn, ferr := compileQuery(q)
+			if ferr != nil {
+				return nil, ferr
+			}
+			clauses[occur] = append(clauses[occur], fn)
+		}
+	}
+
+	minShould := 0
+	if len(clauses["should"]) > 0 && len(clauses["must"]) == 0 && len(clauses["filter"]) == 0 {
+		minShould = 1
+	}
+	if v, ok := p["minimum_should_match"]; ok {
+		n, err := strconv.Atoi(fmt.Sprint(v))
+		if err != nil {
+			return nil, errBadRequest("parsing_exception", "unsupported [minimum_should_match] value [%v]", v)
+		}
+		minShould = n
+	}
+
+	return func(doc *fakeDocument) (bool, float64) {
+		var score float64
+		for _, fn := range clauses["must"] {
+			ok, s := fn(doc)
+			if !ok {
+				return false, 0
+			}
+			score += s
+		}
+		for _, fn := range clauses["filter"] {
+			if ok, _ := fn(doc); !ok {
+				return false, 0
+			}
+		}
+		for _, fn := range clauses["must_not"] {
+			if ok, _ := fn(doc); ok {
+				return false, 0
+			}
+		}
+		var should int
+		for _, fn := range clauses["should"] {
+			if ok, s := fn(doc); ok {
+				should++
+				score += s
+			}
+		}
+		if should < minShould {
+			return false, 0
+		}
+		if score == 0 {
+			score = 1
+		}
+		return true, score
+	}, nil
+}
+
+// fieldValues returns the values of the field, following the objects and arrays for dotted names.
+func fieldValues(fields map[string]interface{}, name string) []interface{} {
+	values := lookup(fields, name)
+	if len(values) == 0 && strings.HasSuffix(name, ".keyword") {
+		values = lookup(fields, strings.TrimSuffix(name, ".keyword"))
+	}
+	return values
+}
+
+func lookup(v interface{}, name string) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		var values []interface{}
+		for _, e := range v {
+			values = append(values, lookup(e, name)...)
+		}
+		return values
+	case map[string]interface{}:
+		if e, ok := v[name]; ok {
+			return flatten(e)
+		}
+		for i := strings.IndexByte(name, '.'); i >= 0; {
+			if e, ok := v[name[:i]]; ok {
+				if values := lookup(e, name[i+1:]); len(values) > 0 {
+					return values
+				}
+			}
+			next := strings.IndexByte(name[i+1:], '.')
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+	}
+	return nil
+}
+
+func flatten(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var values []interface{}
+		for _, e := range v {
+			values = append(values, flatten(e)...)
+		}
+		return values
+	default:
+		return []interface{}{v}
+	}
+}
+
+// equalValues compares a document value with a query value, eg. a number with its string form.
+func equalValues(a, b interface{}) bool {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return af == bf
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareValues returns -1, 0 or 1, comparing numbers numerically and other values as strings.
+func compareValues(a, b interface{}) int {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func inRange(v interface{}, bounds map[string]interface{}) bool {
+	for op, bound := range bounds {
+		c := compareValues(v, bound)
+		switch op {
+		case "gt":
+			if c <= 0 {
+				return false
+			}
+		case "gte":
+			if c < 0 {
+				return false
+			}
+		case "lt":
+			if c >= 0 {
+				return false
+			}
+		case "lte":
+			if c > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// tokenize returns the lowercased words of the text, like the standard analyzer.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// parseSort returns the sort fields from the sort parameter, eg. ["_score", {"date": "desc"}, {"id": {"order": "asc"}}].
+func parseSort(v interface{}) ([]sortField, *fakeError) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+
+	var fields []sortField
+	for _, spec := range list {
+		switch spec := spec.(type) {
+		case string:
+			fields = append(fields, sortField{field: spec, desc: spec == "_score"})
+		case map[string]interface{}:
+			for field, order := range spec {
+				if o, ok := order.(map[string]interface{}); ok {
+					order = o["order"]
+				}
+				fields = append(fields, sortField{field: field, desc: strings.EqualFold(fmt.Sprint(order), "desc")})
+			}
+		default:
+			return nil, errBadRequest("parsing_exception", "malformed sort [%v]", spec)
+		}
+	}
+	return fields, nil
+}
+
+// sortHits sorts the hits by the sort fields, or by descending score.
+func sortHits(hits []searchHit, fields []sortField) {
+	if len(fields) == 0 {
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+		return
+	}
+
+	for i := range hits {
+		for _, f := range fields {
+			var value interface{}
+			switch f.field {
+			case "_score":
+				value = hits[i].score
+			case "_doc":
+				value = hits[i].doc.seqNo
+			default:
+				if values := fieldValues(hits[i].doc.fields, f.field); len(values) > 0 {
+					value = values[0]
+				}
+			}
+			hits[i].sort = append(hits[i].sort, value)
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		for k, f := range fields {
+			a, b := hits[i].sort[k], hits[j].sort[k]
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				return false // Missing values last
+			case b == nil:
+				return true
+			}
+			c := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			if f.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
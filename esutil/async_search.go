@@ -0,0 +1,212 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	asyncdelete "github.com/elastic/go-elasticsearch/v8/typedapi/asyncsearch/delete"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/asyncsearch/get"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/asyncsearch/submit"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var (
+	defaultAsyncWaitForCompletionTimeout = time.Second
+	defaultAsyncMaxBackoff               = 5 * time.Second
+)
+
+// AsyncSearchConfig represents the configuration of an async search.
+type AsyncSearchConfig struct {
+	Client  elastictransport.Interface // The Elasticsearch client, eg. *elasticsearch.TypedClient.
+	Index   string                     // Comma-separated list of indices to search. Default: all.
+	Request *submit.Request            // The search request.
+
+	WaitForCompletionTimeout time.Duration                   // Duration of each request waiting for the results. Default: 1s.
+	Backoff                  func(attempt int) time.Duration // Delay between the requests. Default: exponential, up to 5s.
+	KeepAlive                time.Duration                   // Retention of the async search in the cluster. Default: 5d.
+
+	// Keep the async search in the cluster after the completion, to retrieve it later by ID.
+	// The async search is deleted on cancellation and errors regardless.
+	Keep bool
+
+	// Called with the partial results, when they improve, until the search completes.
+	OnPartialResult func(*AsyncSearchResult)
+}
+
+// AsyncSearchResult represents the results of an async search.
+type AsyncSearchResult struct {
+	ID        string            `json:"id"`
+	IsRunning bool              `json:"is_running"`
+	IsPartial bool              `json:"is_partial"`
+	Response  types.AsyncSearch `json:"response"`
+}
+
+// AsyncSearch submits the async search, polls until it completes, and returns the final results.
+//
+//	res, err := esutil.AsyncSearch(ctx, esutil.AsyncSearchConfig{
+//	  Client:  es,
+//	  Index:   "logs-*",
+//	  Request: &submit.Request{Aggregations: aggs},
+//	  OnPartialResult: func(res *esutil.AsyncSearchResult) {
+//	    log.Printf("Partial results: %d shards", res.Response.Shards_.Successful)
+//	  },
+//	})
+//
+// The requests use the wait_for_completion_timeout parameter, followed by the backoff delay.
+// The async search is deleted when it completes, unless Keep is set, and when the context
+// is cancelled or an error occurs, in which case the error is returned.
+func AsyncSearch(ctx context.Context, cfg AsyncSearchConfig) (*AsyncSearchResult, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("missing client")
+	}
+	wait := cfg.WaitForCompletionTimeout
+	if wait <= 0 {
+		wait = defaultAsyncWaitForCompletionTimeout
+	}
+	backoff := cfg.Backoff
+	if backoff == nil {
+		backoff = defaultAsyncBackoff
+	}
+
+	s := submit.New(cfg.Client).
+		WaitForCompletionTimeout(formatAsyncDuration(wait)).
+		KeepOnCompletion(cfg.Keep).
+		TypedKeys(true)
+	if cfg.Index != "" {
+		s.Index(cfg.Index)
+	}
+	if cfg.KeepAlive > 0 {
+		s.KeepAlive(formatAsyncDuration(cfg.KeepAlive))
+	}
+	if cfg.Request != nil {
+		s.Request(cfg.Request)
+	}
+
+	res, err := s.Perform(ctx)
+	result, err := decodeAsyncSearchResult(res, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		reducePhases int64
+		shards       uint
+	)
+	for attempt := 1; result.IsRunning; attempt++ {
+		if result.IsPartial && cfg.OnPartialResult != nil {
+			if rp := asyncReducePhases(result); rp > reducePhases || result.Response.Shards_.Successful > shards {
+				reducePhases, shards = rp, result.Response.Shards_.Successful
+				cfg.OnPartialResult(result)
+			}
+		}
+
+		timer := time.NewTimer(backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			deleteAsyncSearch(cfg.Client, result.ID)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		g := get.New(cfg.Client).Id(result.ID).WaitForCompletionTimeout(formatAsyncDuration(wait)).TypedKeys(true)
+		if cfg.KeepAlive > 0 {
+			g.KeepAlive(formatAsyncDuration(cfg.KeepAlive))
+		}
+		res, err := g.Perform(ctx)
+		next, err := decodeAsyncSearchResult(res, err)
+		if err != nil {
+			deleteAsyncSearch(cfg.Client, result.ID)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		result = next
+	}
+
+	if result.ID != "" && !cfg.Keep {
+		deleteAsyncSearch(cfg.Client, result.ID)
+	}
+
+	return result, nil
+}
+
+// decodeAsyncSearchResult decodes the response of the submit and get requests.
+//
+// The typed responses don't include the ID and the status of the search.
+func decodeAsyncSearchResult(res *http.Response, err error) (*AsyncSearchResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		e := types.NewElasticsearchError()
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+			return nil, fmt.Errorf("async search: %s", res.Status)
+		}
+		return nil, e
+	}
+
+	var result AsyncSearchResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("cannot decode the async search response: %s", err)
+	}
+	if result.IsRunning && result.ID == "" {
+		return nil, errors.New("missing ID of the running async search")
+	}
+	return &result, nil
+}
+
+// deleteAsyncSearch deletes the async search, ignoring the errors;
+// it's called when the context may be cancelled already.
+func deleteAsyncSearch(tp elastictransport.Interface, id string) {
+	if id == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	asyncdelete.New(tp).Id(id).Do(ctx)
+}
+
+func asyncReducePhases(result *AsyncSearchResult) int64 {
+	if result.Response.NumReducePhases == nil {
+		return 0
+	}
+	return *result.Response.NumReducePhases
+}
+
+func defaultAsyncBackoff(attempt int) time.Duration {
+	d := 100 * time.Millisecond << uint(attempt-1)
+	if d <= 0 || d > defaultAsyncMaxBackoff {
+		return defaultAsyncMaxBackoff
+	}
+	return d
+}
+
+func formatAsyncDuration(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/estest"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/asyncsearch/submit"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func asyncSearchBody(id string, running bool, reducePhases int, shards int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         id,
+		"is_running": running,
+		"is_partial": running,
+		"response": map[string]interface{}{
+			"took":              1,
+			"timed_out":         false,
+			"num_reduce_phases": reducePhases,
+			"_shards":           map[string]interface{}{"total": 3, "successful": shards, "failed": 0, "skipped": 0},
+			"hits":              map[string]interface{}{"total": map[string]interface{}{"value": shards * 10, "relation": "eq"}, "hits": []interface{}{}},
+		},
+	}
+}
+
+func noAsyncBackoff(int) time.Duration { return time.Millisecond }
+
+func TestAsyncSearch(t *testing.T) {
+	t.Run("Partial results", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/logs/_async_search").
+			WithQuery("wait_for_completion_timeout", "1000ms").
+			WithQuery("keep_on_completion", "false").
+			WithBody(map[string]interface{}{"size": 0}).
+			Respond(200, asyncSearchBody("abc", true, 1, 1))
+		mock.Expect("GET", "/_async_search/abc").Respond(200, asyncSearchBody("abc", true, 1, 1))
+		mock.Expect("GET", "/_async_search/abc").Respond(200, asyncSearchBody("abc", true, 2, 2))
+		mock.Expect("GET", "/_async_search/abc").Respond(200, asyncSearchBody("abc", false, 3, 3))
+		mock.Expect("DELETE", "/_async_search/abc").Respond(200, map[string]interface{}{"acknowledged": true})
+
+		size := 0
+		var partial []uint
+		res, err := AsyncSearch(context.Background(), AsyncSearchConfig{
+			Client:  mock,
+			Index:   "logs",
+			Request: &submit.Request{Size: &size},
+			Backoff: noAsyncBackoff,
+			OnPartialResult: func(res *AsyncSearchResult) {
+				partial = append(partial, res.Response.Shards_.Successful)
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.IsRunning || res.IsPartial || res.Response.Shards_.Successful != 3 {
+			t.Errorf("Unexpected result: %+v", res)
+		}
+		if len(partial) != 2 || partial[0] != 1 || partial[1] != 2 {
+			t.Errorf("Unexpected partial results: %v", partial)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Completed immediately", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_async_search").Respond(200, asyncSearchBody("", false, 1, 3))
+
+		res, err := AsyncSearch(context.Background(), AsyncSearchConfig{Client: mock})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Response.Hits.Total.Value != 30 {
+			t.Errorf("Unexpected total: %+v", res.Response.Hits.Total)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Keep", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_async_search").
+			WithQuery("keep_on_completion", "true").
+			WithQuery("keep_alive", "60000ms").
+			Respond(200, asyncSearchBody("abc", true, 1, 1))
+		mock.Expect("GET", "/_async_search/abc").
+			WithQuery("keep_alive", "60000ms").
+			Respond(200, asyncSearchBody("abc", false, 1, 3))
+
+		res, err := AsyncSearch(context.Background(), AsyncSearchConfig{
+			Client:    mock,
+			Keep:      true,
+			KeepAlive: time.Minute,
+			Backoff:   noAsyncBackoff,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.ID != "abc" {
+			t.Errorf("Unexpected ID: %q", res.ID)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Cancellation", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_async_search").Respond(200, asyncSearchBody("abc", true, 1, 1))
+		mock.Expect("DELETE", "/_async_search/abc").Respond(200, map[string]interface{}{"acknowledged": true})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := AsyncSearch(ctx, AsyncSearchConfig{
+			Client:          mock,
+			Backoff:         func(int) time.Duration { return time.Hour },
+			OnPartialResult: func(*AsyncSearchResult) { cancel() },
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got: %v", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/_async_search").Respond(200, asyncSearchBody("abc", true, 1, 1))
+		mock.Expect("GET", "/_async_search/abc").RespondError(404, "resource_not_found_exception", "abc")
+		mock.Expect("DELETE", "/_async_search/abc").RespondError(404, "resource_not_found_exception", "abc")
+
+		_, err := AsyncSearch(context.Background(), AsyncSearchConfig{Client: mock, Backoff: noAsyncBackoff})
+		var e *types.ElasticsearchError
+		if !errors.As(err, &e) || e.Status != 404 || e.ErrorCause.Type != "resource_not_found_exception" {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: 5 * time.Second, 100: 5 * time.Second} {
+			if d := defaultAsyncBackoff(attempt); d != want {
+				t.Errorf("Unexpected backoff for attempt %d: %s", attempt, d)
+			}
+		}
+	})
+}
@@ -0,0 +1,575 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/cluster/getcomponenttemplate"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/cluster/putcomponenttemplate"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/ilm/getlifecycle"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/ilm/putlifecycle"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/create"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/existsalias"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/getindextemplate"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/putindextemplate"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/ingest/getpipeline"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/ingest/putpipeline"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// The kinds of resources created by Bootstrap, in the order of creation.
+const (
+	LifecyclePolicyResource   = "lifecycle_policy"
+	PipelineResource          = "pipeline"
+	ComponentTemplateResource = "component_template"
+	IndexTemplateResource     = "index_template"
+	WriteAliasResource        = "write_alias"
+)
+
+// The operations of the bootstrap plan.
+const (
+	BootstrapCreate = "create"
+	BootstrapUpdate = "update"
+)
+
+// Bundle represents the resources to create with Bootstrap, by name.
+//
+// The values are the bodies of the create requests: the typed requests,
+// eg. *putindextemplate.Request, maps, or JSON as json.RawMessage.
+type Bundle struct {
+	LifecyclePolicies  map[string]interface{} `json:"lifecycle_policies,omitempty"`
+	Pipelines          map[string]interface{} `json:"pipelines,omitempty"`
+	ComponentTemplates map[string]interface{} `json:"component_templates,omitempty"`
+	IndexTemplates     map[string]interface{} `json:"index_templates,omitempty"`
+	WriteAliases       map[string]WriteAlias  `json:"write_aliases,omitempty"`
+}
+
+// WriteAlias represents an alias to create with its initial write index,
+// eg. for rollover, when the alias doesn't exist.
+type WriteAlias struct {
+	Index string      `json:"index"`          // The initial index, eg. "logs-000001".
+	Body  interface{} `json:"body,omitempty"` // The body of the create index request.
+}
+
+// ReadBundle reads the bundle in JSON:
+//
+//	{
+//	  "lifecycle_policies":  { "logs": { "policy": { "phases": { ... } } } },
+//	  "pipelines":           { "logs": { "processors": [ ... ] } },
+//	  "component_templates": { "logs-mappings": { "template": { "mappings": { ... } } } },
+//	  "index_templates":     { "logs": { "index_patterns": ["logs-*"], "composed_of": ["logs-mappings"] } },
+//	  "write_aliases":       { "logs": { "index": "logs-000001" } }
+//	}
+//
+// To use YAML, convert it to JSON first, eg. with sigs.k8s.io/yaml.YAMLToJSON, or load
+// the files with BundleLoader.
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	var b Bundle
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("cannot decode the bundle: %s", err)
+	}
+	return &b, nil
+}
+
+// LoadBundle reads the bundles from the JSON files, and merges them.
+//
+// The resources of the later files replace the resources with the same name.
+func LoadBundle(paths ...string) (*Bundle, error) {
+	return BundleLoader{}.Load(paths...)
+}
+
+// BundleLoader loads the bundles from files.
+type BundleLoader struct {
+	// Optional function converting the YAML files, with the .yml or .yaml extension,
+	// to JSON, eg. sigs.k8s.io/yaml.YAMLToJSON. Default: nil, YAML files are rejected.
+	YAMLToJSON func([]byte) ([]byte, error)
+}
+
+// Load reads the bundles from the files, and merges them.
+//
+// The resources of the later files replace the resources with the same name.
+func (l BundleLoader) Load(paths ...string) (*Bundle, error) {
+	var bundle Bundle
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yml", ".yaml":
+			if l.YAMLToJSON == nil {
+				return nil, fmt.Errorf("cannot load %s: YAML bundles must be converted to JSON", path)
+			}
+			if data, err = l.YAMLToJSON(data); err != nil {
+				return nil, fmt.Errorf("%s: cannot convert the bundle to JSON: %s", path, err)
+			}
+		}
+
+		b, err := ReadBundle(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		bundle.merge(b)
+	}
+	return &bundle, nil
+}
+
+func (b *Bundle) merge(other *Bundle) {
+	mergeResources(&b.LifecyclePolicies, other.LifecyclePolicies)
+	mergeResources(&b.Pipelines, other.Pipelines)
+	mergeResources(&b.ComponentTemplates, other.ComponentTemplates)
+	mergeResources(&b.IndexTemplates, other.IndexTemplates)
+	for name, alias := range other.WriteAliases {
+		if b.WriteAliases == nil {
+			b.WriteAliases = make(map[string]WriteAlias)
+		}
+		b.WriteAliases[name] = alias
+	}
+}
+
+func mergeResources(dst *map[string]interface{}, src map[string]interface{}) {
+	for name, v := range src {
+		if *dst == nil {
+			*dst = make(map[string]interface{})
+		}
+		(*dst)[name] = v
+	}
+}
+
+// BootstrapConfig represents the configuration of Bootstrap.
+type BootstrapConfig struct {
+	Client elastictransport.Interface // The Elasticsearch client, eg. *elasticsearch.TypedClient.
+	Bundle *Bundle                    // The resources to create.
+
+	// Return the plan without applying it.
+	DryRun bool
+}
+
+// BootstrapAction represents the creation or the update of a resource.
+type BootstrapAction struct {
+	Resource string          // The kind of resource, eg. IndexTemplateResource.
+	Name     string          // The name of the resource.
+	Op       string          // BootstrapCreate or BootstrapUpdate.
+	Diff     []string        // The differences with the existing resource.
+	Body     json.RawMessage // The body of the request.
+
+	index string // The index created for write aliases
+}
+
+// BootstrapPlan represents the actions of Bootstrap, in the order of execution.
+type BootstrapPlan []BootstrapAction
+
+// String returns the actions, one per line, with the differences.
+func (p BootstrapPlan) String() string {
+	var b strings.Builder
+	for _, a := range p {
+		fmt.Fprintf(&b, "%s %s %q\n", a.Op, a.Resource, a.Name)
+		for _, d := range a.Diff {
+			fmt.Fprintf(&b, "  %s\n", d)
+		}
+	}
+	return b.String()
+}
+
+// Bootstrap compares the bundle with the cluster, and creates or updates the resources
+// which are missing or different, in the order of dependencies: lifecycle policies,
+// pipelines, component templates, index templates, and write aliases.
+//
+//	plan, err := esutil.Bootstrap(ctx, esutil.BootstrapConfig{Client: es, Bundle: bundle})
+//	if err != nil {
+//	  log.Fatalf("Error: %s, applied:\n%s", err, plan)
+//	}
+//
+// The resources are compared with the existing ones leniently: only the fields of the bundle
+// are compared, and values such as 1 and "1", the settings with or without the "index."
+// prefix, or the index patterns and the component templates in any order, are equal.
+// The write aliases are created with their initial index when they don't exist,
+// and they are not updated.
+//
+// The plan contains the actions, or the actions applied before the error. In dry-run mode,
+// the plan is returned without applying it.
+func Bootstrap(ctx context.Context, cfg BootstrapConfig) (BootstrapPlan, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("missing client")
+	}
+	if cfg.Bundle == nil {
+		return nil, errors.New("missing bundle")
+	}
+
+	plan, err := planBootstrap(ctx, cfg.Client, cfg.Bundle)
+	if err != nil || cfg.DryRun {
+		return plan, err
+	}
+
+	for i, a := range plan {
+		if err := applyBootstrapAction(ctx, cfg.Client, a); err != nil {
+			return plan[:i], fmt.Errorf("cannot %s %s %q: %w", a.Op, a.Resource, a.Name, err)
+		}
+	}
+	return plan, nil
+}
+
+func planBootstrap(ctx context.Context, tp elastictransport.Interface, bundle *Bundle) (BootstrapPlan, error) {
+	var plan BootstrapPlan
+
+	resources := []struct {
+		kind   string
+		values map[string]interface{}
+	}{
+		{LifecyclePolicyResource, bundle.LifecyclePolicies},
+		{PipelineResource, bundle.Pipelines},
+		{ComponentTemplateResource, bundle.ComponentTemplates},
+		{IndexTemplateResource, bundle.IndexTemplates},
+	}
+	for _, r := range resources {
+		for _, name := range sortedKeys(r.values) {
+			body, err := json.Marshal(r.values[name])
+			if err != nil {
+				return plan, fmt.Errorf("cannot encode %s %q: %s", r.kind, name, err)
+			}
+			desired, err := decodeJSONValue(body)
+			if err != nil {
+				return plan, fmt.Errorf("cannot encode %s %q: %s", r.kind, name, err)
+			}
+
+			actual, err := getBootstrapResource(ctx, tp, r.kind, name)
+			if err != nil {
+				return plan, fmt.Errorf("cannot get %s %q: %w", r.kind, name, err)
+			}
+
+			a := BootstrapAction{Resource: r.kind, Name: name, Op: BootstrapCreate, Body: body}
+			if actual != nil {
+				if a.Diff = diffJSON("", desired, actual); len(a.Diff) == 0 {
+					continue
+				}
+				a.Op = BootstrapUpdate
+			}
+			plan = append(plan, a)
+		}
+	}
+
+	names := make([]string, 0, len(bundle.WriteAliases))
+	for name := range bundle.WriteAliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		alias := bundle.WriteAliases[name]
+		if alias.Index == "" {
+			return plan, fmt.Errorf("missing index for write alias %q", name)
+		}
+
+		res, err := existsalias.New(tp).Name(name).Perform(ctx)
+		if err != nil {
+			return plan, fmt.Errorf("cannot get %s %q: %w", WriteAliasResource, name, err)
+		}
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK {
+			continue
+		}
+		if res.StatusCode != http.StatusNotFound {
+			return plan, fmt.Errorf("cannot get %s %q: %s", WriteAliasResource, name, res.Status)
+		}
+
+		body, err := writeAliasBody(name, alias)
+		if err != nil {
+			return plan, fmt.Errorf("cannot encode %s %q: %s", WriteAliasResource, name, err)
+		}
+		plan = append(plan, BootstrapAction{
+			Resource: WriteAliasResource,
+			Name:     name,
+			Op:       BootstrapCreate,
+			Diff:     []string{"index: " + alias.Index},
+			Body:     body,
+			index:    alias.Index,
+		})
+	}
+
+	return plan, nil
+}
+
+// getBootstrapResource returns the existing resource, in the format of the request body, or nil.
+func getBootstrapResource(ctx context.Context, tp elastictransport.Interface, kind, name string) (interface{}, error) {
+	var (
+		res *http.Response
+		err error
+	)
+	switch kind {
+	case LifecyclePolicyResource:
+		res, err = getlifecycle.New(tp).Policy(name).Perform(ctx)
+	case PipelineResource:
+		res, err = getpipeline.New(tp).Id(name).Perform(ctx)
+	case ComponentTemplateResource:
+		res, err = getcomponenttemplate.New(tp).Name(name).FlatSettings(true).Perform(ctx)
+	case IndexTemplateResource:
+		res, err = getindextemplate.New(tp).Name(name).FlatSettings(true).Perform(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode > 299 {
+		e := types.NewElasticsearchError()
+		if err := json.Unmarshal(body, e); err != nil {
+			return nil, fmt.Errorf("%s", res.Status)
+		}
+		return nil, e
+	}
+
+	v, err := decodeJSONValue(body)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := v.(map[string]interface{})
+
+	switch kind {
+	case LifecyclePolicyResource, PipelineResource:
+		return m[name], nil
+	case ComponentTemplateResource:
+		return findNamedTemplate(m["component_templates"], name, "component_template"), nil
+	default:
+		return findNamedTemplate(m["index_templates"], name, "index_template"), nil
+	}
+}
+
+func findNamedTemplate(v interface{}, name, key string) interface{} {
+	templates, _ := v.([]interface{})
+	for _, t := range templates {
+		if m, ok := t.(map[string]interface{}); ok && m["name"] == name {
+			return m[key]
+		}
+	}
+	return nil
+}
+
+func applyBootstrapAction(ctx context.Context, tp elastictransport.Interface, a BootstrapAction) error {
+	var (
+		res  *http.Response
+		err  error
+		body = bytes.NewReader(a.Body)
+	)
+	switch a.Resource {
+	case LifecyclePolicyResource:
+		res, err = putlifecycle.New(tp).Policy(a.Name).Raw(body).Perform(ctx)
+	case PipelineResource:
+		res, err = putpipeline.New(tp).Id(a.Name).Raw(body).Perform(ctx)
+	case ComponentTemplateResource:
+		res, err = putcomponenttemplate.New(tp).Name(a.Name).Raw(body).Perform(ctx)
+	case IndexTemplateResource:
+		res, err = putindextemplate.New(tp).Name(a.Name).Raw(body).Perform(ctx)
+	case WriteAliasResource:
+		res, err = create.New(tp).Index(a.index).Raw(body).Perform(ctx)
+	default:
+		return fmt.Errorf("unknown resource %q", a.Resource)
+	}
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		e := types.NewElasticsearchError()
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+			return fmt.Errorf("%s", res.Status)
+		}
+		return e
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+// writeAliasBody returns the body of the create index request, with the write alias.
+func writeAliasBody(name string, alias WriteAlias) (json.RawMessage, error) {
+	body := make(map[string]interface{})
+	if alias.Body != nil {
+		b, err := json.Marshal(alias.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &body); err != nil {
+			return nil, err
+		}
+	}
+	aliases, _ := body["aliases"].(map[string]interface{})
+	if aliases == nil {
+		aliases = make(map[string]interface{})
+	}
+	aliases[name] = map[string]interface{}{"is_write_index": true}
+	body["aliases"] = aliases
+	return json.Marshal(body)
+}
+
+func decodeJSONValue(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// diffJSON returns the differences of the fields of desired with actual.
+//
+// The fields missing in desired, null values and empty objects are ignored;
+// scalars are compared as strings; the settings are compared flattened,
+// with the "index." prefix; the set-like arrays, see setFields, are compared sorted.
+func diffJSON(path string, desired, actual interface{}) []string {
+	var diffs []string
+	switch d := desired.(type) {
+	case nil:
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			if len(d) > 0 {
+				diffs = append(diffs, fmt.Sprintf("%s: %s != %s", jsonPath(path), jsonString(d), jsonString(actual)))
+			}
+			return diffs
+		}
+		for _, k := range sortedKeys(d) {
+			if k == "settings" {
+				diffs = append(diffs, diffJSON(jsonPath(path, k), flattenSettings(d[k]), flattenSettings(a[k]))...)
+				continue
+			}
+			if setFields[k] {
+				diffs = append(diffs, diffJSON(jsonPath(path, k), sortedValues(d[k]), sortedValues(a[k]))...)
+				continue
+			}
+			diffs = append(diffs, diffJSON(jsonPath(path, k), d[k], a[k])...)
+		}
+	case []interface{}:
+		a, _ := actual.([]interface{})
+		if len(d) != len(a) {
+			diffs = append(diffs, fmt.Sprintf("%s: %s != %s", jsonPath(path), jsonString(d), jsonString(actual)))
+			return diffs
+		}
+		for i := range d {
+			diffs = append(diffs, diffJSON(fmt.Sprintf("%s[%d]", jsonPath(path), i), d[i], a[i])...)
+		}
+	default:
+		if actual == nil || fmt.Sprint(d) != fmt.Sprint(actual) {
+			diffs = append(diffs, fmt.Sprintf("%s: %s != %s", jsonPath(path), jsonString(d), jsonString(actual)))
+		}
+	}
+	return diffs
+}
+
+// setFields are the fields with arrays of unordered values.
+var setFields = map[string]bool{
+	"index_patterns": true,
+	"composed_of":    true,
+}
+
+// sortedValues returns a sorted copy of the array, or an array with the value for a string,
+// eg. for a single index pattern.
+func sortedValues(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case string:
+		return []interface{}{vv}
+	case []interface{}:
+		sorted := make([]interface{}, len(vv))
+		copy(sorted, vv)
+		sort.SliceStable(sorted, func(i, j int) bool { return jsonString(sorted[i]) < jsonString(sorted[j]) })
+		return sorted
+	default:
+		return v
+	}
+}
+
+// flattenSettings returns the settings with the dotted keys, prefixed with "index.".
+func flattenSettings(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	flat := make(map[string]interface{})
+	var flatten func(prefix string, m map[string]interface{})
+	flatten = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if vm, ok := v.(map[string]interface{}); ok {
+				flatten(prefix+k+".", vm)
+				continue
+			}
+			key := prefix + k
+			if !strings.HasPrefix(key, "index.") {
+				key = "index." + key
+			}
+			flat[key] = v
+		}
+	}
+	flatten("", m)
+	return flat
+}
+
+func jsonPath(path string, keys ...string) string {
+	for _, k := range keys {
+		if path != "" {
+			path += "."
+		}
+		path += k
+	}
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+func jsonString(v interface{}) string {
+	if v == nil {
+		return "<missing>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
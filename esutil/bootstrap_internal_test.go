@@ -0,0 +1,237 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/estest"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/putindextemplate"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestBootstrap(t *testing.T) {
+	priority := 100
+	bundle := &Bundle{
+		LifecyclePolicies: map[string]interface{}{
+			"logs": json.RawMessage(`{"policy":{"phases":{"hot":{"actions":{"rollover":{"max_age":"1d"}}}}}}`),
+		},
+		Pipelines: map[string]interface{}{
+			"logs": map[string]interface{}{"processors": []interface{}{map[string]interface{}{"lowercase": map[string]interface{}{"field": "level"}}}},
+		},
+		ComponentTemplates: map[string]interface{}{
+			"logs-settings": map[string]interface{}{"template": map[string]interface{}{"settings": map[string]interface{}{"number_of_shards": 2, "index.lifecycle.name": "logs"}}},
+		},
+		IndexTemplates: map[string]interface{}{
+			"logs": &putindextemplate.Request{IndexPatterns: []string{"logs-*"}, ComposedOf: []string{"logs-settings"}, Priority: &priority},
+		},
+		WriteAliases: map[string]WriteAlias{
+			"logs": {Index: "logs-000001"},
+		},
+	}
+
+	expectGets := func(mock *estest.MockTransport) {
+		mock.Expect("GET", "/_ilm/policy/logs").RespondError(404, "resource_not_found_exception", "Lifecycle policy not found: logs")
+		mock.Expect("GET", "/_ingest/pipeline/logs").Respond(200, map[string]interface{}{
+			"logs": map[string]interface{}{"processors": []interface{}{map[string]interface{}{"lowercase": map[string]interface{}{"field": "level"}}}},
+		})
+		mock.Expect("GET", "/_component_template/logs-settings").
+			WithQuery("flat_settings", "true").
+			Respond(200, map[string]interface{}{"component_templates": []interface{}{map[string]interface{}{
+				"name": "logs-settings",
+				"component_template": map[string]interface{}{"template": map[string]interface{}{
+					"settings": map[string]interface{}{"index.number_of_shards": "1", "index.lifecycle.name": "logs"},
+				}},
+			}}})
+		mock.Expect("GET", "/_index_template/logs").
+			Respond(200, map[string]interface{}{"index_templates": []interface{}{map[string]interface{}{
+				"name": "logs",
+				"index_template": map[string]interface{}{
+					"index_patterns": []string{"logs-*"},
+					"composed_of":    []string{"logs-settings"},
+					"priority":       100,
+					"template":       map[string]interface{}{},
+				},
+			}}})
+		mock.Expect("HEAD", "/_alias/logs").Respond(404, nil)
+	}
+
+	t.Run("Dry run", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		expectGets(mock)
+
+		plan, err := Bootstrap(context.Background(), BootstrapConfig{Client: mock, Bundle: bundle, DryRun: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		var actions []string
+		for _, a := range plan {
+			actions = append(actions, a.Op+" "+a.Resource+" "+a.Name)
+		}
+		expected := []string{"create lifecycle_policy logs", "update component_template logs-settings", "create write_alias logs"}
+		if !reflect.DeepEqual(actions, expected) {
+			t.Errorf("Unexpected plan: %v", actions)
+		}
+		if !reflect.DeepEqual(plan[1].Diff, []string{`template.settings.index.number_of_shards: 2 != "1"`}) {
+			t.Errorf("Unexpected diff: %q", plan[1].Diff)
+		}
+		if !strings.Contains(plan.String(), "update component_template \"logs-settings\"\n  template.settings") {
+			t.Errorf("Unexpected plan output:\n%s", plan)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		expectGets(mock)
+		mock.Expect("PUT", "/_ilm/policy/logs").
+			WithBody(map[string]interface{}{"policy": map[string]interface{}{"phases": map[string]interface{}{"hot": map[string]interface{}{"actions": map[string]interface{}{"rollover": map[string]interface{}{"max_age": "1d"}}}}}}).
+			Respond(200, map[string]interface{}{"acknowledged": true})
+		mock.Expect("PUT", "/_component_template/logs-settings").
+			Respond(200, map[string]interface{}{"acknowledged": true})
+		mock.Expect("PUT", "/logs-000001").
+			WithBody(map[string]interface{}{"aliases": map[string]interface{}{"logs": map[string]interface{}{"is_write_index": true}}}).
+			Respond(200, map[string]interface{}{"acknowledged": true})
+
+		plan, err := Bootstrap(context.Background(), BootstrapConfig{Client: mock, Bundle: bundle})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(plan) != 3 {
+			t.Errorf("Unexpected plan: %s", plan)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Apply error", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		expectGets(mock)
+		mock.Expect("PUT", "/_ilm/policy/logs").Respond(200, map[string]interface{}{"acknowledged": true})
+		mock.Expect("PUT", "/_component_template/logs-settings").RespondError(400, "illegal_argument_exception", "invalid setting")
+
+		plan, err := Bootstrap(context.Background(), BootstrapConfig{Client: mock, Bundle: bundle})
+		var e *types.ElasticsearchError
+		if !errors.As(err, &e) || e.ErrorCause.Type != "illegal_argument_exception" {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(err.Error(), `cannot update component_template "logs-settings"`) {
+			t.Errorf("Unexpected error message: %s", err)
+		}
+		if len(plan) != 1 || plan[0].Resource != LifecyclePolicyResource {
+			t.Errorf("Expected the applied actions, got: %s", plan)
+		}
+		mock.AssertExpectations(t)
+	})
+}
+
+func TestLoadBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.json": `{"pipelines": {"logs": {"processors": []}, "metrics": {"processors": []}}, "write_aliases": {"logs": {"index": "logs-000001"}}}`,
+		"b.json": `{"pipelines": {"logs": {"description": "Logs", "processors": []}}}`,
+		"c.json": `{"pipeline": {}}`,
+		"d.yml":  `pipelines: {logs: {processors: []}}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundle, err := LoadBundle(filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(bundle.Pipelines) != 2 || bundle.WriteAliases["logs"].Index != "logs-000001" {
+		t.Errorf("Unexpected bundle: %+v", bundle)
+	}
+	if p, _ := bundle.Pipelines["logs"].(map[string]interface{}); p["description"] != "Logs" {
+		t.Errorf("Expected the later file to replace the pipeline, got: %v", bundle.Pipelines["logs"])
+	}
+
+	if _, err := LoadBundle(filepath.Join(dir, "c.json")); err == nil || !strings.Contains(err.Error(), "unknown field") {
+		t.Errorf("Expected error for unknown field, got: %v", err)
+	}
+	if _, err := LoadBundle(filepath.Join(dir, "d.yml")); err == nil || !strings.Contains(err.Error(), "YAML") {
+		t.Errorf("Expected error for YAML, got: %v", err)
+	}
+
+	loader := BundleLoader{YAMLToJSON: func(data []byte) ([]byte, error) {
+		if string(data) != files["d.yml"] {
+			return nil, fmt.Errorf("unexpected YAML: %s", data)
+		}
+		return []byte(`{"pipelines": {"logs": {"processors": []}}}`), nil
+	}}
+	bundle, err = loader.Load(filepath.Join(dir, "a.json"), filepath.Join(dir, "d.yml"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(bundle.Pipelines) != 2 || bundle.Pipelines["logs"].(map[string]interface{})["description"] != nil {
+		t.Errorf("Expected the YAML file to replace the pipeline, got: %+v", bundle.Pipelines)
+	}
+
+	loader.YAMLToJSON = func([]byte) ([]byte, error) { return nil, errors.New("invalid YAML") }
+	if _, err := loader.Load(filepath.Join(dir, "d.yml")); err == nil || !strings.Contains(err.Error(), "invalid YAML") {
+		t.Errorf("Expected error for invalid YAML, got: %v", err)
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	var tt = []struct {
+		desired  string
+		actual   string
+		expected []string
+	}{
+		{`{"a": 1, "b": null, "c": {}}`, `{"a": "1", "d": true}`, nil},
+		{`{"a": [1, 2]}`, `{"a": [1]}`, []string{"a: [1,2] != [1]"}},
+		{`{"a": {"b": true}}`, `{"a": {"b": false}}`, []string{"a.b: true != false"}},
+		{`{"a": "x"}`, `{}`, []string{`a: "x" != <missing>`}},
+		{`{"settings": {"index": {"refresh_interval": "1s"}}}`, `{"settings": {"index.refresh_interval": "1s"}}`, nil},
+		{`{"settings": {"refresh_interval": "1s"}}`, `{"settings": {"index": {"refresh_interval": "5s"}}}`, []string{`settings.index.refresh_interval: "1s" != "5s"`}},
+		{`{"index_patterns": ["b-*", "a-*"], "composed_of": ["x", "y"]}`, `{"index_patterns": ["a-*", "b-*"], "composed_of": ["y", "x"]}`, nil},
+		{`{"index_patterns": "a-*"}`, `{"index_patterns": ["a-*"]}`, nil},
+		{`{"index_patterns": ["a-*", "c-*"]}`, `{"index_patterns": ["b-*", "a-*"]}`, []string{`index_patterns[1]: "c-*" != "b-*"`}},
+		{`{"processors": ["a", "b"]}`, `{"processors": ["b", "a"]}`, []string{`processors[0]: "a" != "b"`, `processors[1]: "b" != "a"`}},
+	}
+
+	for _, tc := range tt {
+		desired, _ := decodeJSONValue([]byte(tc.desired))
+		actual, _ := decodeJSONValue([]byte(tc.actual))
+		if diff := diffJSON("", desired, actual); !reflect.DeepEqual(diff, tc.expected) {
+			t.Errorf("Unexpected diff for %s and %s: %q", tc.desired, tc.actual, diff)
+		}
+	}
+}
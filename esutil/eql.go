@@ -0,0 +1,279 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	eqldelete "github.com/elastic/go-elasticsearch/v8/typedapi/eql/delete"
+	eqlget "github.com/elastic/go-elasticsearch/v8/typedapi/eql/get"
+	eqlsearch "github.com/elastic/go-elasticsearch/v8/typedapi/eql/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// ErrPartialResults is returned, together with the results, when the search
+// is partial or timed out, and partial results are not allowed.
+var ErrPartialResults = errors.New("partial results")
+
+// EQLConfig represents the configuration of an EQL search.
+type EQLConfig struct {
+	Client  elastictransport.Interface // The Elasticsearch client, eg. *elasticsearch.TypedClient.
+	Index   string                     // Comma-separated list of indices to search.
+	Request *eqlsearch.Request         // The EQL search request.
+
+	// Run the search asynchronously, and poll until it completes.
+	Async bool
+
+	Timeout                  time.Duration                   // Timeout of the whole search, in both modes. Default: none.
+	WaitForCompletionTimeout time.Duration                   // Duration of each async request waiting for the results. Default: 1s.
+	Backoff                  func(attempt int) time.Duration // Delay between the async requests. Default: exponential, up to 5s.
+	KeepAlive                time.Duration                   // Retention of the async search in the cluster. Default: 5d.
+	Keep                     bool                            // Keep the async search in the cluster after the completion.
+
+	// Return the partial or timed out results without ErrPartialResults.
+	AllowPartialResults bool
+}
+
+// EQLResult represents the results of an EQL search.
+type EQLResult struct {
+	ID        string // Identifier of the async search, when kept in the cluster.
+	IsPartial bool
+	TimedOut  bool
+	Took      time.Duration
+	Total     *types.TotalHits
+
+	Events    []EQLEvent
+	Sequences []EQLSequence
+}
+
+// EQLEvent represents a matching event.
+type EQLEvent struct {
+	Index  string
+	ID     string
+	Source json.RawMessage
+	Fields map[string][]json.RawMessage
+}
+
+// EQLSequence represents a matching sequence of events.
+type EQLSequence struct {
+	Events   []EQLEvent
+	JoinKeys []interface{} // Values of the "by" fields shared by the events.
+}
+
+// Decode decodes the source of the event into v.
+func (e EQLEvent) Decode(v interface{}) error {
+	if len(e.Source) == 0 {
+		return errors.New("missing event source")
+	}
+	return json.Unmarshal(e.Source, v)
+}
+
+// EachEvent calls fn for the events of the results, and then for the events
+// of each sequence, with the position of the event in the sequence.
+//
+// Iteration stops at the first error, which is returned.
+func (r *EQLResult) EachEvent(fn func(seq int, pos int, e EQLEvent) error) error {
+	for i, e := range r.Events {
+		if err := fn(-1, i, e); err != nil {
+			return err
+		}
+	}
+	for s, seq := range r.Sequences {
+		for i, e := range seq.Events {
+			if err := fn(s, i, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EQLSearch runs the EQL search and returns the results.
+//
+//	res, err := esutil.EQLSearch(ctx, esutil.EQLConfig{
+//	  Client:  es,
+//	  Index:   "logs-*",
+//	  Request: &search.Request{Query: `sequence by user.name [process where true] [file where true]`},
+//	  Async:   true,
+//	})
+//	for _, seq := range res.Sequences {
+//	  log.Printf("%v: %d events", seq.JoinKeys, len(seq.Events))
+//	}
+//
+// The Timeout applies to the synchronous request, or to the polling of the async search,
+// which is deleted when the timeout expires or the context is cancelled, and when it completes,
+// unless Keep is set.
+//
+// When the results are partial or timed out on the server, they are returned with ErrPartialResults,
+// unless AllowPartialResults is set.
+func EQLSearch(ctx context.Context, cfg EQLConfig) (*EQLResult, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("missing client")
+	}
+	if cfg.Index == "" {
+		return nil, errors.New("missing index")
+	}
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	s := eqlsearch.New(cfg.Client).Index(cfg.Index)
+	if cfg.Request != nil {
+		s.Request(cfg.Request)
+	}
+
+	var (
+		res *eqlsearch.Response
+		err error
+	)
+	if cfg.Async {
+		res, err = eqlSearchAsync(ctx, cfg, s)
+	} else {
+		res, err = s.Do(ctx)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	result, err := newEQLResult(res)
+	if err != nil {
+		return nil, err
+	}
+	if (result.IsPartial || result.TimedOut) && !cfg.AllowPartialResults {
+		return result, ErrPartialResults
+	}
+	return result, nil
+}
+
+// eqlSearchAsync submits the async search and polls until it completes.
+func eqlSearchAsync(ctx context.Context, cfg EQLConfig, s *eqlsearch.Search) (*eqlsearch.Response, error) {
+	wait := cfg.WaitForCompletionTimeout
+	if wait <= 0 {
+		wait = defaultAsyncWaitForCompletionTimeout
+	}
+	backoff := cfg.Backoff
+	if backoff == nil {
+		backoff = defaultAsyncBackoff
+	}
+
+	s.WaitForCompletionTimeout(formatAsyncDuration(wait)).KeepOnCompletion(cfg.Keep)
+	if cfg.KeepAlive > 0 {
+		s.KeepAlive(formatAsyncDuration(cfg.KeepAlive))
+	}
+	res, err := s.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; res.IsRunning != nil && *res.IsRunning; attempt++ {
+		if res.Id == nil {
+			return nil, errors.New("missing ID of the running EQL search")
+		}
+		id := *res.Id
+
+		timer := time.NewTimer(backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			deleteEQLSearch(cfg.Client, id)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		g := eqlget.New(cfg.Client).Id(id).WaitForCompletionTimeout(formatAsyncDuration(wait))
+		if cfg.KeepAlive > 0 {
+			g.KeepAlive(formatAsyncDuration(cfg.KeepAlive))
+		}
+		gres, err := g.Do(ctx)
+		if err != nil {
+			deleteEQLSearch(cfg.Client, id)
+			return nil, err
+		}
+		res = (*eqlsearch.Response)(gres)
+	}
+
+	if res.Id != nil && !cfg.Keep {
+		deleteEQLSearch(cfg.Client, *res.Id)
+		res.Id = nil
+	}
+
+	return res, nil
+}
+
+// deleteEQLSearch deletes the async search, ignoring the errors.
+func deleteEQLSearch(tp elastictransport.Interface, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	eqldelete.New(tp).Id(id).Do(ctx)
+}
+
+func newEQLResult(res *eqlsearch.Response) (*EQLResult, error) {
+	result := EQLResult{
+		Total:  res.Hits.Total,
+		Events: newEQLEvents(res.Hits.Events),
+	}
+	if res.Id != nil {
+		result.ID = *res.Id
+	}
+	if res.IsPartial != nil {
+		result.IsPartial = *res.IsPartial
+	}
+	if res.TimedOut != nil {
+		result.TimedOut = *res.TimedOut
+	}
+	if res.Took != nil {
+		result.Took = time.Duration(*res.Took) * time.Millisecond
+	}
+
+	for _, seq := range res.Hits.Sequences {
+		s := EQLSequence{Events: newEQLEvents(seq.Events)}
+		for _, raw := range seq.JoinKeys {
+			var v interface{}
+			dec := json.NewDecoder(bytes.NewReader(raw))
+			dec.UseNumber()
+			if err := dec.Decode(&v); err != nil {
+				return nil, err
+			}
+			s.JoinKeys = append(s.JoinKeys, v)
+		}
+		result.Sequences = append(result.Sequences, s)
+	}
+
+	return &result, nil
+}
+
+func newEQLEvents(hits []types.HitsEvent) []EQLEvent {
+	if len(hits) == 0 {
+		return nil
+	}
+	events := make([]EQLEvent, len(hits))
+	for i, h := range hits {
+		events[i] = EQLEvent{Index: h.Index_, ID: h.Id_, Source: h.Source_, Fields: h.Fields}
+	}
+	return events
+}
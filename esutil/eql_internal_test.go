@@ -0,0 +1,182 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/estest"
+	eqlsearch "github.com/elastic/go-elasticsearch/v8/typedapi/eql/search"
+)
+
+var eqlSequencesBody = map[string]interface{}{
+	"is_partial": false,
+	"is_running": false,
+	"timed_out":  false,
+	"took":       5,
+	"hits": map[string]interface{}{
+		"total": map[string]interface{}{"value": 1, "relation": "eq"},
+		"sequences": []interface{}{
+			map[string]interface{}{
+				"join_keys": []interface{}{"root", 42},
+				"events": []interface{}{
+					map[string]interface{}{"_index": "logs", "_id": "1", "_source": map[string]interface{}{"process": "cmd.exe"}},
+					map[string]interface{}{"_index": "logs", "_id": "2", "_source": map[string]interface{}{"process": "regsvr32.exe"}},
+				},
+			},
+		},
+	},
+}
+
+func TestEQLSearch(t *testing.T) {
+	t.Run("Sequences", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/logs/_eql/search").
+			WithBody(map[string]interface{}{"query": "sequence by user [process where true] [process where true]"}).
+			Respond(200, eqlSequencesBody)
+
+		res, err := EQLSearch(context.Background(), EQLConfig{
+			Client:  mock,
+			Index:   "logs",
+			Request: &eqlsearch.Request{Query: "sequence by user [process where true] [process where true]"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(res.Sequences) != 1 || len(res.Sequences[0].Events) != 2 {
+			t.Fatalf("Unexpected sequences: %+v", res.Sequences)
+		}
+		if keys := res.Sequences[0].JoinKeys; len(keys) != 2 || keys[0] != "root" || keys[1] != json.Number("42") {
+			t.Errorf("Unexpected join keys: %v", keys)
+		}
+		if res.Took != 5*time.Millisecond || res.Total.Value != 1 {
+			t.Errorf("Unexpected metadata: %+v", res)
+		}
+
+		var processes []string
+		err = res.EachEvent(func(seq, pos int, e EQLEvent) error {
+			var doc struct{ Process string }
+			if err := e.Decode(&doc); err != nil {
+				return err
+			}
+			if seq != 0 || pos != len(processes) {
+				t.Errorf("Unexpected position: %d/%d", seq, pos)
+			}
+			processes = append(processes, doc.Process)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(processes) != 2 || processes[0] != "cmd.exe" || processes[1] != "regsvr32.exe" {
+			t.Errorf("Unexpected processes: %v", processes)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Async", func(t *testing.T) {
+		running := map[string]interface{}{"id": "abc", "is_running": true, "is_partial": true, "hits": map[string]interface{}{}}
+		done := map[string]interface{}{"id": "abc", "is_running": false, "is_partial": false, "hits": map[string]interface{}{
+			"events": []interface{}{map[string]interface{}{"_index": "logs", "_id": "1", "_source": map[string]interface{}{"process": "cmd.exe"}}},
+		}}
+
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/logs/_eql/search").
+			WithQuery("wait_for_completion_timeout", "1000ms").
+			WithQuery("keep_on_completion", "false").
+			Respond(200, running)
+		mock.Expect("GET", "/_eql/search/abc").Respond(200, running)
+		mock.Expect("GET", "/_eql/search/abc").Respond(200, done)
+		mock.Expect("DELETE", "/_eql/search/abc").Respond(200, map[string]interface{}{"acknowledged": true})
+
+		res, err := EQLSearch(context.Background(), EQLConfig{
+			Client:  mock,
+			Index:   "logs",
+			Request: &eqlsearch.Request{Query: "process where true"},
+			Async:   true,
+			Backoff: noAsyncBackoff,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.ID != "" || len(res.Events) != 1 || res.Events[0].ID != "1" {
+			t.Errorf("Unexpected result: %+v", res)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Partial results", func(t *testing.T) {
+		for _, async := range []bool{false, true} {
+			mock := estest.NewMockTransport()
+			mock.Expect("POST", "/logs/_eql/search").
+				Times(2).
+				Respond(200, map[string]interface{}{"is_partial": true, "timed_out": true, "hits": map[string]interface{}{}})
+
+			cfg := EQLConfig{Client: mock, Index: "logs", Request: &eqlsearch.Request{Query: "any where true"}, Async: async}
+			res, err := EQLSearch(context.Background(), cfg)
+			if err != ErrPartialResults || res == nil || !res.TimedOut {
+				t.Errorf("Expected ErrPartialResults with results, got: %v, %+v", err, res)
+			}
+
+			cfg.AllowPartialResults = true
+			if _, err = EQLSearch(context.Background(), cfg); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			mock.AssertExpectations(t)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("POST", "/logs/_eql/search").Respond(200, map[string]interface{}{"id": "abc", "is_running": true, "hits": map[string]interface{}{}})
+		mock.Expect("DELETE", "/_eql/search/abc").Respond(200, map[string]interface{}{"acknowledged": true})
+
+		_, err := EQLSearch(context.Background(), EQLConfig{
+			Client:  mock,
+			Index:   "logs",
+			Request: &eqlsearch.Request{Query: "any where true"},
+			Async:   true,
+			Timeout: 10 * time.Millisecond,
+			Backoff: func(int) time.Duration { return time.Hour },
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+		}
+		mock.AssertExpectations(t)
+
+		mock = estest.NewMockTransport()
+		mock.Expect("POST", "/logs/_eql/search").Delay(time.Hour)
+
+		_, err = EQLSearch(context.Background(), EQLConfig{
+			Client:  mock,
+			Index:   "logs",
+			Request: &eqlsearch.Request{Query: "any where true"},
+			Timeout: 10 * time.Millisecond,
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+		}
+	})
+}
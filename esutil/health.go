@@ -0,0 +1,300 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/cluster/allocationexplain"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/cluster/health"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/healthstatus"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/level"
+)
+
+var (
+	defaultHealthTimeout        = time.Minute
+	defaultHealthRequestTimeout = 30 * time.Second
+	maxHealthRequestMargin      = time.Second
+	maxHealthExplanations       = 5
+)
+
+// HealthConfig represents the conditions to wait for in WaitForHealth.
+type HealthConfig struct {
+	Client  elastictransport.Interface // The Elasticsearch client, eg. *elasticsearch.TypedClient.
+	Indices []string                   // The indices to check, or the whole cluster.
+
+	Status               healthstatus.HealthStatus // The minimum status, eg. healthstatus.Yellow.
+	ActiveShards         string                    // The number of active shards, eg. "all" or "2".
+	Nodes                string                    // The number of nodes, eg. ">=3".
+	NoRelocatingShards   bool
+	NoInitializingShards bool
+
+	Timeout        time.Duration                   // Timeout of the wait. Default: 1m.
+	RequestTimeout time.Duration                   // Timeout of each request waiting on the server. Default: 30s.
+	Backoff        func(attempt int) time.Duration // Delay between the retried requests. Default: exponential, up to 5s.
+}
+
+// HealthTimeoutError is returned by WaitForHealth when the conditions
+// are not met before the timeout.
+type HealthTimeoutError struct {
+	Health     *health.Response  // The last observed health, if any.
+	Err        error             // The last error of the requests, if any.
+	Unassigned []UnassignedShard // The unassigned shards, with the explanations of the first ones.
+}
+
+// UnassignedShard represents an unassigned shard.
+type UnassignedShard struct {
+	Index       string
+	Shard       int
+	Primary     bool
+	Reason      string                      // The reason of the shard being unassigned, eg. "NODE_LEFT".
+	Explanation *allocationexplain.Response // The allocation explanation, for the first shards.
+}
+
+// Error returns the error message.
+func (e *HealthTimeoutError) Error() string {
+	var b strings.Builder
+	b.WriteString("timeout waiting for cluster health")
+	if e.Health != nil {
+		fmt.Fprintf(&b, ": status [%s], %d relocating, %d initializing, %d unassigned shards",
+			e.Health.Status, e.Health.RelocatingShards, e.Health.InitializingShards, e.Health.UnassignedShards)
+	}
+	for _, s := range e.Unassigned {
+		if s.Explanation == nil || s.Explanation.AllocateExplanation == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "; [%s][%d] %s: %s", s.Index, s.Shard, s.Reason, *s.Explanation.AllocateExplanation)
+		break
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, "; last error: %s", e.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *HealthTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// WaitForHealth waits for the cluster, or the indices, to meet the conditions,
+// and returns the health.
+//
+//	h, err := esutil.WaitForHealth(ctx, esutil.HealthConfig{
+//	  Client:             es,
+//	  Status:             healthstatus.Green,
+//	  NoRelocatingShards: true,
+//	})
+//
+// The conditions are checked on the server with the wait_for_* parameters, and the requests
+// are retried on timeouts and errors, eg. when the cluster is starting, until the Timeout,
+// or the deadline of the context. The authentication and authorization errors are returned
+// immediately.
+//
+// When the conditions are not met in time, a *HealthTimeoutError is returned, with the last
+// observed health, and the reasons of the unassigned shards from the allocation explain API.
+func WaitForHealth(ctx context.Context, cfg HealthConfig) (*health.Response, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("missing client")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	requestTimeout := cfg.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultHealthRequestTimeout
+	}
+	backoff := cfg.Backoff
+	if backoff == nil {
+		backoff = defaultAsyncBackoff
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		last    *health.Response
+		lastErr error
+	)
+	for attempt := 1; ; attempt++ {
+		wait := requestTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			// Leave a margin for the server to return the health before the deadline.
+			remaining := time.Until(deadline)
+			margin := remaining / 10
+			if margin > maxHealthRequestMargin {
+				margin = maxHealthRequestMargin
+			}
+			if remaining-margin < wait {
+				wait = remaining - margin
+			}
+			if wait < time.Millisecond {
+				wait = time.Millisecond
+			}
+		}
+
+		res, err := checkHealth(ctx, cfg, wait)
+		switch {
+		case isAuthError(err):
+			return nil, err
+		case err != nil:
+			lastErr = err
+		case !res.TimedOut:
+			return res, nil
+		default:
+			last, lastErr = res, nil
+		}
+
+		if ctx.Err() == nil {
+			timer := time.NewTimer(backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+				continue
+			}
+		}
+
+		if ctx.Err() != context.DeadlineExceeded {
+			return nil, ctx.Err()
+		}
+		if lastErr == ctx.Err() {
+			lastErr = nil
+		}
+		if last == nil {
+			last = currentHealth(cfg)
+		}
+		return nil, &HealthTimeoutError{
+			Health:     last,
+			Err:        lastErr,
+			Unassigned: explainUnassignedShards(cfg),
+		}
+	}
+}
+
+// isAuthError returns true when the request was rejected by the security, which retrying doesn't fix.
+func isAuthError(err error) bool {
+	var e *types.ElasticsearchError
+	return errors.As(err, &e) && (e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden)
+}
+
+// currentHealth returns the health without waiting for the conditions, or nil.
+// The errors are ignored, as it's called after the timeout.
+func currentHealth(cfg HealthConfig) *health.Response {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	h, err := checkHealth(ctx, HealthConfig{Client: cfg.Client, Indices: cfg.Indices}, 0)
+	if err != nil {
+		return nil
+	}
+	return h
+}
+
+// checkHealth performs the health request, waiting on the server for the conditions up to wait.
+//
+// The response is returned also when the server timed out waiting for the conditions.
+func checkHealth(ctx context.Context, cfg HealthConfig, wait time.Duration) (*health.Response, error) {
+	req := health.New(cfg.Client)
+	if wait > 0 {
+		req.Timeout(formatAsyncDuration(wait))
+	}
+	if len(cfg.Indices) > 0 {
+		req.Index(strings.Join(cfg.Indices, ",")).Level(level.Indices)
+	}
+	if cfg.Status.Name != "" {
+		req.WaitForStatus(cfg.Status)
+	}
+	if cfg.ActiveShards != "" {
+		req.WaitForActiveShards(cfg.ActiveShards)
+	}
+	if cfg.Nodes != "" {
+		req.WaitForNodes(cfg.Nodes)
+	}
+	if cfg.NoRelocatingShards {
+		req.WaitForNoRelocatingShards(true)
+	}
+	if cfg.NoInitializingShards {
+		req.WaitForNoInitializingShards(true)
+	}
+
+	res, err := req.Perform(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 && res.StatusCode != http.StatusRequestTimeout {
+		e := types.NewElasticsearchError()
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+			return nil, fmt.Errorf("cluster health: %s", res.Status)
+		}
+		return nil, e
+	}
+
+	h := health.NewResponse()
+	if err := json.NewDecoder(res.Body).Decode(h); err != nil {
+		return nil, fmt.Errorf("cannot decode the cluster health response: %s", err)
+	}
+	if res.StatusCode == http.StatusRequestTimeout {
+		h.TimedOut = true
+	}
+	return h, nil
+}
+
+// explainUnassignedShards returns the unassigned shards, and the explanations
+// of the first ones. The errors are ignored, as it's called after the timeout.
+func explainUnassignedShards(cfg HealthConfig) []UnassignedShard {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := esapi.CatShardsRequest{Index: cfg.Indices}.Rows(ctx, cfg.Client)
+	if err != nil {
+		return nil
+	}
+
+	var shards []UnassignedShard
+	for _, row := range rows {
+		if row.State != "UNASSIGNED" {
+			continue
+		}
+		s := UnassignedShard{Index: row.Index, Shard: row.Shard, Primary: row.PriRep == "p", Reason: row.UnassignedReason}
+		if len(shards) < maxHealthExplanations {
+			req := allocationexplain.NewRequest()
+			req.Index, req.Shard, req.Primary = &s.Index, &s.Shard, &s.Primary
+			if res, err := allocationexplain.New(cfg.Client).Request(req).Do(ctx); err == nil {
+				s.Explanation = res
+			}
+		}
+		shards = append(shards, s)
+	}
+	return shards
+}
@@ -0,0 +1,217 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/estest"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/healthstatus"
+)
+
+func healthBody(status string, timedOut bool, unassigned int) map[string]interface{} {
+	return map[string]interface{}{
+		"cluster_name":      "test",
+		"status":            status,
+		"timed_out":         timedOut,
+		"number_of_nodes":   1,
+		"active_shards":     1,
+		"unassigned_shards": unassigned,
+	}
+}
+
+func TestWaitForHealth(t *testing.T) {
+	t.Run("Status", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_cluster/health").ReturnError(errors.New("connection refused"))
+		mock.Expect("GET", "/_cluster/health").RespondError(503, "master_not_discovered_exception", "no master")
+		mock.Expect("GET", "/_cluster/health").Respond(408, healthBody("red", true, 2))
+		mock.Expect("GET", "/_cluster/health").
+			WithQuery("wait_for_status", "green").
+			WithQuery("wait_for_no_relocating_shards", "true").
+			WithQuery("wait_for_nodes", ">=1").
+			Respond(200, healthBody("green", false, 0))
+
+		h, err := WaitForHealth(context.Background(), HealthConfig{
+			Client:             mock,
+			Status:             healthstatus.Green,
+			Nodes:              ">=1",
+			NoRelocatingShards: true,
+			Backoff:            noAsyncBackoff,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if h.Status != healthstatus.Green {
+			t.Errorf("Unexpected status: %s", h.Status)
+		}
+		if q := mock.Requests()[0].Query; q.Get("timeout") != "30000ms" {
+			t.Errorf("Unexpected timeout: %s", q.Get("timeout"))
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Indices", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_cluster/health/logs,metrics").
+			WithQuery("level", "indices").
+			WithQuery("wait_for_active_shards", "all").
+			Respond(200, healthBody("yellow", false, 1))
+
+		_, err := WaitForHealth(context.Background(), HealthConfig{
+			Client:       mock,
+			Indices:      []string{"logs", "metrics"},
+			ActiveShards: "all",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_cluster/health").AnyTimes().Respond(200, healthBody("yellow", true, 2))
+		mock.Expect("GET", "/_cat/shards").
+			WithQuery("format", "json").
+			Respond(200, []interface{}{
+				map[string]interface{}{"index": "logs", "shard": "0", "prirep": "p", "state": "STARTED"},
+				map[string]interface{}{"index": "logs", "shard": "0", "prirep": "r", "state": "UNASSIGNED", "unassigned.reason": "INDEX_CREATED"},
+				map[string]interface{}{"index": "logs", "shard": "1", "prirep": "r", "state": "UNASSIGNED", "unassigned.reason": "INDEX_CREATED"},
+			})
+		mock.Expect("POST", "/_cluster/allocation/explain").
+			Times(2).
+			Respond(200, map[string]interface{}{
+				"index":                "logs",
+				"shard":                0,
+				"primary":              false,
+				"current_state":        "unassigned",
+				"can_allocate":         "no",
+				"allocate_explanation": "cannot allocate because allocation is not permitted to any of the nodes",
+			})
+
+		_, err := WaitForHealth(context.Background(), HealthConfig{
+			Client:  mock,
+			Status:  healthstatus.Green,
+			Timeout: 20 * time.Millisecond,
+			Backoff: noAsyncBackoff,
+		})
+		var e *HealthTimeoutError
+		if !errors.As(err, &e) {
+			t.Fatalf("Expected *HealthTimeoutError, got: %v", err)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the error to wrap context.DeadlineExceeded")
+		}
+		if e.Health == nil || e.Health.UnassignedShards != 2 {
+			t.Errorf("Unexpected last health: %+v", e.Health)
+		}
+		if len(e.Unassigned) != 2 || e.Unassigned[0].Reason != "INDEX_CREATED" || e.Unassigned[0].Primary || e.Unassigned[0].Explanation == nil {
+			t.Errorf("Unexpected unassigned shards: %+v", e.Unassigned)
+		}
+		if !strings.Contains(err.Error(), "status [yellow]") || !strings.Contains(err.Error(), "[logs][0] INDEX_CREATED: cannot allocate") {
+			t.Errorf("Unexpected error message: %s", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Request error", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_cluster/health").AnyTimes().RespondError(503, "master_not_discovered_exception", "no master")
+		mock.Expect("GET", "/_cat/shards").RespondError(503, "master_not_discovered_exception", "no master")
+
+		_, err := WaitForHealth(context.Background(), HealthConfig{Client: mock, Timeout: 10 * time.Millisecond, Backoff: noAsyncBackoff})
+		var e *HealthTimeoutError
+		if !errors.As(err, &e) {
+			t.Fatalf("Expected *HealthTimeoutError, got: %v", err)
+		}
+		var esErr *types.ElasticsearchError
+		if !errors.As(e.Err, &esErr) || esErr.Status != 503 {
+			t.Errorf("Unexpected last error: %#v", e.Err)
+		}
+	})
+
+	t.Run("Security error", func(t *testing.T) {
+		for _, status := range []int{401, 403} {
+			mock := estest.NewMockTransport()
+			mock.Expect("GET", "/_cluster/health").RespondError(status, "security_exception", "unauthorized")
+
+			_, err := WaitForHealth(context.Background(), HealthConfig{Client: mock, Backoff: noAsyncBackoff})
+			var esErr *types.ElasticsearchError
+			if !errors.As(err, &esErr) || esErr.Status != status {
+				t.Errorf("Expected the error to be returned immediately, got: %#v", err)
+			}
+			mock.AssertExpectations(t)
+		}
+	})
+
+	t.Run("Request timeout margin", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_cluster/health").Respond(200, healthBody("green", false, 0))
+
+		_, err := WaitForHealth(context.Background(), HealthConfig{Client: mock, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		timeout, _ := time.ParseDuration(mock.Requests()[0].Query.Get("timeout"))
+		if timeout <= 0 || timeout > 4500*time.Millisecond {
+			t.Errorf("Expected the request timeout to end before the deadline, got: %s", timeout)
+		}
+	})
+
+	t.Run("No response before the deadline", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_cluster/health").WithQuery("wait_for_status", "green").AnyTimes().Delay(time.Second).Respond(200, healthBody("green", false, 0))
+		mock.Expect("GET", "/_cluster/health").Respond(200, healthBody("yellow", false, 1))
+		mock.Expect("GET", "/_cat/shards").Respond(200, []interface{}{})
+
+		_, err := WaitForHealth(context.Background(), HealthConfig{
+			Client:  mock,
+			Status:  healthstatus.Green,
+			Timeout: 20 * time.Millisecond,
+			Backoff: noAsyncBackoff,
+		})
+		var e *HealthTimeoutError
+		if !errors.As(err, &e) {
+			t.Fatalf("Expected *HealthTimeoutError, got: %v", err)
+		}
+		if e.Health == nil || e.Health.Status != healthstatus.Yellow {
+			t.Errorf("Expected the current health, got: %+v", e.Health)
+		}
+	})
+
+	t.Run("Cancellation", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_cluster/health").AnyTimes().Respond(200, healthBody("red", true, 2))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := WaitForHealth(ctx, HealthConfig{Client: mock})
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got: %v", err)
+		}
+	})
+}
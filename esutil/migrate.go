@@ -0,0 +1,601 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/clearscroll"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/count"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/mget"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/reindex"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/scroll"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/addblock"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/create"
+	indicesdelete "github.com/elastic/go-elasticsearch/v8/typedapi/indices/delete"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/getalias"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/putsettings"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/refresh"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/updatealiases"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var defaultMigrationBatchSize = 1000
+
+// MigrationConfig represents the configuration of an index migration.
+type MigrationConfig struct {
+	Client elastictransport.Interface // The Elasticsearch client, eg. *elasticsearch.TypedClient.
+
+	ReadAlias  string          // The alias used for reading, eg. "products".
+	WriteAlias string          // The alias used for writing, if different from ReadAlias.
+	Source     string          // The current index. Default: the index of the aliases.
+	Target     string          // The new index, eg. "products-v2".
+	Request    *create.Request // The mappings and settings of the new index.
+
+	// Copy the documents with scroll and bulk requests instead of the reindex API.
+	ClientSide bool
+	BatchSize  int // The number of documents per batch. Default: 1000.
+
+	// Copy the documents changed during the copy, selected with a range query
+	// on the field, eg. "updated_at", as a date.
+	CatchUpField string
+
+	// Block the writes to the source index before catching up, to copy all the changes,
+	// and delete from the target index the documents deleted from the source index during
+	// the copy. The writes fail until the aliases are swapped.
+	BlockWrites bool
+
+	// Delete the source index after swapping the aliases. The migration can't be rolled back.
+	DeleteSource bool
+
+	Backoff    func(attempt int) time.Duration // Delay between the requests for the reindex task.
+	OnProgress func(TaskProgress)              // Called with the progress of the copy.
+}
+
+// MigrationResult represents the results of an index migration.
+type MigrationResult struct {
+	Source   string
+	Target   string
+	Aliases  []string // The aliases moved to the target index.
+	Copied   int64    // The number of documents copied.
+	CaughtUp int64    // The number of documents copied again when catching up.
+	Deleted  int64    // The number of documents deleted during the copy, with BlockWrites.
+	Took     time.Duration
+
+	blocked bool
+}
+
+// MigrateIndex creates the target index, copies the documents from the source index,
+// and moves the aliases to the target index in a single atomic request.
+//
+//	res, err := esutil.MigrateIndex(ctx, esutil.MigrationConfig{
+//	  Client:       es,
+//	  ReadAlias:    "products",
+//	  Target:       "products-v2",
+//	  Request:      &create.Request{Mappings: mappings},
+//	  CatchUpField: "updated_at",
+//	})
+//
+// The documents are copied with the reindex API, tracking the task with WaitForTask,
+// or on the client with ClientSide. With CatchUpField, the documents changed during the
+// copy are copied again; the writes made after the catch up are copied only with BlockWrites.
+//
+// The documents deleted from the source index during the copy remain in the target index,
+// unless BlockWrites is set: once the writes are blocked, the documents missing in the source
+// index are deleted from the target index. With BlockWrites, the source index remains
+// read-only after the migration.
+//
+// The aliases are moved with their properties, eg. filter, routing or is_write_index.
+// When the migration fails before moving the aliases, the target index is deleted,
+// and the block of the source index is removed. See RollbackMigration to undo a migration.
+func MigrateIndex(ctx context.Context, cfg MigrationConfig) (*MigrationResult, error) {
+	start := time.Now()
+	if cfg.Client == nil {
+		return nil, errors.New("missing client")
+	}
+	if cfg.ReadAlias == "" || cfg.Target == "" {
+		return nil, errors.New("missing alias or target index")
+	}
+
+	aliases := []string{cfg.ReadAlias}
+	if cfg.WriteAlias != "" && cfg.WriteAlias != cfg.ReadAlias {
+		aliases = append(aliases, cfg.WriteAlias)
+	}
+	source, props, err := resolveMigrationSource(ctx, cfg.Client, cfg.Source, aliases)
+	if err != nil {
+		return nil, err
+	}
+	if source == cfg.Target {
+		return nil, fmt.Errorf("the aliases already point to the target index %q", cfg.Target)
+	}
+
+	result := &MigrationResult{Source: source, Target: cfg.Target, Aliases: aliases}
+
+	c := create.New(cfg.Client).Index(cfg.Target)
+	if cfg.Request != nil {
+		c.Request(cfg.Request)
+	}
+	if err := decodeTypedResponse(c.Perform(ctx)); err != nil {
+		return nil, fmt.Errorf("cannot create index %q: %w", cfg.Target, err)
+	}
+
+	if err := migrateDocuments(ctx, cfg, result, start); err != nil {
+		cleanupMigration(cfg.Client, result)
+		return nil, err
+	}
+
+	actions := make([]map[string]interface{}, 0, len(aliases)*2)
+	for _, alias := range aliases {
+		add := map[string]interface{}{"index": cfg.Target, "alias": alias}
+		for k, v := range props[alias] {
+			add[k] = v
+		}
+		actions = append(actions,
+			map[string]interface{}{"remove": map[string]interface{}{"index": source, "alias": alias}},
+			map[string]interface{}{"add": add},
+		)
+	}
+	if err := updateMigrationAliases(ctx, cfg.Client, actions); err != nil {
+		cleanupMigration(cfg.Client, result)
+		return nil, fmt.Errorf("cannot swap the aliases: %w", err)
+	}
+
+	if cfg.DeleteSource {
+		if err := decodeTypedResponse(indicesdelete.New(cfg.Client).Index(source).Perform(ctx)); err != nil {
+			return result, fmt.Errorf("cannot delete index %q: %w", source, err)
+		}
+	}
+
+	result.Took = time.Since(start)
+	return result, nil
+}
+
+// RollbackMigration moves the aliases back to the source index, removes the write block
+// of the source index, and deletes the target index.
+func RollbackMigration(ctx context.Context, tp elastictransport.Interface, res *MigrationResult) error {
+	actions := make([]map[string]interface{}, 0, len(res.Aliases)*2)
+	_, props, err := resolveMigrationSource(ctx, tp, res.Target, res.Aliases)
+	if err != nil {
+		return err
+	}
+	for _, alias := range res.Aliases {
+		add := map[string]interface{}{"index": res.Source, "alias": alias}
+		for k, v := range props[alias] {
+			add[k] = v
+		}
+		actions = append(actions,
+			map[string]interface{}{"remove": map[string]interface{}{"index": res.Target, "alias": alias}},
+			map[string]interface{}{"add": add},
+		)
+	}
+
+	if res.blocked {
+		if err := unblockWrites(ctx, tp, res.Source); err != nil {
+			return fmt.Errorf("cannot remove the write block of index %q: %w", res.Source, err)
+		}
+	}
+	if err := updateMigrationAliases(ctx, tp, actions); err != nil {
+		return fmt.Errorf("cannot swap the aliases: %w", err)
+	}
+	if err := decodeTypedResponse(indicesdelete.New(tp).Index(res.Target).Perform(ctx)); err != nil {
+		return fmt.Errorf("cannot delete index %q: %w", res.Target, err)
+	}
+	return nil
+}
+
+// resolveMigrationSource returns the index of the aliases, and the properties of the aliases.
+func resolveMigrationSource(ctx context.Context, tp elastictransport.Interface, index string, aliases []string) (string, map[string]map[string]interface{}, error) {
+	var resp map[string]struct {
+		Aliases map[string]map[string]interface{} `json:"aliases"`
+	}
+	req := getalias.New(tp).Name(strings.Join(aliases, ","))
+	if index != "" {
+		req.Index(index)
+	}
+	res, err := req.Perform(ctx)
+	if err := decodeTypedBody(res, err, &resp); err != nil {
+		return "", nil, fmt.Errorf("cannot get the aliases: %w", err)
+	}
+
+	indices := make([]string, 0, len(resp))
+	for idx := range resp {
+		indices = append(indices, idx)
+	}
+	sort.Strings(indices)
+	if len(indices) != 1 {
+		return "", nil, fmt.Errorf("expected the aliases to point to one index, got: %v", indices)
+	}
+
+	props := resp[indices[0]].Aliases
+	for _, alias := range aliases {
+		if _, ok := props[alias]; !ok {
+			return "", nil, fmt.Errorf("alias %q doesn't point to index %q", alias, indices[0])
+		}
+	}
+	return indices[0], props, nil
+}
+
+// migrateDocuments copies the documents, and the changes made since start.
+func migrateDocuments(ctx context.Context, cfg MigrationConfig, res *MigrationResult, start time.Time) error {
+	n, err := copyDocuments(ctx, cfg, res.Source, nil)
+	if err != nil {
+		return fmt.Errorf("cannot copy the documents: %w", err)
+	}
+	res.Copied = n
+
+	if cfg.BlockWrites {
+		if err := decodeTypedResponse(addblock.New(cfg.Client).Index(res.Source).Block("write").Perform(ctx)); err != nil {
+			return fmt.Errorf("cannot block the writes of index %q: %w", res.Source, err)
+		}
+		res.blocked = true
+	}
+
+	if cfg.CatchUpField != "" || cfg.BlockWrites {
+		if err := decodeTypedResponse(refresh.New(cfg.Client).Index(res.Source).Perform(ctx)); err != nil {
+			return fmt.Errorf("cannot refresh index %q: %w", res.Source, err)
+		}
+	}
+
+	if cfg.CatchUpField != "" {
+		query := map[string]interface{}{
+			"range": map[string]interface{}{
+				cfg.CatchUpField: map[string]interface{}{"gte": start.UnixNano() / int64(time.Millisecond), "format": "epoch_millis"},
+			},
+		}
+		n, err := copyDocuments(ctx, cfg, res.Source, query)
+		if err != nil {
+			return fmt.Errorf("cannot catch up the documents: %w", err)
+		}
+		res.CaughtUp = n
+	}
+
+	if err := decodeTypedResponse(refresh.New(cfg.Client).Index(res.Target).Perform(ctx)); err != nil {
+		return err
+	}
+
+	if cfg.BlockWrites {
+		n, err := deleteMissingDocuments(ctx, cfg, res.Source)
+		if err != nil {
+			return fmt.Errorf("cannot delete the documents deleted during the copy: %w", err)
+		}
+		res.Deleted = n
+	}
+
+	return nil
+}
+
+// deleteMissingDocuments deletes from the target index the documents missing in the source index,
+// when the target index has more documents.
+//
+// The source index must be read-only, so the target index contains all its documents.
+func deleteMissingDocuments(ctx context.Context, cfg MigrationConfig, source string) (int64, error) {
+	var sourceCount, targetCount struct {
+		Count int64 `json:"count"`
+	}
+	res, err := count.New(cfg.Client).Index(source).Perform(ctx)
+	if err := decodeTypedBody(res, err, &sourceCount); err != nil {
+		return 0, err
+	}
+	res, err = count.New(cfg.Client).Index(cfg.Target).Perform(ctx)
+	if err := decodeTypedBody(res, err, &targetCount); err != nil {
+		return 0, err
+	}
+	if targetCount.Count <= sourceCount.Count {
+		return 0, nil
+	}
+
+	size := cfg.BatchSize
+	if size <= 0 {
+		size = defaultMigrationBatchSize
+	}
+	body, err := json.Marshal(map[string]interface{}{"size": size, "sort": []string{"_doc"}, "_source": false})
+	if err != nil {
+		return 0, err
+	}
+
+	type page struct {
+		ScrollID string `json:"_scroll_id"`
+		Hits     struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	var (
+		p       page
+		deleted int64
+	)
+	res, err = search.New(cfg.Client).Index(cfg.Target).Scroll("5m").Raw(bytes.NewReader(body)).Perform(ctx)
+	if err := decodeTypedBody(res, err, &p); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if p.ScrollID != "" {
+			body, _ := json.Marshal(map[string]interface{}{"scroll_id": []string{p.ScrollID}})
+			decodeTypedResponse(clearscroll.New(cfg.Client).Raw(bytes.NewReader(body)).Perform(context.Background()))
+		}
+	}()
+
+	for len(p.Hits.Hits) > 0 {
+		ids := make([]string, 0, len(p.Hits.Hits))
+		for _, hit := range p.Hits.Hits {
+			ids = append(ids, hit.ID)
+		}
+		body, err := json.Marshal(map[string]interface{}{"ids": ids})
+		if err != nil {
+			return deleted, err
+		}
+		var docs struct {
+			Docs []struct {
+				ID    string `json:"_id"`
+				Found bool   `json:"found"`
+			} `json:"docs"`
+		}
+		res, err := mget.New(cfg.Client).Index(source).Source_("false").Raw(bytes.NewReader(body)).Perform(ctx)
+		if err := decodeTypedBody(res, err, &docs); err != nil {
+			return deleted, err
+		}
+
+		var buf bytes.Buffer
+		for _, doc := range docs.Docs {
+			if doc.Found {
+				continue
+			}
+			meta, _ := json.Marshal(map[string]interface{}{"delete": map[string]interface{}{"_id": doc.ID}})
+			buf.Write(meta)
+			buf.WriteByte('\n')
+		}
+		if buf.Len() > 0 {
+			bres, err := esapi.BulkRequest{Index: cfg.Target, Body: &buf}.Do(ctx, cfg.Client)
+			if err != nil {
+				return deleted, err
+			}
+			var blk BulkIndexerResponse
+			if err := decodeTypedBody(&http.Response{StatusCode: bres.StatusCode, Status: bres.Status(), Body: bres.Body}, nil, &blk); err != nil {
+				return deleted, err
+			}
+			for _, item := range blk.Items {
+				for _, info := range item {
+					if info.Error.Type != "" {
+						return deleted, fmt.Errorf("cannot delete document %q: %s: %s", info.DocumentID, info.Error.Type, info.Error.Reason)
+					}
+					deleted++
+				}
+			}
+		}
+
+		body, err = json.Marshal(map[string]interface{}{"scroll": "5m", "scroll_id": p.ScrollID})
+		if err != nil {
+			return deleted, err
+		}
+		p = page{ScrollID: p.ScrollID}
+		res, err = scroll.New(cfg.Client).Raw(bytes.NewReader(body)).Perform(ctx)
+		if err := decodeTypedBody(res, err, &p); err != nil {
+			return deleted, err
+		}
+	}
+
+	if deleted > 0 {
+		return deleted, decodeTypedResponse(refresh.New(cfg.Client).Index(cfg.Target).Perform(ctx))
+	}
+	return deleted, nil
+}
+
+// copyDocuments copies the documents matching the query, or all the documents.
+func copyDocuments(ctx context.Context, cfg MigrationConfig, source string, query interface{}) (int64, error) {
+	if cfg.ClientSide {
+		return copyDocumentsClientSide(ctx, cfg, source, query)
+	}
+
+	src := map[string]interface{}{"index": source}
+	if query != nil {
+		src["query"] = query
+	}
+	if cfg.BatchSize > 0 {
+		src["size"] = cfg.BatchSize
+	}
+	body, err := json.Marshal(map[string]interface{}{"source": src, "dest": map[string]interface{}{"index": cfg.Target}})
+	if err != nil {
+		return 0, err
+	}
+
+	var resp struct {
+		Task string `json:"task"`
+	}
+	res, err := reindex.New(cfg.Client).Raw(bytes.NewReader(body)).WaitForCompletion(false).Perform(ctx)
+	if err := decodeTypedBody(res, err, &resp); err != nil {
+		return 0, err
+	}
+
+	task, err := WaitForTask(ctx, TaskConfig{
+		Client:              cfg.Client,
+		TaskID:              resp.Task,
+		Backoff:             cfg.Backoff,
+		CancelOnContextDone: true,
+		OnProgress:          cfg.OnProgress,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return task.Progress.Created + task.Progress.Updated, nil
+}
+
+// copyDocumentsClientSide copies the documents with scroll and bulk requests.
+func copyDocumentsClientSide(ctx context.Context, cfg MigrationConfig, source string, query interface{}) (int64, error) {
+	size := cfg.BatchSize
+	if size <= 0 {
+		size = defaultMigrationBatchSize
+	}
+	req := map[string]interface{}{"size": size, "sort": []string{"_doc"}}
+	if query != nil {
+		req["query"] = query
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+
+	type page struct {
+		ScrollID string `json:"_scroll_id"`
+		Hits     struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID     string          `json:"_id"`
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	var (
+		p        page
+		progress TaskProgress
+		started  = time.Now()
+	)
+	res, err := search.New(cfg.Client).Index(source).Scroll("5m").Raw(bytes.NewReader(body)).Perform(ctx)
+	if err := decodeTypedBody(res, err, &p); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if p.ScrollID != "" {
+			body, _ := json.Marshal(map[string]interface{}{"scroll_id": []string{p.ScrollID}})
+			decodeTypedResponse(clearscroll.New(cfg.Client).Raw(bytes.NewReader(body)).Perform(context.Background()))
+		}
+	}()
+	progress.Total = p.Hits.Total.Value
+
+	for len(p.Hits.Hits) > 0 {
+		var buf bytes.Buffer
+		for _, hit := range p.Hits.Hits {
+			meta, _ := json.Marshal(map[string]interface{}{"index": map[string]interface{}{"_id": hit.ID}})
+			buf.Write(meta)
+			buf.WriteByte('\n')
+			buf.Write(hit.Source)
+			buf.WriteByte('\n')
+		}
+
+		bres, err := esapi.BulkRequest{Index: cfg.Target, Body: &buf}.Do(ctx, cfg.Client)
+		if err != nil {
+			return progress.Created + progress.Updated, err
+		}
+		var blk BulkIndexerResponse
+		if err := decodeTypedBody(&http.Response{StatusCode: bres.StatusCode, Status: bres.Status(), Body: bres.Body}, nil, &blk); err != nil {
+			return progress.Created + progress.Updated, err
+		}
+		for _, item := range blk.Items {
+			for _, info := range item {
+				switch {
+				case info.Error.Type != "":
+					return progress.Created + progress.Updated,
+						fmt.Errorf("cannot index document %q: %s: %s", info.DocumentID, info.Error.Type, info.Error.Reason)
+				case info.Result == "created":
+					progress.Created++
+				default:
+					progress.Updated++
+				}
+			}
+		}
+		progress.Batches++
+		progress.RunningTime = time.Since(started)
+		if cfg.OnProgress != nil {
+			cfg.OnProgress(progress)
+		}
+
+		body, err := json.Marshal(map[string]interface{}{"scroll": "5m", "scroll_id": p.ScrollID})
+		if err != nil {
+			return progress.Created + progress.Updated, err
+		}
+		p = page{ScrollID: p.ScrollID}
+		res, err := scroll.New(cfg.Client).Raw(bytes.NewReader(body)).Perform(ctx)
+		if err := decodeTypedBody(res, err, &p); err != nil {
+			return progress.Created + progress.Updated, err
+		}
+	}
+
+	return progress.Created + progress.Updated, nil
+}
+
+func updateMigrationAliases(ctx context.Context, tp elastictransport.Interface, actions []map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	return decodeTypedResponse(updatealiases.New(tp).Raw(bytes.NewReader(body)).Perform(ctx))
+}
+
+func unblockWrites(ctx context.Context, tp elastictransport.Interface, index string) error {
+	body := strings.NewReader(`{"index.blocks.write":false}`)
+	return decodeTypedResponse(putsettings.New(tp).Index(index).Raw(body).Perform(ctx))
+}
+
+// cleanupMigration deletes the target index and removes the write block, after a failure.
+// The errors are ignored, as it's called after the context may be cancelled.
+func cleanupMigration(tp elastictransport.Interface, res *MigrationResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if res.blocked {
+		unblockWrites(ctx, tp, res.Source)
+	}
+	decodeTypedResponse(indicesdelete.New(tp).Index(res.Target).Perform(ctx))
+}
+
+// decodeTypedResponse checks the response, and discards the body.
+func decodeTypedResponse(res *http.Response, err error) error {
+	return decodeTypedBody(res, err, nil)
+}
+
+// decodeTypedBody checks the response, and decodes the body into v, when not nil.
+// The error responses are returned as *types.ElasticsearchError.
+func decodeTypedBody(res *http.Response, err error, v interface{}) error {
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		e := types.NewElasticsearchError()
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+			return fmt.Errorf("%s", res.Status)
+		}
+		if e.Status == 0 {
+			e.Status = res.StatusCode
+		}
+		return e
+	}
+
+	if v == nil {
+		_, err := io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
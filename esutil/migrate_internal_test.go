@@ -0,0 +1,276 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/estest"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/indices/create"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+var acknowledged = map[string]interface{}{"acknowledged": true}
+
+func completedTask(created, updated int) map[string]interface{} {
+	return map[string]interface{}{
+		"completed": true,
+		"task":      map[string]interface{}{"action": "indices:data/write/reindex", "status": map[string]interface{}{"created": created, "updated": updated}},
+		"response":  map[string]interface{}{"created": created, "updated": updated, "failures": []interface{}{}},
+	}
+}
+
+func TestMigrateIndex(t *testing.T) {
+	aliases := map[string]interface{}{
+		"products-v1": map[string]interface{}{"aliases": map[string]interface{}{
+			"products":       map[string]interface{}{"filter": map[string]interface{}{"term": map[string]interface{}{"active": true}}},
+			"products-write": map[string]interface{}{"is_write_index": true},
+		}},
+	}
+
+	t.Run("Reindex", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_alias/products,products-write").Respond(200, aliases)
+		mock.Expect("PUT", "/products-v2").
+			WithBody(map[string]interface{}{"mappings": map[string]interface{}{"properties": map[string]interface{}{"name": map[string]interface{}{"type": "text"}}}}).
+			Respond(200, acknowledged)
+		mock.Expect("POST", "/_reindex").
+			WithQuery("wait_for_completion", "false").
+			WithBody(map[string]interface{}{"source": map[string]interface{}{"index": "products-v1"}, "dest": map[string]interface{}{"index": "products-v2"}}).
+			Respond(200, map[string]interface{}{"task": "n1:1"})
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, completedTask(10, 0))
+		mock.Expect("PUT", "/products-v1/_block/write").Respond(200, acknowledged)
+		mock.Expect("POST", "/products-v1/_refresh").Respond(200, nil)
+		mock.Expect("POST", "/_reindex").
+			WithBodyMatching(func(body []byte) bool {
+				return strings.Contains(string(body), `"range":{"updated_at":{"format":"epoch_millis","gte":`)
+			}).
+			Respond(200, map[string]interface{}{"task": "n1:2"})
+		mock.Expect("GET", "/_tasks/n1:2").Respond(200, completedTask(1, 2))
+		mock.Expect("POST", "/products-v2/_refresh").Respond(200, nil)
+		mock.Expect("POST", "/products-v1/_count").Respond(200, map[string]interface{}{"count": 11})
+		mock.Expect("POST", "/products-v2/_count").Respond(200, map[string]interface{}{"count": 11})
+		mock.Expect("POST", "/_aliases").
+			WithBody(map[string]interface{}{"actions": []interface{}{
+				map[string]interface{}{"remove": map[string]interface{}{"index": "products-v1", "alias": "products"}},
+				map[string]interface{}{"add": map[string]interface{}{"index": "products-v2", "alias": "products", "filter": map[string]interface{}{"term": map[string]interface{}{"active": true}}}},
+				map[string]interface{}{"remove": map[string]interface{}{"index": "products-v1", "alias": "products-write"}},
+				map[string]interface{}{"add": map[string]interface{}{"index": "products-v2", "alias": "products-write", "is_write_index": true}},
+			}}).
+			Respond(200, acknowledged)
+
+		res, err := MigrateIndex(context.Background(), MigrationConfig{
+			Client:       mock,
+			ReadAlias:    "products",
+			WriteAlias:   "products-write",
+			Target:       "products-v2",
+			Request:      &create.Request{Mappings: &types.TypeMapping{Properties: map[string]types.Property{"name": types.NewTextProperty()}}},
+			CatchUpField: "updated_at",
+			BlockWrites:  true,
+			Backoff:      noAsyncBackoff,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Source != "products-v1" || res.Copied != 10 || res.CaughtUp != 3 {
+			t.Errorf("Unexpected result: %+v", res)
+		}
+		mock.AssertExpectations(t)
+
+		// Rollback
+		mock = estest.NewMockTransport()
+		mock.Expect("GET", "/products-v2/_alias/products,products-write").Respond(200, map[string]interface{}{"products-v2": aliases["products-v1"]})
+		mock.Expect("PUT", "/products-v1/_settings").WithBody(map[string]interface{}{"index.blocks.write": false}).Respond(200, acknowledged)
+		mock.Expect("POST", "/_aliases").
+			WithBodyMatching(func(body []byte) bool {
+				return strings.HasPrefix(string(body), `{"actions":[{"remove":{"alias":"products","index":"products-v2"}},{"add":{"alias":"products","filter"`)
+			}).
+			Respond(200, acknowledged)
+		mock.Expect("DELETE", "/products-v2").Respond(200, acknowledged)
+
+		if err := RollbackMigration(context.Background(), mock, res); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Client side", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_alias/products").Respond(200, aliases)
+		mock.Expect("PUT", "/products-v2").Respond(200, acknowledged)
+		mock.Expect("POST", "/products-v1/_search").
+			WithQuery("scroll", "5m").
+			WithBody(map[string]interface{}{"size": 2, "sort": []string{"_doc"}}).
+			Respond(200, map[string]interface{}{"_scroll_id": "s1", "hits": map[string]interface{}{
+				"total": map[string]interface{}{"value": 3},
+				"hits": []interface{}{
+					map[string]interface{}{"_id": "1", "_source": map[string]interface{}{"name": "a"}},
+					map[string]interface{}{"_id": "2", "_source": map[string]interface{}{"name": "b"}},
+				},
+			}})
+		mock.Expect("POST", "/products-v2/_bulk").
+			WithBodyMatching(func(body []byte) bool {
+				return string(body) == "{\"index\":{\"_id\":\"1\"}}\n{\"name\":\"a\"}\n{\"index\":{\"_id\":\"2\"}}\n{\"name\":\"b\"}\n"
+			}).
+			Respond(200, map[string]interface{}{"errors": false, "items": []interface{}{
+				map[string]interface{}{"index": map[string]interface{}{"_id": "1", "result": "created", "status": 201}},
+				map[string]interface{}{"index": map[string]interface{}{"_id": "2", "result": "created", "status": 201}},
+			}})
+		mock.Expect("POST", "/_search/scroll").
+			WithBody(map[string]interface{}{"scroll": "5m", "scroll_id": "s1"}).
+			Respond(200, map[string]interface{}{"_scroll_id": "s1", "hits": map[string]interface{}{
+				"hits": []interface{}{map[string]interface{}{"_id": "3", "_source": map[string]interface{}{"name": "c"}}},
+			}})
+		mock.Expect("POST", "/products-v2/_bulk").RespondBulk()
+		mock.Expect("POST", "/_search/scroll").Respond(200, map[string]interface{}{"_scroll_id": "s1", "hits": map[string]interface{}{"hits": []interface{}{}}})
+		mock.Expect("DELETE", "/_search/scroll").WithBody(map[string]interface{}{"scroll_id": []string{"s1"}}).Respond(200, nil)
+		mock.Expect("POST", "/products-v2/_refresh").Respond(200, nil)
+		mock.Expect("POST", "/_aliases").Respond(200, acknowledged)
+		mock.Expect("DELETE", "/products-v1").Respond(200, acknowledged)
+
+		var progress []TaskProgress
+		res, err := MigrateIndex(context.Background(), MigrationConfig{
+			Client:       mock,
+			ReadAlias:    "products",
+			Target:       "products-v2",
+			ClientSide:   true,
+			BatchSize:    2,
+			DeleteSource: true,
+			OnProgress:   func(p TaskProgress) { progress = append(progress, p) },
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Copied != 3 {
+			t.Errorf("Unexpected result: %+v", res)
+		}
+		if len(progress) != 2 || progress[1].Total != 3 || progress[1].Created != 3 || progress[1].Batches != 2 {
+			t.Errorf("Unexpected progress: %+v", progress)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Deleted documents", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_alias/products").Respond(200, aliases)
+		mock.Expect("PUT", "/products-v2").Respond(200, acknowledged)
+		mock.Expect("POST", "/_reindex").Respond(200, map[string]interface{}{"task": "n1:1"})
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, completedTask(3, 0))
+		mock.Expect("PUT", "/products-v1/_block/write").Respond(200, acknowledged)
+		mock.Expect("POST", "/products-v1/_refresh").Respond(200, nil)
+		mock.Expect("POST", "/products-v2/_refresh").Respond(200, nil)
+		mock.Expect("POST", "/products-v1/_count").Respond(200, map[string]interface{}{"count": 2})
+		mock.Expect("POST", "/products-v2/_count").Respond(200, map[string]interface{}{"count": 3})
+		mock.Expect("POST", "/products-v2/_search").
+			WithQuery("scroll", "5m").
+			WithBody(map[string]interface{}{"size": 2, "sort": []string{"_doc"}, "_source": false}).
+			Respond(200, map[string]interface{}{"_scroll_id": "s1", "hits": map[string]interface{}{
+				"hits": []interface{}{map[string]interface{}{"_id": "1"}, map[string]interface{}{"_id": "2"}},
+			}})
+		mock.Expect("POST", "/products-v1/_mget").
+			WithBody(map[string]interface{}{"ids": []string{"1", "2"}}).
+			Respond(200, map[string]interface{}{"docs": []interface{}{
+				map[string]interface{}{"_id": "1", "found": true},
+				map[string]interface{}{"_id": "2", "found": false},
+			}})
+		mock.Expect("POST", "/products-v2/_bulk").
+			WithBodyMatching(func(body []byte) bool {
+				return string(body) == "{\"delete\":{\"_id\":\"2\"}}\n"
+			}).
+			Respond(200, map[string]interface{}{"errors": false, "items": []interface{}{
+				map[string]interface{}{"delete": map[string]interface{}{"_id": "2", "result": "deleted", "status": 200}},
+			}})
+		mock.Expect("POST", "/_search/scroll").
+			WithBody(map[string]interface{}{"scroll": "5m", "scroll_id": "s1"}).
+			Respond(200, map[string]interface{}{"_scroll_id": "s1", "hits": map[string]interface{}{
+				"hits": []interface{}{map[string]interface{}{"_id": "3"}},
+			}})
+		mock.Expect("POST", "/products-v1/_mget").
+			WithBody(map[string]interface{}{"ids": []string{"3"}}).
+			Respond(200, map[string]interface{}{"docs": []interface{}{map[string]interface{}{"_id": "3", "found": true}}})
+		mock.Expect("POST", "/_search/scroll").Respond(200, map[string]interface{}{"_scroll_id": "s1", "hits": map[string]interface{}{"hits": []interface{}{}}})
+		mock.Expect("DELETE", "/_search/scroll").WithBody(map[string]interface{}{"scroll_id": []string{"s1"}}).Respond(200, nil)
+		mock.Expect("POST", "/products-v2/_refresh").Respond(200, nil)
+		mock.Expect("POST", "/_aliases").Respond(200, acknowledged)
+
+		res, err := MigrateIndex(context.Background(), MigrationConfig{
+			Client:      mock,
+			ReadAlias:   "products",
+			Target:      "products-v2",
+			BlockWrites: true,
+			BatchSize:   2,
+			Backoff:     noAsyncBackoff,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Copied != 3 || res.Deleted != 1 {
+			t.Errorf("Unexpected result: %+v", res)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Cleanup after failure", func(t *testing.T) {
+		failed := completedTask(0, 0)
+		failed["error"] = map[string]interface{}{"type": "illegal_argument_exception", "reason": "mapper conflict"}
+
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_alias/products").Respond(200, aliases)
+		mock.Expect("PUT", "/products-v2").Respond(200, acknowledged)
+		mock.Expect("POST", "/_reindex").Respond(200, map[string]interface{}{"task": "n1:1"})
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, failed)
+		mock.Expect("DELETE", "/products-v2").Respond(200, acknowledged)
+
+		_, err := MigrateIndex(context.Background(), MigrationConfig{Client: mock, ReadAlias: "products", Target: "products-v2"})
+		var e *TaskError
+		if !errors.As(err, &e) || e.Cause.Type != "illegal_argument_exception" {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Ambiguous source", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_alias/products").Respond(200, map[string]interface{}{
+			"products-v1": map[string]interface{}{"aliases": map[string]interface{}{"products": map[string]interface{}{}}},
+			"products-v2": map[string]interface{}{"aliases": map[string]interface{}{"products": map[string]interface{}{}}},
+		})
+
+		_, err := MigrateIndex(context.Background(), MigrationConfig{Client: mock, ReadAlias: "products", Target: "products-v3"})
+		if err == nil || !strings.Contains(err.Error(), "[products-v1 products-v2]") {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Missing alias", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_alias/products").RespondError(404, "aliases_not_found_exception", "aliases [products] missing")
+
+		_, err := MigrateIndex(context.Background(), MigrationConfig{Client: mock, ReadAlias: "products", Target: "products-v2"})
+		var e *types.ElasticsearchError
+		if !errors.As(err, &e) || e.Status != 404 {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+	})
+}
@@ -0,0 +1,339 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	taskcancel "github.com/elastic/go-elasticsearch/v8/typedapi/tasks/cancel"
+	taskget "github.com/elastic/go-elasticsearch/v8/typedapi/tasks/get"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// TaskConfig represents the configuration for waiting for a task.
+type TaskConfig struct {
+	Client elastictransport.Interface // The Elasticsearch client, eg. *elasticsearch.TypedClient.
+	TaskID string                     // The task ID, eg. "oTUltX4IQMOUUVeiohTt8A:12345".
+
+	Backoff func(attempt int) time.Duration // Delay between the requests. Default: exponential, up to 5s.
+
+	// Cancel the task with the tasks/cancel API when the context is cancelled.
+	CancelOnContextDone bool
+
+	// Called with the progress of the running task, when it changes.
+	OnProgress func(TaskProgress)
+
+	// Receives the progress of the running task, when it changes. The channel is not closed.
+	Progress chan<- TaskProgress
+}
+
+// TaskProgress represents the progress of a task,
+// eg. reindex, update by query or delete by query.
+type TaskProgress struct {
+	Total            int64
+	Created          int64
+	Updated          int64
+	Deleted          int64
+	Noops            int64
+	VersionConflicts int64
+	Batches          int64
+	Retries          types.Retries
+
+	RequestsPerSecond float64
+	Throttled         time.Duration
+	ThrottledUntil    time.Duration
+
+	RunningTime time.Duration
+}
+
+// TaskResult represents the results of a completed task.
+type TaskResult struct {
+	TaskID      string
+	Action      string
+	Description string
+	Progress    TaskProgress    // The final progress of the task.
+	Response    json.RawMessage // The response of the task, eg. the reindex response.
+}
+
+// Decode decodes the response of the task into v.
+func (r *TaskResult) Decode(v interface{}) error {
+	if len(r.Response) == 0 {
+		return errors.New("missing task response")
+	}
+	return json.Unmarshal(r.Response, v)
+}
+
+// TaskError represents the failure of a task.
+type TaskError struct {
+	TaskID   string
+	Cause    *types.ErrorCause // The error of the failed task.
+	Canceled string            // The reason of the cancellation of the task.
+	Failures []TaskFailure     // The failures reported in the response of the task.
+}
+
+// TaskFailure represents the failure of a document or a shard reported by a task.
+type TaskFailure struct {
+	Index  string
+	ID     string
+	Shard  *int
+	Node   string
+	Status int
+	Cause  types.ErrorCause
+}
+
+// Error returns the error message.
+func (e *TaskError) Error() string {
+	var b strings.Builder
+	b.WriteString("task ")
+	b.WriteString(e.TaskID)
+	switch {
+	case e.Cause != nil:
+		b.WriteString(" failed: ")
+		writeErrorCause(&b, e.Cause)
+	case e.Canceled != "":
+		b.WriteString(" canceled: ")
+		b.WriteString(e.Canceled)
+	default:
+		fmt.Fprintf(&b, " completed with %d failures", len(e.Failures))
+		if len(e.Failures) > 0 {
+			b.WriteString(", first: ")
+			writeErrorCause(&b, &e.Failures[0].Cause)
+		}
+	}
+	return b.String()
+}
+
+// WaitForTask polls the task until it completes, and returns the results.
+//
+//	res, _ := es.Reindex().Request(req).WaitForCompletion(false).Do(ctx)
+//	result, err := esutil.WaitForTask(ctx, esutil.TaskConfig{
+//	  Client: es,
+//	  TaskID: fmt.Sprint(res.Task),
+//	  OnProgress: func(p esutil.TaskProgress) {
+//	    log.Printf("%d/%d documents", p.Created+p.Updated+p.Deleted, p.Total)
+//	  },
+//	})
+//
+// When the task fails, is canceled, or reports failures in its response, the results
+// are returned with a *TaskError. When the context is cancelled, the context error
+// is returned, and the task is cancelled too when CancelOnContextDone is set.
+func WaitForTask(ctx context.Context, cfg TaskConfig) (*TaskResult, error) {
+	if cfg.Client == nil {
+		return nil, errors.New("missing client")
+	}
+	if cfg.TaskID == "" {
+		return nil, errors.New("missing task ID")
+	}
+	backoff := cfg.Backoff
+	if backoff == nil {
+		backoff = defaultAsyncBackoff
+	}
+
+	var progress *TaskProgress
+	for attempt := 1; ; attempt++ {
+		res, err := getTask(ctx, cfg.Client, cfg.TaskID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, cancelTask(ctx, cfg)
+			}
+			return nil, err
+		}
+
+		if res.Completed {
+			return res.result(cfg.TaskID)
+		}
+
+		if p := res.Task.progress(); progress == nil || !p.equal(*progress) {
+			progress = &p
+			if cfg.OnProgress != nil {
+				cfg.OnProgress(p)
+			}
+			if cfg.Progress != nil {
+				select {
+				case cfg.Progress <- p:
+				case <-ctx.Done():
+					return nil, cancelTask(ctx, cfg)
+				}
+			}
+		}
+
+		timer := time.NewTimer(backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, cancelTask(ctx, cfg)
+		case <-timer.C:
+		}
+	}
+}
+
+// cancelTask cancels the task, when configured, and returns the context error.
+func cancelTask(ctx context.Context, cfg TaskConfig) error {
+	if cfg.CancelOnContextDone {
+		cctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if res, err := taskcancel.New(cfg.Client).TaskId(cfg.TaskID).Perform(cctx); err == nil {
+			res.Body.Close()
+		}
+	}
+	return ctx.Err()
+}
+
+// taskResponse represents the response of the tasks/get API.
+//
+// The typed response doesn't decode the failures of the reindex,
+// update by query and delete by query tasks.
+type taskResponse struct {
+	Completed bool              `json:"completed"`
+	Error     *types.ErrorCause `json:"error"`
+	Response  json.RawMessage   `json:"response"`
+	Task      taskInfo          `json:"task"`
+}
+
+type taskInfo struct {
+	Action             string     `json:"action"`
+	Description        string     `json:"description"`
+	RunningTimeInNanos int64      `json:"running_time_in_nanos"`
+	Status             taskStatus `json:"status"`
+}
+
+type taskStatus struct {
+	Total                int64         `json:"total"`
+	Created              int64         `json:"created"`
+	Updated              int64         `json:"updated"`
+	Deleted              int64         `json:"deleted"`
+	Noops                int64         `json:"noops"`
+	VersionConflicts     int64         `json:"version_conflicts"`
+	Batches              int64         `json:"batches"`
+	Retries              types.Retries `json:"retries"`
+	RequestsPerSecond    float64       `json:"requests_per_second"`
+	ThrottledMillis      int64         `json:"throttled_millis"`
+	ThrottledUntilMillis int64         `json:"throttled_until_millis"`
+	Canceled             string        `json:"canceled"`
+}
+
+type taskFailure struct {
+	Index  string            `json:"index"`
+	ID     string            `json:"id"`
+	Shard  *int              `json:"shard"`
+	Node   string            `json:"node"`
+	Status int               `json:"status"`
+	Cause  *types.ErrorCause `json:"cause"`  // Bulk failures
+	Reason *types.ErrorCause `json:"reason"` // Search failures
+}
+
+func getTask(ctx context.Context, tp elastictransport.Interface, id string) (*taskResponse, error) {
+	res, err := taskget.New(tp).TaskId(id).Perform(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		e := types.NewElasticsearchError()
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil {
+			return nil, fmt.Errorf("get task: %s", res.Status)
+		}
+		return nil, e
+	}
+
+	var tr taskResponse
+	if err := json.NewDecoder(res.Body).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("cannot decode the task response: %s", err)
+	}
+	return &tr, nil
+}
+
+func (r *taskResponse) result(id string) (*TaskResult, error) {
+	result := TaskResult{
+		TaskID:      id,
+		Action:      r.Task.Action,
+		Description: r.Task.Description,
+		Progress:    r.Task.progress(),
+		Response:    r.Response,
+	}
+
+	if r.Error != nil {
+		return &result, &TaskError{TaskID: id, Cause: r.Error}
+	}
+
+	var resp struct {
+		Canceled string        `json:"canceled"`
+		Failures []taskFailure `json:"failures"`
+	}
+	if len(r.Response) > 0 {
+		if err := json.Unmarshal(r.Response, &resp); err != nil {
+			return &result, fmt.Errorf("cannot decode the task response: %s", err)
+		}
+	}
+	if resp.Canceled == "" {
+		resp.Canceled = r.Task.Status.Canceled
+	}
+	if resp.Canceled == "" && len(resp.Failures) == 0 {
+		return &result, nil
+	}
+
+	e := TaskError{TaskID: id, Canceled: resp.Canceled}
+	for _, f := range resp.Failures {
+		tf := TaskFailure{Index: f.Index, ID: f.ID, Shard: f.Shard, Node: f.Node, Status: f.Status}
+		if f.Cause != nil {
+			tf.Cause = *f.Cause
+		} else if f.Reason != nil {
+			tf.Cause = *f.Reason
+		}
+		e.Failures = append(e.Failures, tf)
+	}
+	return &result, &e
+}
+
+func (t taskInfo) progress() TaskProgress {
+	return TaskProgress{
+		Total:             t.Status.Total,
+		Created:           t.Status.Created,
+		Updated:           t.Status.Updated,
+		Deleted:           t.Status.Deleted,
+		Noops:             t.Status.Noops,
+		VersionConflicts:  t.Status.VersionConflicts,
+		Batches:           t.Status.Batches,
+		Retries:           t.Status.Retries,
+		RequestsPerSecond: t.Status.RequestsPerSecond,
+		Throttled:         time.Duration(t.Status.ThrottledMillis) * time.Millisecond,
+		ThrottledUntil:    time.Duration(t.Status.ThrottledUntilMillis) * time.Millisecond,
+		RunningTime:       time.Duration(t.RunningTimeInNanos),
+	}
+}
+
+// equal compares the progress, ignoring the running time.
+func (p TaskProgress) equal(other TaskProgress) bool {
+	other.RunningTime = p.RunningTime
+	return p == other
+}
+
+func writeErrorCause(b *strings.Builder, cause *types.ErrorCause) {
+	b.WriteString(cause.Type)
+	if cause.Reason != nil {
+		b.WriteString(": ")
+		b.WriteString(*cause.Reason)
+	}
+}
@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package esutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/estest"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func taskBody(completed bool, created, total int, response interface{}) map[string]interface{} {
+	body := map[string]interface{}{
+		"completed": completed,
+		"task": map[string]interface{}{
+			"node":                  "n1",
+			"id":                    1,
+			"action":                "indices:data/write/reindex",
+			"description":           "reindex from [a] to [b]",
+			"running_time_in_nanos": time.Now().UnixNano(),
+			"status": map[string]interface{}{
+				"total":            total,
+				"created":          created,
+				"batches":          created / 10,
+				"throttled_millis": 5,
+				"retries":          map[string]interface{}{"bulk": 1, "search": 0},
+			},
+		},
+	}
+	if response != nil {
+		body["response"] = response
+	}
+	return body
+}
+
+func TestWaitForTask(t *testing.T) {
+	t.Run("Progress", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, taskBody(false, 10, 30, nil))
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, taskBody(false, 10, 30, nil))
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, taskBody(false, 20, 30, nil))
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, taskBody(true, 30, 30, map[string]interface{}{"created": 30, "total": 30, "failures": []interface{}{}}))
+
+		ch := make(chan TaskProgress, 10)
+		var progress []int64
+		res, err := WaitForTask(context.Background(), TaskConfig{
+			Client:     mock,
+			TaskID:     "n1:1",
+			Backoff:    noAsyncBackoff,
+			OnProgress: func(p TaskProgress) { progress = append(progress, p.Created) },
+			Progress:   ch,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(progress) != 2 || progress[0] != 10 || progress[1] != 20 || len(ch) != 2 {
+			t.Errorf("Unexpected progress: %v", progress)
+		}
+		if p := res.Progress; p.Created != 30 || p.Batches != 3 || p.Throttled != 5*time.Millisecond || p.Retries.Bulk != 1 {
+			t.Errorf("Unexpected final progress: %+v", p)
+		}
+		var resp struct{ Created int }
+		if err := res.Decode(&resp); err != nil || resp.Created != 30 {
+			t.Errorf("Unexpected response: %+v, %v", resp, err)
+		}
+		if res.Action != "indices:data/write/reindex" {
+			t.Errorf("Unexpected action: %q", res.Action)
+		}
+		mock.AssertExpectations(t)
+	})
+
+	t.Run("Failures", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, taskBody(true, 1, 2, map[string]interface{}{
+			"created": 1,
+			"failures": []interface{}{
+				map[string]interface{}{"index": "b", "id": "2", "status": 400, "cause": map[string]interface{}{"type": "mapper_parsing_exception", "reason": "failed to parse"}},
+				map[string]interface{}{"index": "a", "shard": 0, "node": "n1", "reason": map[string]interface{}{"type": "search_context_missing_exception", "reason": "no context"}},
+			},
+		}))
+
+		res, err := WaitForTask(context.Background(), TaskConfig{Client: mock, TaskID: "n1:1"})
+		var e *TaskError
+		if !errors.As(err, &e) {
+			t.Fatalf("Expected *TaskError, got: %v", err)
+		}
+		if len(e.Failures) != 2 || e.Failures[0].Cause.Type != "mapper_parsing_exception" || e.Failures[1].Cause.Type != "search_context_missing_exception" || *e.Failures[1].Shard != 0 {
+			t.Errorf("Unexpected failures: %+v", e.Failures)
+		}
+		if err.Error() != "task n1:1 completed with 2 failures, first: mapper_parsing_exception: failed to parse" {
+			t.Errorf("Unexpected error message: %s", err)
+		}
+		if res == nil || res.Progress.Created != 1 {
+			t.Errorf("Expected the results with the error, got: %+v", res)
+		}
+	})
+
+	t.Run("Task error", func(t *testing.T) {
+		body := taskBody(true, 0, 0, nil)
+		body["error"] = map[string]interface{}{"type": "index_not_found_exception", "reason": "no such index [a]"}
+
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, body)
+
+		_, err := WaitForTask(context.Background(), TaskConfig{Client: mock, TaskID: "n1:1"})
+		var e *TaskError
+		if !errors.As(err, &e) || e.Cause.Type != "index_not_found_exception" {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err.Error() != "task n1:1 failed: index_not_found_exception: no such index [a]" {
+			t.Errorf("Unexpected error message: %s", err)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, taskBody(true, 0, 0, map[string]interface{}{"canceled": "by user request"}))
+
+		_, err := WaitForTask(context.Background(), TaskConfig{Client: mock, TaskID: "n1:1"})
+		var e *TaskError
+		if !errors.As(err, &e) || e.Canceled != "by user request" {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_tasks/n1:1").RespondError(404, "resource_not_found_exception", "task [n1:1] isn't running")
+
+		_, err := WaitForTask(context.Background(), TaskConfig{Client: mock, TaskID: "n1:1"})
+		var e *types.ElasticsearchError
+		if !errors.As(err, &e) || e.Status != 404 {
+			t.Fatalf("Unexpected error: %#v", err)
+		}
+	})
+
+	t.Run("Cancel on context done", func(t *testing.T) {
+		mock := estest.NewMockTransport()
+		mock.Expect("GET", "/_tasks/n1:1").Respond(200, taskBody(false, 10, 30, nil))
+		mock.Expect("POST", "/_tasks/n1:1/_cancel").Respond(200, map[string]interface{}{"nodes": map[string]interface{}{}})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, err := WaitForTask(ctx, TaskConfig{
+			Client:              mock,
+			TaskID:              "n1:1",
+			CancelOnContextDone: true,
+			Backoff:             func(int) time.Duration { return time.Hour },
+			OnProgress:          func(TaskProgress) { cancel() },
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got: %v", err)
+		}
+		mock.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,389 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+var (
+	defaultHedgingPercentile = 0.95
+	defaultHedgingDelay      = 100 * time.Millisecond
+	defaultHedgingMinSamples = 20
+	defaultHedgingSamples    = 1000
+)
+
+// HedgingConfig represents the configuration of hedged requests.
+//
+// When a read-only request doesn't receive a response within the delay, a duplicate
+// request is sent to another live node from the connection pool, and the first
+// successful response is returned, cancelling the other request.
+//
+// The delay is the configured percentile of the latency of the recent hedged
+// endpoint requests, bounded by MinDelay and MaxDelay. Use RequestOptions to
+// disable hedging for a single request.
+type HedgingConfig struct {
+	Percentile float64       // Percentile of the latency used as the delay. Default: 0.95.
+	Delay      time.Duration // Delay used until enough latency samples are collected. Default: 100ms.
+	MinDelay   time.Duration // Lower bound of the delay. Default: none.
+	MaxDelay   time.Duration // Upper bound of the delay. Default: none.
+
+	MinSamples int // Number of latency samples to compute the percentile. Default: 20.
+	Samples    int // Number of recent latency samples kept. Default: 1000.
+
+	// Optional function returning true for the requests to hedge. Default: IsHedgeable.
+	Hedgeable func(*http.Request) bool
+}
+
+// HedgingMetric represents the metric information for hedged requests.
+type HedgingMetric struct {
+	Requests int           `json:"requests"`
+	Hedged   int           `json:"hedged"`
+	Wins     int           `json:"wins"`
+	Delay    time.Duration `json:"delay"`
+}
+
+// String returns the hedging information as a string.
+func (m HedgingMetric) String() string {
+	return fmt.Sprintf("{requests=%d hedged=%d wins=%d delay=%s}", m.Requests, m.Hedged, m.Wins, m.Delay)
+}
+
+// IsHedgeable returns true for the search, count, get and multi get requests.
+//
+// Scroll requests are excluded, as the duplicate would advance or open a search context.
+func IsHedgeable(req *http.Request) bool {
+	if req.URL.Query().Get("scroll") != "" {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i, segment := range segments {
+		switch segment {
+		case "_search":
+			if i+1 < len(segments) && segments[i+1] == "scroll" {
+				return false
+			}
+			return req.Method == http.MethodGet || req.Method == http.MethodPost
+		case "_count", "_mget":
+			return req.Method == http.MethodGet || req.Method == http.MethodPost
+		case "_doc", "_source":
+			return req.Method == http.MethodGet || req.Method == http.MethodHead
+		}
+	}
+	return false
+}
+
+// hedger holds the hedging configuration and the latency samples.
+type hedger struct {
+	cfg HedgingConfig
+
+	mu       sync.Mutex
+	samples  []time.Duration
+	next     int
+	count    int
+	observed int
+	delay    time.Duration
+	requests int
+	hedged   int
+	wins     int
+}
+
+func newHedger(cfg *HedgingConfig) *hedger {
+	if cfg == nil {
+		return nil
+	}
+
+	h := hedger{cfg: *cfg}
+	if h.cfg.Percentile <= 0 || h.cfg.Percentile >= 1 {
+		h.cfg.Percentile = defaultHedgingPercentile
+	}
+	if h.cfg.Delay <= 0 {
+		h.cfg.Delay = defaultHedgingDelay
+	}
+	if h.cfg.MinSamples <= 0 {
+		h.cfg.MinSamples = defaultHedgingMinSamples
+	}
+	if h.cfg.Samples <= 0 {
+		h.cfg.Samples = defaultHedgingSamples
+	}
+	if h.cfg.Samples < h.cfg.MinSamples {
+		h.cfg.Samples = h.cfg.MinSamples
+	}
+	if h.cfg.Hedgeable == nil {
+		h.cfg.Hedgeable = IsHedgeable
+	}
+	h.samples = make([]time.Duration, h.cfg.Samples)
+	h.delay = h.bound(h.cfg.Delay)
+
+	return &h
+}
+
+// bound returns the delay within the configured bounds.
+func (h *hedger) bound(d time.Duration) time.Duration {
+	if h.cfg.MinDelay > 0 && d < h.cfg.MinDelay {
+		d = h.cfg.MinDelay
+	}
+	if h.cfg.MaxDelay > 0 && d > h.cfg.MaxDelay {
+		d = h.cfg.MaxDelay
+	}
+	return d
+}
+
+// currentDelay returns the delay before hedging a request.
+func (h *hedger) currentDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+// observe records the latency of a request, updating the delay periodically.
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % len(h.samples)
+	if h.count < len(h.samples) {
+		h.count++
+	}
+	h.observed++
+
+	// Compute the percentile every MinSamples observations
+	if h.count < h.cfg.MinSamples || h.observed%h.cfg.MinSamples != 0 {
+		return
+	}
+
+	sorted := make([]time.Duration, h.count)
+	copy(sorted, h.samples[:h.count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(math.Ceil(h.cfg.Percentile*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	h.delay = h.bound(sorted[idx])
+}
+
+func (h *hedger) metric() HedgingMetric {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HedgingMetric{Requests: h.requests, Hedged: h.hedged, Wins: h.wins, Delay: h.delay}
+}
+
+// roundTripper returns a transport recording the node selected for the hedged requests sent with next.
+func (h *hedger) roundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &hedgeTransport{next: next}
+}
+
+type hedgeNodeKey struct{}
+
+// hedgeNode holds the node of the primary request.
+type hedgeNode struct {
+	sync.Mutex
+	host string
+}
+
+func (n *hedgeNode) get() string {
+	n.Lock()
+	defer n.Unlock()
+	return n.host
+}
+
+// hedgeTransport records the node selected by the connection pool for the hedged requests.
+type hedgeTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip records the node and executes the request.
+func (t *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if n, ok := req.Context().Value(hedgeNodeKey{}).(*hedgeNode); ok {
+		n.Lock()
+		n.host = req.URL.Host
+		n.Unlock()
+	}
+	return t.next.RoundTrip(req)
+}
+
+type hedgeResult struct {
+	res     *http.Response
+	err     error
+	elapsed time.Duration
+	hedge   bool
+}
+
+// performHedged executes the request, sending a duplicate request to another node
+// when the response takes longer than the hedging delay.
+func (c *BaseClient) performHedged(req *http.Request, opts RequestOptions) (*http.Response, error) {
+	h := c.hedger
+
+	h.mu.Lock()
+	h.requests++
+	h.mu.Unlock()
+
+	// Buffer the body, so it can be sent twice
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	newRequest := func(ctx context.Context) *http.Request {
+		r := req.Clone(ctx)
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(body)), nil
+			}
+			r.ContentLength = int64(len(body))
+		}
+		return r
+	}
+
+	results := make(chan hedgeResult, 2)
+	perform := func(ctx context.Context, tp elastictransport.Interface, hedge bool) {
+		var (
+			res   *http.Response
+			err   error
+			start = time.Now()
+		)
+		if hedge {
+			res, err = c.performAttempt(tp, newRequest(ctx))
+		} else {
+			res, err = c.performWithRetry(newRequest(ctx), opts)
+		}
+		results <- hedgeResult{res: res, err: err, elapsed: time.Since(start), hedge: hedge}
+	}
+
+	primary := &hedgeNode{}
+	ctx, cancel := context.WithCancel(context.WithValue(req.Context(), hedgeNodeKey{}, primary))
+	cancels := map[bool]context.CancelFunc{false: cancel}
+	go perform(ctx, nil, false)
+
+	timer := time.NewTimer(h.currentDelay())
+	defer timer.Stop()
+
+	var (
+		pending = 1
+		first   *hedgeResult
+	)
+	for {
+		select {
+		case <-timer.C:
+			if tp := c.hedgeTransport(primary.get()); tp != nil {
+				h.mu.Lock()
+				h.hedged++
+				h.mu.Unlock()
+
+				ctx, cancel := context.WithCancel(req.Context())
+				cancels[true] = cancel
+				pending++
+				go perform(ctx, tp, true)
+			}
+		case r := <-results:
+			pending--
+
+			// Wait for the other request when the first one fails
+			if r.err != nil && pending > 0 {
+				first = &r
+				continue
+			}
+
+			// Return the error of the first request when both fail
+			if r.err != nil && first != nil {
+				r = *first
+			}
+
+			if r.err == nil {
+				h.observe(r.elapsed)
+				if r.hedge {
+					h.mu.Lock()
+					h.wins++
+					h.mu.Unlock()
+				}
+			}
+
+			// Cancel the other request, and release its response if any
+			for hedge, cancel := range cancels {
+				if hedge != r.hedge {
+					cancel()
+				}
+			}
+			if pending > 0 {
+				go func() {
+					if loser := <-results; loser.res != nil && loser.res.Body != nil {
+						loser.res.Body.Close()
+					}
+				}()
+			}
+
+			// Release the context of the returned request once the response body is consumed
+			if r.res != nil && r.res.Body != nil {
+				r.res.Body = &cancelBody{ReadCloser: r.res.Body, cancel: cancels[r.hedge]}
+			} else {
+				cancels[r.hedge]()
+			}
+
+			return r.res, r.err
+		}
+	}
+}
+
+// hedgeTransport returns the transport for a live node other than the node at host,
+// or nil when there is no other node.
+func (c *BaseClient) hedgeTransport(host string) elastictransport.Interface {
+	tp, ok := c.Transport.(*elastictransport.Client)
+	if !ok {
+		return nil
+	}
+
+	urls := tp.URLs()
+	if len(urls) < 2 {
+		return nil
+	}
+
+	// Start from a random position, so the duplicate requests are spread across the nodes
+	offset := int(time.Now().UnixNano() % int64(len(urls)))
+	for i := range urls {
+		u := urls[(offset+i)%len(urls)]
+		if u.Host == host {
+			continue
+		}
+		ntp, err := c.nodeTransport(u.String())
+		if err != nil {
+			continue
+		}
+		return ntp
+	}
+	return nil
+}
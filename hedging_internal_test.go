@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIsHedgeable(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{"POST", "/test/_search", true},
+		{"GET", "/_search", true},
+		{"GET", "/test/_count", true},
+		{"POST", "/_mget", true},
+		{"GET", "/test/_doc/1", true},
+		{"HEAD", "/test/_doc/1", true},
+		{"GET", "/test/_source/1", true},
+		{"PUT", "/test/_doc/1", false},
+		{"DELETE", "/test/_doc/1", false},
+		{"POST", "/_search/scroll", false},
+		{"POST", "/test/_search?scroll=1m", false},
+		{"POST", "/_bulk", false},
+		{"GET", "/", false},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		if got := IsHedgeable(req); got != tt.want {
+			t.Errorf("Unexpected result for %s %s: %v, want: %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestHedging(t *testing.T) {
+	// The first request is slow, whichever node receives it
+	newServers := func(requests *int32, cancelled chan<- struct{}, bodies chan<- string) (*httptest.Server, *httptest.Server) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if bodies != nil {
+				bodies <- string(body)
+			}
+			if atomic.AddInt32(requests, 1) == 1 {
+				select {
+				case <-r.Context().Done():
+					cancelled <- struct{}{}
+					return
+				case <-time.After(300 * time.Millisecond):
+				}
+			}
+			w.Header().Set("X-Elastic-Product", "Elasticsearch")
+			w.Write([]byte("{}"))
+		})
+		return httptest.NewServer(handler), httptest.NewServer(handler)
+	}
+
+	t.Run("Hedged request", func(t *testing.T) {
+		var requests int32
+		cancelled, bodies := make(chan struct{}, 1), make(chan string, 2)
+		s1, s2 := newServers(&requests, cancelled, bodies)
+		defer s1.Close()
+		defer s2.Close()
+
+		c, _ := NewClient(Config{
+			Addresses: []string{s1.URL, s2.URL},
+			Hedging:   &HedgingConfig{Delay: 20 * time.Millisecond},
+		})
+
+		start := time.Now()
+		res, err := c.Search(c.Search.WithBody(strings.NewReader(`{"query":{"match_all":{}}}`)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		if d := time.Since(start); d >= 300*time.Millisecond {
+			t.Errorf("Expected the hedged request to return first, took: %s", d)
+		}
+
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Errorf("Expected the slow request to be cancelled")
+		}
+
+		for i := 0; i < 2; i++ {
+			if body := <-bodies; body != `{"query":{"match_all":{}}}` {
+				t.Errorf("Unexpected body: %q", body)
+			}
+		}
+
+		m := c.ClientMetrics()
+		if m.Hedging == nil || m.Hedging.Requests != 1 || m.Hedging.Hedged != 1 || m.Hedging.Wins != 1 {
+			t.Errorf("Unexpected metrics: %s", m)
+		}
+	})
+
+	t.Run("Disabled for request", func(t *testing.T) {
+		var requests int32
+		s1, s2 := newServers(&requests, make(chan struct{}, 1), nil)
+		defer s1.Close()
+		defer s2.Close()
+
+		c, _ := NewClient(Config{
+			Addresses: []string{s1.URL, s2.URL},
+			Hedging:   &HedgingConfig{Delay: 20 * time.Millisecond},
+		})
+
+		ctx := WithRequestOptions(context.Background(), RequestOptions{DisableHedging: true})
+		start := time.Now()
+		res, err := c.Search(c.Search.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		if d := time.Since(start); d < 300*time.Millisecond {
+			t.Errorf("Expected the request not to be hedged, took: %s", d)
+		}
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Errorf("Unexpected number of requests: %d", n)
+		}
+	})
+
+	t.Run("Single node", func(t *testing.T) {
+		var requests int32
+		s1, s2 := newServers(&requests, make(chan struct{}, 1), nil)
+		defer s1.Close()
+		s2.Close()
+
+		c, _ := NewClient(Config{
+			Addresses: []string{s1.URL},
+			Hedging:   &HedgingConfig{Delay: 20 * time.Millisecond},
+		})
+
+		res, err := c.Count()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		m := c.ClientMetrics()
+		if m.Hedging.Hedged != 0 {
+			t.Errorf("Unexpected metrics: %s", m)
+		}
+	})
+}
+
+func TestHedgerDelay(t *testing.T) {
+	h := newHedger(&HedgingConfig{MinSamples: 10, MaxDelay: 80 * time.Millisecond})
+
+	if d := h.currentDelay(); d != 80*time.Millisecond {
+		t.Errorf("Unexpected initial delay: %s", d)
+	}
+
+	for i := 1; i <= 10; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	if d := h.currentDelay(); d != 10*time.Millisecond {
+		t.Errorf("Unexpected delay: %s", d)
+	}
+
+	for i := 0; i < 10; i++ {
+		h.observe(time.Second)
+	}
+	if d := h.currentDelay(); d != 80*time.Millisecond {
+		t.Errorf("Unexpected delay: %s", d)
+	}
+}
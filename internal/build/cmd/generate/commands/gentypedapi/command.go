@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gentypedapi
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/go-elasticsearch/v8/internal/build/cmd"
+	"github.com/elastic/go-elasticsearch/v8/internal/build/utils"
+)
+
+var (
+	input  *string
+	output *string
+	gofmt  *bool
+)
+
+func init() {
+	input = gentypedapiCmd.Flags().StringP("input", "i", "", "Path to the typed API generated from the elasticsearch-specification")
+	output = gentypedapiCmd.Flags().StringP("output", "o", "", "Path to a folder for generated output")
+	gofmt = gentypedapiCmd.Flags().BoolP("gofmt", "f", true, "Format generated output with 'gofmt'")
+
+	gentypedapiCmd.MarkFlagRequired("input")
+	gentypedapiCmd.MarkFlagRequired("output")
+	gentypedapiCmd.Flags().SortFlags = false
+
+	cmd.RegisterCmd(gentypedapiCmd)
+}
+
+var gentypedapiCmd = &cobra.Command{
+	Use:   "typedapi",
+	Short: "Generate the typed API endpoints from the output of the elasticsearch-specification generator",
+	Run: func(cmd *cobra.Command, args []string) {
+		command := &Command{
+			Input:  *input,
+			Output: *output,
+			Gofmt:  *gofmt,
+		}
+		err := command.Execute()
+		if err != nil {
+			utils.PrintErr(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// Command represents the "gentypedapi" command.
+//
+type Command struct {
+	Input  string
+	Output string
+	Gofmt  bool
+}
+
+// Execute runs the command.
+//
+// The endpoints found in Input are written to the same relative path in Output
+// with the client specific templates applied; the other files are left untouched.
+//
+func (cmd *Command) Execute() (err error) {
+	stats := struct {
+		n     int
+		start time.Time
+	}{start: time.Now()}
+
+	err = filepath.Walk(cmd.Input, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !strings.HasSuffix(fpath, ".go") || strings.HasSuffix(fpath, "_test.go") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(cmd.Input, fpath)
+		if err != nil {
+			return err
+		}
+
+		src, err := ioutil.ReadFile(fpath)
+		if err != nil {
+			return err
+		}
+
+		gen := Generator{Source: src}
+
+		var out io.Reader
+		if cmd.Gofmt {
+			out, err = gen.OutputFormatted()
+		} else {
+			out, err = gen.Output()
+		}
+		if err == ErrNotEndpoint {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error generating output for %q: %s", rel, err)
+		}
+
+		fName := filepath.Join(cmd.Output, rel)
+		if err := os.MkdirAll(filepath.Dir(fName), 0775); err != nil {
+			return fmt.Errorf("error creating directory: %s", err)
+		}
+
+		f, err := os.OpenFile(fName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("error creating file: %s", err)
+		}
+		_, err = io.Copy(f, out)
+		if err != nil {
+			return fmt.Errorf("error copying output: %s", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("error closing file: %s", err)
+		}
+
+		stats.n++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if utils.IsTTY() {
+		fmt.Fprint(os.Stderr, "\x1b[2m")
+	}
+	fmt.Fprintln(os.Stderr, strings.Repeat("━", utils.TerminalWidth()))
+	fmt.Fprintf(os.Stderr, "Processed %d endpoints in %s\n", stats.n, time.Since(stats.start).Truncate(time.Millisecond))
+	if utils.IsTTY() {
+		fmt.Fprint(os.Stderr, "\x1b[0m")
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gentypedapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	reHttpRequest = regexp.MustCompile(`func \(r \*(\w+)\) HttpRequest\(ctx context\.Context\)`)
+	reStructField = regexp.MustCompile(`(?m)^\ttransport elastictransport\.Interface\n`)
+	reNewField    = regexp.MustCompile(`(?m)^\t\ttransport:\s+tp,\n`)
+	reJSONImport  = regexp.MustCompile(`(?m)^\t"encoding/json"\n`)
+	reJSONUsage   = regexp.MustCompile(`\bjson\.`)
+	reTpImport    = regexp.MustCompile(`(?m)^\t"github.com/elastic/elastic-transport-go/v8/elastictransport"\n`)
+
+	reBufField   = regexp.MustCompile(`(?m)^\tbuf \*gobytes\.Buffer\n\n`)
+	reBufNew     = regexp.MustCompile(`(?m)^\t\tbuf:\s+gobytes\.NewBuffer\(nil\),\n`)
+	rePathField  = regexp.MustCompile(`(?m)^\tpath\s+url\.URL\n`)
+	reBuilderVar = regexp.MustCompile(`(?m)^\tvar path strings\.Builder\n`)
+	reErrVar     = regexp.MustCompile(`(?m)^\tvar err error\n`)
+)
+
+var serializerTmpl = template.Must(template.New("serializer").Parse(`
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *{{ .Name }}) Serializer(s serializer.Serializer) *{{ .Name }} {
+	r.serializer = s
+
+	return r
+}
+`))
+
+var cloneTmpl = template.Must(template.New("clone").Parse(`
+// Clone returns a copy of the {{ .Name }} request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *{{ .Name }}) Clone() *{{ .Name }} {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+`))
+
+// ErrNotEndpoint is returned for the source files which don't define an endpoint.
+var ErrNotEndpoint = errors.New("not an endpoint")
+
+// Generator represents the "gentypedapi" generator.
+//
+// It applies the client specific templates to an endpoint of the typed API,
+// as generated from the elasticsearch-specification.
+type Generator struct {
+	Source []byte
+
+	name string
+}
+
+// Output returns the generator output.
+func (g *Generator) Output() (io.Reader, error) {
+	m := reHttpRequest.FindSubmatch(g.Source)
+	if m == nil {
+		return nil, ErrNotEndpoint
+	}
+	g.name = string(m[1])
+
+	src, err := g.genReusable(string(g.Source))
+	if err != nil {
+		return nil, err
+	}
+
+	if reJSONImport.MatchString(src) {
+		if src, err = g.genSerializer(src); err != nil {
+			return nil, err
+		}
+	}
+
+	return strings.NewReader(src), nil
+}
+
+// OutputFormatted returns a formatted generator output.
+func (g *Generator) OutputFormatted() (io.Reader, error) {
+	out, err := g.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, out); err != nil {
+		return nil, err
+	}
+
+	fout, err := format.Source(b.Bytes())
+	if err != nil {
+		return bytes.NewReader(b.Bytes()), err
+	}
+
+	return bytes.NewReader(fout), nil
+}
+
+// genReusable builds the body and the URL of the request in HttpRequest, instead
+// of the fields of the endpoint, and adds the Clone method, so that an endpoint
+// can be executed several times and concurrently.
+func (g *Generator) genReusable(src string) (string, error) {
+	if !reBufField.MatchString(src) || !reBufNew.MatchString(src) || !rePathField.MatchString(src) ||
+		len(reBuilderVar.FindAllString(src, -1)) != 1 || len(reErrVar.FindAllString(src, -1)) != 1 {
+		return src, fmt.Errorf("cannot make %s reusable: unexpected source", g.name)
+	}
+
+	src = reBufField.ReplaceAllString(src, "")
+	src = reBufNew.ReplaceAllString(src, "")
+	src = rePathField.ReplaceAllString(src, "")
+	src = reBuilderVar.ReplaceAllString(src, "$0\tvar u url.URL\n")
+	src = reErrVar.ReplaceAllString(src, "$0\n\tbuf := gobytes.NewBuffer(nil)\n")
+	src = strings.Replace(src, "r.buf", "buf", -1)
+	src = strings.Replace(src, "r.path.", "u.", -1)
+
+	return g.insertAfterHeader(src, cloneTmpl)
+}
+
+// genSerializer replaces encoding/json with the serializer of the request,
+// and adds the field, its initialization from the transport and the setter.
+func (g *Generator) genSerializer(src string) (string, error) {
+	if !reStructField.MatchString(src) || !reNewField.MatchString(src) || !reTpImport.MatchString(src) {
+		return src, fmt.Errorf("cannot add the serializer to %s: unexpected source", g.name)
+	}
+
+	src = reStructField.ReplaceAllString(src, "\ttransport elastictransport.Interface\n\tserializer serializer.Serializer\n")
+	src = reNewField.ReplaceAllString(src, "\t\ttransport: tp,\n\t\tserializer: serializer.FromTransport(tp),\n")
+	src = strings.Replace(src, "json.Marshal(r.req)", "r.serializer.Marshal(r.req)", -1)
+	src = strings.Replace(src, "json.NewDecoder(", "r.serializer.NewDecoder(", -1)
+
+	src = reTpImport.ReplaceAllString(src, "$0\t\"github.com/elastic/go-elasticsearch/v8/typedapi/serializer\"\n")
+	if !reJSONUsage.MatchString(src) {
+		src = reJSONImport.ReplaceAllString(src, "")
+	}
+
+	return g.insertAfterHeader(src, serializerTmpl)
+}
+
+// insertAfterHeader renders the template after the Header method of the endpoint.
+func (g *Generator) insertAfterHeader(src string, tmpl *template.Template) (string, error) {
+	sig := fmt.Sprintf("func (r *%s) Header(key, value string) *%s {", g.name, g.name)
+	i := strings.Index(src, sig)
+	if i < 0 {
+		return src, fmt.Errorf("cannot find the Header method of %s", g.name)
+	}
+	j := strings.Index(src[i:], "\n}\n")
+	if j < 0 {
+		return src, fmt.Errorf("cannot find the end of the Header method of %s", g.name)
+	}
+	j += i + len("\n}\n")
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, struct{ Name string }{g.name}); err != nil {
+		return src, err
+	}
+
+	return src[:j] + b.String() + src[j:], nil
+}
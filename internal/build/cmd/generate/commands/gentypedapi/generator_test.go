@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package gentypedapi_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/internal/build/cmd/generate/commands/gentypedapi"
+)
+
+func TestGenerator(t *testing.T) {
+	t.Run("Output", func(t *testing.T) {
+		src, err := ioutil.ReadFile("testdata/info.go")
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		gen := gentypedapi.Generator{Source: src}
+
+		out, err := gen.OutputFormatted()
+		if err != nil {
+			t.Fatalf("Error generating output for %q: %s", "testdata/info.go", err)
+		}
+
+		s, err := ioutil.ReadAll(out)
+		if err != nil {
+			t.Fatalf("Error reading output: %s", err)
+		}
+		// t.Logf("\n%s\n", s)
+
+		for _, want := range []string{
+			"serializer: serializer.FromTransport(tp),",
+			"err = r.serializer.NewDecoder(res.Body).Decode(response)",
+			"func (r *Info) Serializer(s serializer.Serializer) *Info {",
+			"buf := gobytes.NewBuffer(nil)",
+			"req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)",
+			"func (r *Info) Clone() *Info {",
+		} {
+			if !strings.Contains(string(s), want) {
+				t.Errorf("Expected output to contain %q", want)
+			}
+		}
+		if strings.Contains(string(s), `"encoding/json"`) {
+			t.Error("Expected encoding/json to be removed from the imports")
+		}
+		if strings.Contains(string(s), "r.buf") || strings.Contains(string(s), "r.path") {
+			t.Error("Expected the request to be built without the fields of the endpoint")
+		}
+	})
+
+	t.Run("NotEndpoint", func(t *testing.T) {
+		gen := gentypedapi.Generator{Source: []byte("package types\n")}
+
+		if _, err := gen.Output(); err != gentypedapi.ErrNotEndpoint {
+			t.Errorf("Expected ErrNotEndpoint, got: %v", err)
+		}
+	})
+}
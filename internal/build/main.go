@@ -24,6 +24,7 @@ import (
 	_ "github.com/elastic/go-elasticsearch/v8/internal/build/cmd/generate/commands/gensource"
 	_ "github.com/elastic/go-elasticsearch/v8/internal/build/cmd/generate/commands/genstruct"
 	_ "github.com/elastic/go-elasticsearch/v8/internal/build/cmd/generate/commands/gentests"
+	_ "github.com/elastic/go-elasticsearch/v8/internal/build/cmd/generate/commands/gentypedapi"
 	_ "github.com/elastic/go-elasticsearch/v8/internal/build/cmd/tools/commands/spec"
 )
 
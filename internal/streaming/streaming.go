@@ -0,0 +1,196 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package streaming decodes the large search responses incrementally.
+package streaming
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// DecodeResponse decodes the search response res into response with the serializer s,
+// calling fn with each hit instead of collecting them, and closes the response body.
+//
+// It returns an *types.ElasticsearchError for the error responses, like the Do method
+// of the typed API endpoints; the Stream method of the search and scroll endpoints use it.
+func DecodeResponse(res *http.Response, s serializer.Serializer, response interface{}, fn func(types.Hit) error) error {
+	defer res.Body.Close()
+
+	if res.StatusCode < 299 {
+		body, err := DecodeHits(res.Body, func(raw json.RawMessage) error {
+			hit := types.NewHit()
+			if err := s.NewDecoder(bytes.NewReader(raw)).Decode(hit); err != nil {
+				return err
+			}
+			return fn(*hit)
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.NewDecoder(bytes.NewReader(body)).Decode(response)
+	}
+
+	errorResponse := types.NewElasticsearchError()
+	if err := s.NewDecoder(res.Body).Decode(errorResponse); err != nil {
+		return err
+	}
+
+	return errorResponse
+}
+
+// DecodeHits reads the search response from r, calling fn with each element of the
+// hits.hits array as soon as it's decoded, and returns the response without these elements.
+//
+// Only one hit is held in memory at a time; the other fields, eg. the aggregations,
+// are returned unchanged to be decoded into the response type.
+func DecodeHits(r io.Reader, fn func(json.RawMessage) error) ([]byte, error) {
+	dec := json.NewDecoder(r)
+	var out bytes.Buffer
+
+	err := decodeObject(dec, &out, func(key string) error {
+		if key != "hits" {
+			return copyValue(dec, &out)
+		}
+
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			out.WriteString("null")
+			return nil
+		}
+		if tok != json.Delim('{') {
+			return fmt.Errorf("unexpected token %v for hits", tok)
+		}
+
+		out.WriteByte('{')
+		err = decodeFields(dec, &out, func(key string) error {
+			if key != "hits" {
+				return copyValue(dec, &out)
+			}
+			return decodeArray(dec, fn, &out)
+		})
+		if err != nil {
+			return err
+		}
+		out.WriteByte('}')
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// decodeObject decodes an object, calling fn to decode the value of each key.
+func decodeObject(dec *json.Decoder, out *bytes.Buffer, fn func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("unexpected token %v, expected an object", tok)
+	}
+
+	out.WriteByte('{')
+	if err := decodeFields(dec, out, fn); err != nil {
+		return err
+	}
+	out.WriteByte('}')
+	return nil
+}
+
+// decodeFields decodes the fields of an object up to the closing delimiter.
+func decodeFields(dec *json.Decoder, out *bytes.Buffer, fn func(key string) error) error {
+	for i := 0; dec.More(); i++ {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v, expected a key", tok)
+		}
+
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		out.Write(k)
+		out.WriteByte(':')
+
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+
+	// Closing delimiter
+	_, err := dec.Token()
+	return err
+}
+
+// decodeArray calls fn with each element of the array, and writes an empty array.
+func decodeArray(dec *json.Decoder, fn func(json.RawMessage) error, out *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		out.WriteString("null")
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("unexpected token %v, expected an array", tok)
+	}
+
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+
+	// Closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	out.WriteString("[]")
+	return nil
+}
+
+// copyValue copies the next value to out.
+func copyValue(dec *json.Decoder, out *bytes.Buffer) error {
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	out.Write(raw)
+	return nil
+}
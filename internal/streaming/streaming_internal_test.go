@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package streaming
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+func TestDecodeHits(t *testing.T) {
+	t.Run("Hits", func(t *testing.T) {
+		body := `{"took":5,"hits":{"total":{"value":3,"relation":"eq"},"hits":[{"_id":"1"},{"_id":"2"},{"_id":"3"}],"max_score":1.0},"aggregations":{"avg#price":{"value":10}}}`
+
+		var ids []string
+		rest, err := DecodeHits(strings.NewReader(body), func(raw json.RawMessage) error {
+			var hit struct {
+				ID string `json:"_id"`
+			}
+			err := json.Unmarshal(raw, &hit)
+			ids = append(ids, hit.ID)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if strings.Join(ids, ",") != "1,2,3" {
+			t.Errorf("Unexpected hits: %v", ids)
+		}
+		expected := `{"took":5,"hits":{"total":{"value":3,"relation":"eq"},"hits":[],"max_score":1.0},"aggregations":{"avg#price":{"value":10}}}`
+		if string(rest) != expected {
+			t.Errorf("Unexpected response:\n%s\nwant:\n%s", rest, expected)
+		}
+	})
+
+	t.Run("Without hits", func(t *testing.T) {
+		body := `{"_scroll_id":"abc","hits":null}`
+
+		rest, err := DecodeHits(strings.NewReader(body), func(json.RawMessage) error {
+			t.Errorf("Unexpected hit")
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if string(rest) != body {
+			t.Errorf("Unexpected response: %s", rest)
+		}
+	})
+
+	t.Run("Callback error", func(t *testing.T) {
+		body := `{"hits":{"hits":[{"_id":"1"},{"_id":"2"}]}}`
+		stop := errors.New("stop")
+
+		var n int
+		_, err := DecodeHits(strings.NewReader(body), func(json.RawMessage) error {
+			n++
+			return stop
+		})
+		if err != stop || n != 1 {
+			t.Errorf("Expected the decoding to stop, got: %v after %d hits", err, n)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, body := range []string{`[]`, `{"hits":{"hits":[{"_id":"1"}`, `{"hits":"foo"}`} {
+			if _, err := DecodeHits(strings.NewReader(body), func(json.RawMessage) error { return nil }); err == nil {
+				t.Errorf("Expected error for %s", body)
+			}
+		}
+	})
+}
+
+func TestDecodeResponse(t *testing.T) {
+	t.Run("Response", func(t *testing.T) {
+		res := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"took":5,"hits":{"hits":[{"_id":"1","_index":"test"},{"_id":"2","_index":"test"}]}}`)),
+		}
+
+		var (
+			ids      []string
+			response struct {
+				Took int `json:"took"`
+			}
+		)
+		err := DecodeResponse(res, serializer.JSON{}, &response, func(hit types.Hit) error {
+			ids = append(ids, hit.Id_)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if strings.Join(ids, ",") != "1,2" || response.Took != 5 {
+			t.Errorf("Unexpected response: %v, %+v", ids, response)
+		}
+	})
+
+	t.Run("Error response", func(t *testing.T) {
+		res := &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"error":{"type":"index_not_found_exception","reason":"no such index"},"status":404}`)),
+		}
+
+		err := DecodeResponse(res, serializer.JSON{}, &struct{}{}, func(types.Hit) error { return nil })
+		if e, ok := err.(*types.ElasticsearchError); !ok || e.Status != 404 {
+			t.Errorf("Expected an ElasticsearchError, got: %#v", err)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"strings"
+)
+
+// ClientMetrics represents the metrics collected by the client itself,
+// in addition to the transport metrics returned by Metrics.
+type ClientMetrics struct {
+	CircuitBreakers []CircuitBreakerMetric `json:"circuit_breakers,omitempty"`
+	RateLimits      []RateLimitMetric      `json:"rate_limits,omitempty"`
+	Retries         *RetryMetric           `json:"retries,omitempty"`
+	Hedging         *HedgingMetric         `json:"hedging,omitempty"`
+	Warnings        *WarningsMetric        `json:"warnings,omitempty"`
+	Compression     *CompressionMetric     `json:"compression,omitempty"`
+}
+
+// String returns the metrics as a string.
+func (m ClientMetrics) String() string {
+	var (
+		b     strings.Builder
+		empty = true
+	)
+	b.WriteString("{")
+
+	field := func(name string) {
+		if !empty {
+			b.WriteString(" ")
+		}
+		empty = false
+		b.WriteString(name)
+		b.WriteString(": ")
+	}
+
+	if len(m.CircuitBreakers) > 0 {
+		field("CircuitBreakers")
+		b.WriteString("[")
+		for i, cb := range m.CircuitBreakers {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(cb.String())
+		}
+		b.WriteString("]")
+	}
+
+	if len(m.RateLimits) > 0 {
+		field("RateLimits")
+		b.WriteString("[")
+		for i, rl := range m.RateLimits {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(rl.String())
+		}
+		b.WriteString("]")
+	}
+
+	if m.Retries != nil {
+		field("Retries")
+		b.WriteString(m.Retries.String())
+	}
+
+	if m.Hedging != nil {
+		field("Hedging")
+		b.WriteString(m.Hedging.String())
+	}
+
+	if m.Warnings != nil {
+		field("Warnings")
+		b.WriteString(m.Warnings.String())
+	}
+
+	if m.Compression != nil {
+		field("Compression")
+		b.WriteString(m.Compression.String())
+	}
+
+	b.WriteString("}")
+	return b.String()
+}
+
+// ClientMetrics returns the metrics collected by the client for the circuit breakers,
+// the rate limits, the retries, the hedging, the deprecation warnings and the response compression.
+//
+// Only the enabled features are reported.
+func (c *BaseClient) ClientMetrics() ClientMetrics {
+	var m ClientMetrics
+
+	if c.breakers != nil {
+		m.CircuitBreakers = c.breakers.metrics()
+	}
+
+	if c.limiter != nil {
+		m.RateLimits = c.limiter.metrics()
+	}
+
+	if !c.retry.disableRetry && c.retry.metrics != nil {
+		rm := c.retry.metrics.metric()
+		m.Retries = &rm
+	}
+
+	if c.hedger != nil {
+		hm := c.hedger.metric()
+		m.Hedging = &hm
+	}
+
+	if c.warnings != nil {
+		wm := c.warnings.metric()
+		m.Warnings = &wm
+	}
+
+	if c.decompress != nil {
+		cm := c.decompress.metric()
+		m.Compression = &cm
+	}
+
+	return m
+}
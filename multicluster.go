@@ -0,0 +1,797 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
+)
+
+var (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultFailoverStatuses    = [...]int{502, 503, 504}
+
+	latencyDecay = 0.2
+)
+
+// RoutingPolicy defines how the requests are routed to the clusters of a multi-cluster client.
+type RoutingPolicy int
+
+// The routing policies.
+const (
+	// RouteFailover sends the request to the first healthy cluster in the configured order,
+	// and fails over to the next clusters when the request fails.
+	RouteFailover RoutingPolicy = iota
+	// RouteNearest sends the request to the healthy cluster with the lowest latency,
+	// and fails over to the next nearest clusters when the request fails.
+	RouteNearest
+	// RouteAll sends the request to all the healthy clusters, and returns the response
+	// of the first cluster in the configured order, as soon as it's received; the requests
+	// to the other clusters complete in the background. Only valid for write requests.
+	RouteAll
+)
+
+// String returns the policy as a string.
+func (p RoutingPolicy) String() string {
+	switch p {
+	case RouteFailover:
+		return "failover"
+	case RouteNearest:
+		return "nearest"
+	case RouteAll:
+		return "all"
+	default:
+		return fmt.Sprintf("RoutingPolicy(%d)", int(p))
+	}
+}
+
+// ClusterConfig represents the configuration of a cluster in a multi-cluster client.
+type ClusterConfig struct {
+	Name   string // Name of the cluster, used in the health information. Default: the position in the list.
+	Config Config // Configuration of the client for the cluster.
+}
+
+// MultiClusterConfig represents the configuration of a multi-cluster client.
+//
+// A cluster is marked unhealthy when a request fails with an error, or with one
+// of the failover statuses, and healthy again when a request or a health check succeeds.
+// Unhealthy clusters are only used when no healthy cluster is available.
+//
+// The scroll and point in time requests are sent to the cluster which returned the scroll
+// or point in time ID, regardless of the policy, as the ID is only valid for that cluster.
+type MultiClusterConfig struct {
+	Clusters []ClusterConfig // Clusters in the order of preference, starting with the primary cluster.
+
+	ReadPolicy  RoutingPolicy // Routing policy for read requests. Default: RouteFailover.
+	WritePolicy RoutingPolicy // Routing policy for write requests. Default: RouteFailover.
+
+	// Optional function returning true for read requests.
+	// Default: GET and HEAD requests, and the read-only requests with a body, see IsReadRequest.
+	IsRead func(*http.Request) bool
+
+	FailoverStatuses []int // Response statuses which fail the request over to the next cluster. Default: 502, 503, 504.
+
+	// Fail the write requests over to the next cluster as well. Default: false, as a failed
+	// write request could still have been applied, eg. after a timeout, and sending it again
+	// to another cluster could duplicate the documents.
+	FailoverWrites bool
+
+	HealthCheckInterval time.Duration // Interval between cluster health checks. Default: 10s.
+	HealthCheckTimeout  time.Duration // Timeout of a cluster health check. Default: 5s.
+	DisableHealthCheck  bool          // Disable the periodic cluster health checks.
+
+	// Optional function called when a request to a secondary cluster fails with RouteAll;
+	// the error of the first cluster is returned to the caller.
+	OnWriteError func(cluster string, err error)
+}
+
+// ClusterStatus represents the health information for a cluster of a multi-cluster client.
+type ClusterStatus struct {
+	Name      string        `json:"name"`
+	Healthy   bool          `json:"healthy"`
+	Status    string        `json:"status,omitempty"` // Status returned by the last health check: green, yellow or red.
+	Latency   time.Duration `json:"latency"`          // Moving average of the request latency.
+	Failures  int           `json:"failures"`         // Number of consecutive failures.
+	LastError string        `json:"last_error,omitempty"`
+	CheckedAt *time.Time    `json:"checked_at,omitempty"`
+}
+
+// BaseMultiClient represents the routing of the requests across the clusters of a multi-cluster client.
+type BaseMultiClient struct {
+	clusters []*cluster
+
+	readPolicy       RoutingPolicy
+	writePolicy      RoutingPolicy
+	isRead           func(*http.Request) bool
+	failoverStatuses []int
+	failoverWrites   bool
+	onWriteError     func(string, error)
+	pins             clusterPins
+
+	healthCheckTimeout time.Duration
+	done               chan struct{}
+	closeOnce          sync.Once
+}
+
+// MultiClient represents a multi-cluster client with the Elasticsearch API.
+type MultiClient struct {
+	*BaseMultiClient
+	*esapi.API
+}
+
+// TypedMultiClient represents a multi-cluster client with the Typed API.
+type TypedMultiClient struct {
+	*BaseMultiClient
+	*typedapi.API
+}
+
+// NewMultiClient creates a new multi-cluster client with the configuration from cfg.
+//
+// Call Close to stop the health checks when the client is no longer used.
+func NewMultiClient(cfg MultiClusterConfig) (*MultiClient, error) {
+	c, err := newBaseMultiClient(cfg, func(cfg Config) (*BaseClient, error) {
+		client, err := NewClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &client.BaseClient, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MultiClient{BaseMultiClient: c, API: esapi.New(c)}, nil
+}
+
+// NewTypedMultiClient creates a new multi-cluster client with the configuration from cfg.
+//
+// This version uses the same configuration as NewMultiClient.
+//
+// It will return the client with the TypedAPI.
+func NewTypedMultiClient(cfg MultiClusterConfig) (*TypedMultiClient, error) {
+	c, err := newBaseMultiClient(cfg, func(cfg Config) (*BaseClient, error) {
+		client, err := NewTypedClient(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &client.BaseClient, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedMultiClient{BaseMultiClient: c, API: typedapi.New(c)}, nil
+}
+
+func newBaseMultiClient(cfg MultiClusterConfig, newClient func(Config) (*BaseClient, error)) (*BaseMultiClient, error) {
+	if len(cfg.Clusters) == 0 {
+		return nil, errors.New("cannot create multi-cluster client: no clusters")
+	}
+	if cfg.ReadPolicy == RouteAll {
+		return nil, errors.New("cannot create multi-cluster client: RouteAll is not valid for reads")
+	}
+
+	c := BaseMultiClient{
+		readPolicy:         cfg.ReadPolicy,
+		writePolicy:        cfg.WritePolicy,
+		isRead:             cfg.IsRead,
+		failoverStatuses:   cfg.FailoverStatuses,
+		failoverWrites:     cfg.FailoverWrites,
+		onWriteError:       cfg.OnWriteError,
+		healthCheckTimeout: cfg.HealthCheckTimeout,
+		done:               make(chan struct{}),
+	}
+	if c.isRead == nil {
+		c.isRead = IsReadRequest
+	}
+	if len(c.failoverStatuses) == 0 {
+		c.failoverStatuses = defaultFailoverStatuses[:]
+	}
+	if c.healthCheckTimeout <= 0 {
+		c.healthCheckTimeout = defaultHealthCheckTimeout
+	}
+
+	names := make(map[string]bool)
+	for i, cc := range cfg.Clusters {
+		name := cc.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("cannot create multi-cluster client: duplicate cluster name %q", name)
+		}
+		names[name] = true
+
+		client, err := newClient(cc.Config)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create client for cluster %q: %s", name, err)
+		}
+		c.clusters = append(c.clusters, &cluster{name: name, client: client, healthy: true})
+	}
+
+	if !cfg.DisableHealthCheck {
+		interval := cfg.HealthCheckInterval
+		if interval <= 0 {
+			interval = defaultHealthCheckInterval
+		}
+		go c.checkHealthPeriodically(interval)
+	}
+
+	return &c, nil
+}
+
+var readEndpoints = map[string]bool{
+	"_search":        true,
+	"_msearch":       true,
+	"_async_search":  true,
+	"_count":         true,
+	"_mget":          true,
+	"_explain":       true,
+	"_field_caps":    true,
+	"_validate":      true,
+	"_terms_enum":    true,
+	"_termvectors":   true,
+	"_mtermvectors":  true,
+	"_rank_eval":     true,
+	"_search_shards": true,
+	"_knn_search":    true,
+	"_pit":           true,
+	"_sql":           true,
+	"_eql":           true,
+	"_query":         true,
+}
+
+// IsReadRequest returns true for the GET and HEAD requests, and for the POST requests
+// to the read-only endpoints, eg. search, multi search, scroll, count, SQL or EQL search.
+func IsReadRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		for _, segment := range strings.Split(strings.Trim(req.URL.Path, "/"), "/") {
+			if readEndpoints[segment] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Perform executes the request on the clusters selected by the routing policy.
+func (c *BaseMultiClient) Perform(req *http.Request) (*http.Response, error) {
+	// Buffer the body, so it can be sent to several clusters
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	newRequest := func() *http.Request {
+		r := req.Clone(req.Context())
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(body)), nil
+			}
+			r.ContentLength = int64(len(body))
+		}
+		return r
+	}
+
+	// Send the scroll and point in time requests to the cluster of the ID
+	ids := requestPinIDs(req, body)
+	if cl := c.pins.get(ids); cl != nil {
+		res, err := c.perform(cl, newRequest())
+		if req.Method == http.MethodDelete {
+			c.pins.remove(ids)
+		} else {
+			c.pins.addResponse(cl, req, body, res)
+		}
+		return res, err
+	}
+
+	if c.isRead(req) {
+		res, cl, err := c.performFailover(newRequest, c.candidates(c.readPolicy))
+		if err == nil {
+			c.pins.addResponse(cl, req, body, res)
+		}
+		return res, err
+	}
+
+	if c.writePolicy == RouteAll {
+		return c.performAll(newRequest)
+	}
+
+	clusters := c.candidates(c.writePolicy)
+	if !c.failoverWrites {
+		clusters = clusters[:1]
+	}
+	res, _, err := c.performFailover(newRequest, clusters)
+	return res, err
+}
+
+// candidates returns the clusters in the order of the policy, with the unhealthy clusters last.
+func (c *BaseMultiClient) candidates(policy RoutingPolicy) []*cluster {
+	var healthy, unhealthy []*cluster
+	for _, cl := range c.clusters {
+		if cl.isHealthy() {
+			healthy = append(healthy, cl)
+		} else {
+			unhealthy = append(unhealthy, cl)
+		}
+	}
+
+	if policy == RouteNearest {
+		latencies := make(map[*cluster]time.Duration, len(healthy))
+		for _, cl := range healthy {
+			latencies[cl] = cl.latencyAverage()
+		}
+		sort.SliceStable(healthy, func(i, j int) bool { return latencies[healthy[i]] < latencies[healthy[j]] })
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// performFailover executes the request on the clusters in order, until a request succeeds,
+// and returns the response with the cluster which returned it.
+func (c *BaseMultiClient) performFailover(newRequest func() *http.Request, clusters []*cluster) (*http.Response, *cluster, error) {
+	var (
+		res *http.Response
+		cl  *cluster
+		err error
+	)
+
+	for i := range clusters {
+		cl = clusters[i]
+		req := newRequest()
+		res, err = c.perform(cl, req)
+		if !c.isFailure(res, err) || i == len(clusters)-1 || req.Context().Err() != nil {
+			break
+		}
+
+		if res != nil && res.Body != nil {
+			io.Copy(ioutil.Discard, res.Body) // errcheck exclude
+			res.Body.Close()
+		}
+	}
+
+	return res, cl, err
+}
+
+// performAll executes the request on all the healthy clusters, or on all the clusters when none is healthy,
+// and returns the response of the first cluster, without waiting for the other clusters.
+//
+// The requests to the other clusters are not canceled with the context of the request,
+// so they can complete once the response of the first cluster is returned.
+func (c *BaseMultiClient) performAll(newRequest func() *http.Request) (*http.Response, error) {
+	var clusters []*cluster
+	for _, cl := range c.clusters {
+		if cl.isHealthy() {
+			clusters = append(clusters, cl)
+		}
+	}
+	if len(clusters) == 0 {
+		clusters = c.clusters
+	}
+
+	for _, cl := range clusters[1:] {
+		req := newRequest()
+		go func(cl *cluster, req *http.Request) {
+			res, err := c.perform(cl, req)
+			if c.onWriteError != nil {
+				if err != nil {
+					c.onWriteError(cl.name, err)
+				} else if c.isFailure(res, nil) {
+					c.onWriteError(cl.name, fmt.Errorf("unexpected response status: %d", res.StatusCode))
+				}
+			}
+			if res != nil && res.Body != nil {
+				io.Copy(ioutil.Discard, res.Body) // errcheck exclude
+				res.Body.Close()
+			}
+		}(cl, req.WithContext(detachedContext{req.Context()}))
+	}
+
+	return c.perform(clusters[0], newRequest())
+}
+
+// detachedContext carries the values of the parent context, without its deadline and cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// perform executes the request on the cluster, and records the outcome.
+func (c *BaseMultiClient) perform(cl *cluster, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := cl.client.Perform(req)
+
+	// Errors caused by the context of the caller don't affect the cluster health
+	if err != nil && req.Context().Err() != nil {
+		return res, err
+	}
+	switch {
+	case err != nil:
+		cl.failure(err)
+	case c.isFailure(res, nil):
+		cl.failure(fmt.Errorf("unexpected response status: %d", res.StatusCode))
+	default:
+		cl.success(time.Since(start))
+	}
+
+	return res, err
+}
+
+// pinTTL is the duration after which an unused scroll or point in time ID is forgotten.
+var pinTTL = time.Hour
+
+// clusterPins maps the scroll and point in time IDs to the cluster which returned them.
+type clusterPins struct {
+	mu  sync.Mutex
+	ids map[string]clusterPin
+}
+
+type clusterPin struct {
+	cluster *cluster
+	usedAt  time.Time
+}
+
+// get returns the cluster of the first known ID, or nil.
+func (p *clusterPins) get(ids []string) *cluster {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, id := range ids {
+		if pin, ok := p.ids[id]; ok {
+			pin.usedAt = time.Now()
+			p.ids[id] = pin
+			return pin.cluster
+		}
+	}
+	return nil
+}
+
+func (p *clusterPins) remove(ids []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, id := range ids {
+		delete(p.ids, id)
+	}
+}
+
+// addResponse records the scroll or point in time ID of a successful response from the cluster.
+//
+// Only the responses to the scroll and point in time requests are read; the body is replaced
+// with a buffered copy.
+func (p *clusterPins) addResponse(cl *cluster, req *http.Request, body []byte, res *http.Response) {
+	if res == nil || res.StatusCode != http.StatusOK || res.Body == nil || !issuesPinID(req, body) {
+		return
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	var ids struct {
+		ScrollID string `json:"_scroll_id"`
+		PitID    string `json:"pit_id"`
+		ID       string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if p.ids == nil {
+		p.ids = make(map[string]clusterPin)
+	}
+	for id, pin := range p.ids {
+		if now.Sub(pin.usedAt) > pinTTL {
+			delete(p.ids, id)
+		}
+	}
+	for _, id := range []string{ids.ScrollID, ids.PitID, ids.ID} {
+		if id != "" {
+			p.ids[id] = clusterPin{cluster: cl, usedAt: now}
+		}
+	}
+}
+
+// issuesPinID returns true for the requests opening a scroll or a point in time,
+// or continuing them.
+func issuesPinID(req *http.Request, body []byte) bool {
+	if req.URL.Query().Get("scroll") != "" {
+		return true
+	}
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "_pit":
+			return true
+		case segment == "_search" && i+1 < len(segments) && segments[i+1] == "scroll":
+			return true
+		}
+	}
+	return len(requestPinIDs(req, body)) > 0
+}
+
+// requestPinIDs returns the scroll or point in time IDs of the request.
+func requestPinIDs(req *http.Request, body []byte) []string {
+	var (
+		ids      []string
+		segments = strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		isScroll bool
+		isPit    bool
+	)
+	for i, segment := range segments {
+		switch {
+		case segment == "_search" && i+1 < len(segments) && segments[i+1] == "scroll":
+			isScroll = true
+			if i+2 < len(segments) {
+				ids = append(ids, strings.Split(segments[i+2], ",")...)
+			}
+		case segment == "_pit":
+			isPit = true
+		}
+	}
+	if id := req.URL.Query().Get("scroll_id"); id != "" {
+		ids = append(ids, strings.Split(id, ",")...)
+	}
+
+	if len(body) == 0 || !(isScroll || isPit || bytes.Contains(body, []byte(`"pit"`))) {
+		return ids
+	}
+
+	var b struct {
+		ScrollID json.RawMessage `json:"scroll_id"`
+		ID       string          `json:"id"`
+		Pit      struct {
+			ID string `json:"id"`
+		} `json:"pit"`
+	}
+	if err := json.Unmarshal(body, &b); err != nil {
+		return ids
+	}
+	if len(b.ScrollID) > 0 {
+		var scrollIDs []string
+		if err := json.Unmarshal(b.ScrollID, &scrollIDs); err != nil {
+			var id string
+			json.Unmarshal(b.ScrollID, &id) // errcheck exclude
+			scrollIDs = []string{id}
+		}
+		ids = append(ids, scrollIDs...)
+	}
+	if isPit && b.ID != "" {
+		ids = append(ids, b.ID)
+	}
+	if b.Pit.ID != "" {
+		ids = append(ids, b.Pit.ID)
+	}
+	return ids
+}
+
+// isFailure returns true when the request should fail over to the next cluster.
+func (c *BaseMultiClient) isFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	for _, code := range c.failoverStatuses {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Clusters returns the health information for the clusters, in the configured order.
+func (c *BaseMultiClient) Clusters() []ClusterStatus {
+	statuses := make([]ClusterStatus, 0, len(c.clusters))
+	for _, cl := range c.clusters {
+		statuses = append(statuses, cl.status())
+	}
+	return statuses
+}
+
+// Client returns the client for the named cluster, or nil.
+func (c *BaseMultiClient) Client(name string) *BaseClient {
+	for _, cl := range c.clusters {
+		if cl.name == name {
+			return cl.client
+		}
+	}
+	return nil
+}
+
+// Serializer returns the serializer of the typed API configured for the first cluster.
+func (c *BaseMultiClient) Serializer() serializer.Serializer {
+	return c.clusters[0].client.Serializer()
+}
+
+// CheckHealth checks the health of all the clusters.
+func (c *BaseMultiClient) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, cl := range c.clusters {
+		wg.Add(1)
+		go func(cl *cluster) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.healthCheckTimeout)
+			defer cancel()
+			cl.checkHealth(ctx)
+		}(cl)
+	}
+	wg.Wait()
+}
+
+// Close stops the periodic health checks.
+func (c *BaseMultiClient) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return nil
+}
+
+func (c *BaseMultiClient) checkHealthPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.CheckHealth(context.Background())
+		}
+	}
+}
+
+// cluster holds the client and the health information for a cluster.
+type cluster struct {
+	name   string
+	client *BaseClient
+
+	mu           sync.Mutex
+	healthy      bool
+	healthStatus string
+	latency      time.Duration
+	failures     int
+	lastError    error
+	checkedAt    time.Time
+}
+
+func (cl *cluster) isHealthy() bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.healthy
+}
+
+func (cl *cluster) latencyAverage() time.Duration {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.latency
+}
+
+func (cl *cluster) success(latency time.Duration) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.healthy = true
+	cl.failures = 0
+	if cl.latency == 0 {
+		cl.latency = latency
+	} else {
+		cl.latency = time.Duration(latencyDecay*float64(latency) + (1-latencyDecay)*float64(cl.latency))
+	}
+}
+
+func (cl *cluster) failure(err error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.healthy = false
+	cl.failures++
+	cl.lastError = err
+}
+
+// checkHealth requests the cluster health, and updates the health information.
+func (cl *cluster) checkHealth(ctx context.Context) {
+	req, _ := http.NewRequest(http.MethodGet, "/_cluster/health", nil)
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	res, err := cl.client.Perform(req)
+	if err == nil {
+		defer res.Body.Close()
+		if res.StatusCode >= 300 {
+			err = fmt.Errorf("unexpected response status: %d", res.StatusCode)
+		}
+	}
+
+	var status string
+	if err == nil {
+		var health struct {
+			Status string `json:"status"`
+		}
+		if err = json.NewDecoder(res.Body).Decode(&health); err == nil {
+			status = health.Status
+			if status == "red" {
+				err = errors.New("cluster health status is red")
+			}
+		}
+	}
+
+	if err != nil {
+		cl.failure(err)
+	} else {
+		cl.success(time.Since(start))
+	}
+
+	cl.mu.Lock()
+	cl.healthStatus = status
+	cl.checkedAt = time.Now()
+	cl.mu.Unlock()
+}
+
+func (cl *cluster) status() ClusterStatus {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	h := ClusterStatus{
+		Name:     cl.name,
+		Healthy:  cl.healthy,
+		Status:   cl.healthStatus,
+		Latency:  cl.latency,
+		Failures: cl.failures,
+	}
+	if cl.lastError != nil {
+		h.LastError = cl.lastError.Error()
+	}
+	if !cl.checkedAt.IsZero() {
+		checkedAt := cl.checkedAt
+		h.CheckedAt = &checkedAt
+	}
+	return h
+}
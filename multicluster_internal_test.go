@@ -0,0 +1,417 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testCluster struct {
+	*httptest.Server
+	requests int32
+	status   int32
+	delay    time.Duration
+	health   string
+	body     string
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newTestCluster(t *testing.T) *testCluster {
+	tc := &testCluster{status: http.StatusOK, health: "green", body: "{}"}
+	tc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(tc.delay)
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if r.URL.Path == "/_cluster/health" {
+			w.Write([]byte(`{"status":"` + tc.health + `"}`))
+			return
+		}
+
+		atomic.AddInt32(&tc.requests, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		tc.mu.Lock()
+		tc.bodies = append(tc.bodies, string(body))
+		tc.mu.Unlock()
+
+		w.WriteHeader(int(atomic.LoadInt32(&tc.status)))
+		w.Write([]byte(tc.body))
+	}))
+	t.Cleanup(tc.Close)
+	return tc
+}
+
+func (tc *testCluster) config(name string) ClusterConfig {
+	return ClusterConfig{Name: name, Config: Config{Addresses: []string{tc.URL}, DisableRetry: true}}
+}
+
+func TestIsReadRequest(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		read   bool
+	}{
+		{"GET", "/test/_doc/1", true},
+		{"HEAD", "/test", true},
+		{"POST", "/test/_search", true},
+		{"POST", "/_search/scroll", true},
+		{"POST", "/_msearch", true},
+		{"POST", "/test/_count", true},
+		{"POST", "/_sql", true},
+		{"POST", "/test/_eql/search", true},
+		{"POST", "/test/_field_caps", true},
+		{"POST", "/test/_pit", true},
+		{"POST", "/test/_doc", false},
+		{"PUT", "/test/_doc/1", false},
+		{"POST", "/_bulk", false},
+		{"POST", "/test/_delete_by_query", false},
+		{"DELETE", "/_search/scroll", false},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		if read := IsReadRequest(req); read != tt.read {
+			t.Errorf("Unexpected result for %s %s: %v", tt.method, tt.path, read)
+		}
+	}
+}
+
+func TestMultiClient(t *testing.T) {
+	t.Run("Invalid configuration", func(t *testing.T) {
+		if _, err := NewMultiClient(MultiClusterConfig{}); err == nil {
+			t.Errorf("Expected error for missing clusters")
+		}
+		if _, err := NewMultiClient(MultiClusterConfig{
+			Clusters:   []ClusterConfig{{Config: Config{}}},
+			ReadPolicy: RouteAll,
+		}); err == nil {
+			t.Errorf("Expected error for RouteAll read policy")
+		}
+		if _, err := NewMultiClient(MultiClusterConfig{
+			Clusters: []ClusterConfig{{Name: "a"}, {Name: "a"}},
+		}); err == nil {
+			t.Errorf("Expected error for duplicate names")
+		}
+	})
+
+	t.Run("Failover", func(t *testing.T) {
+		primary, secondary := newTestCluster(t), newTestCluster(t)
+		primary.status = http.StatusServiceUnavailable
+
+		c, err := NewMultiClient(MultiClusterConfig{
+			Clusters:           []ClusterConfig{primary.config("primary"), secondary.config("secondary")},
+			FailoverWrites:     true,
+			DisableHealthCheck: true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer c.Close()
+
+		for i := 0; i < 2; i++ {
+			res, err := c.Index("test", strings.NewReader(`{"foo":"bar"}`))
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("Unexpected status: %d", res.StatusCode)
+			}
+		}
+
+		if n := atomic.LoadInt32(&primary.requests); n != 1 {
+			t.Errorf("Expected the unhealthy primary to be skipped, got %d requests", n)
+		}
+		if n := atomic.LoadInt32(&secondary.requests); n != 2 {
+			t.Errorf("Unexpected number of requests to secondary: %d", n)
+		}
+		if secondary.bodies[0] != `{"foo":"bar"}` {
+			t.Errorf("Unexpected body: %q", secondary.bodies[0])
+		}
+
+		health := c.Clusters()
+		if health[0].Healthy || health[0].Failures != 1 || !strings.Contains(health[0].LastError, "503") {
+			t.Errorf("Unexpected health for primary: %+v", health[0])
+		}
+		if !health[1].Healthy {
+			t.Errorf("Unexpected health for secondary: %+v", health[1])
+		}
+
+		// The health check marks the primary healthy again
+		atomic.StoreInt32(&primary.status, http.StatusOK)
+		c.CheckHealth(context.Background())
+		if h := c.Clusters()[0]; !h.Healthy || h.Status != "green" || h.CheckedAt == nil {
+			t.Errorf("Unexpected health for primary: %+v", h)
+		}
+	})
+
+	t.Run("Write without failover", func(t *testing.T) {
+		primary, secondary := newTestCluster(t), newTestCluster(t)
+		primary.status = http.StatusServiceUnavailable
+
+		c, err := NewMultiClient(MultiClusterConfig{
+			Clusters:           []ClusterConfig{primary.config("primary"), secondary.config("secondary")},
+			DisableHealthCheck: true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer c.Close()
+
+		res, err := c.Index("test", strings.NewReader(`{"foo":"bar"}`))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected the response of the primary, got status: %d", res.StatusCode)
+		}
+		if n := atomic.LoadInt32(&secondary.requests); n != 0 {
+			t.Errorf("Expected the write not to fail over, got %d requests to secondary", n)
+		}
+
+		// Reads still fail over
+		res, err = c.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || atomic.LoadInt32(&secondary.requests) != 1 {
+			t.Errorf("Expected the read to fail over, got status: %d", res.StatusCode)
+		}
+	})
+
+	t.Run("Caller context", func(t *testing.T) {
+		primary := newTestCluster(t)
+		primary.delay = 50 * time.Millisecond
+
+		c, err := NewMultiClient(MultiClusterConfig{
+			Clusters:           []ClusterConfig{primary.config("primary")},
+			DisableHealthCheck: true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := c.Search(c.Search.WithContext(ctx)); err == nil {
+			t.Fatalf("Expected error for the deadline")
+		}
+		if h := c.Clusters()[0]; !h.Healthy || h.Failures != 0 {
+			t.Errorf("Expected the cluster to remain healthy, got: %+v", h)
+		}
+	})
+
+	t.Run("Write to all", func(t *testing.T) {
+		primary, secondary := newTestCluster(t), newTestCluster(t)
+		secondary.status = http.StatusBadGateway
+		secondary.delay = 100 * time.Millisecond
+
+		failed := make(chan string, 1)
+		c, err := NewMultiClient(MultiClusterConfig{
+			Clusters:           []ClusterConfig{primary.config("primary"), secondary.config("secondary")},
+			WritePolicy:        RouteAll,
+			DisableHealthCheck: true,
+			OnWriteError: func(cluster string, err error) {
+				failed <- cluster
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer c.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		start := time.Now()
+		res, err := c.Index("test", strings.NewReader(`{"foo":"bar"}`), c.Index.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		cancel()
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected the response of the primary, got status: %d", res.StatusCode)
+		}
+		if d := time.Since(start); d >= secondary.delay {
+			t.Errorf("Expected the response without waiting for the secondary, got: %s", d)
+		}
+
+		// The request to the secondary completes in the background, despite the canceled context
+		select {
+		case name := <-failed:
+			if name != "secondary" {
+				t.Errorf("Unexpected write error for cluster: %s", name)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for the write to the secondary")
+		}
+		for _, tc := range []*testCluster{primary, secondary} {
+			tc.mu.Lock()
+			if len(tc.bodies) != 1 || tc.bodies[0] != `{"foo":"bar"}` {
+				t.Errorf("Unexpected bodies: %q", tc.bodies)
+			}
+			tc.mu.Unlock()
+		}
+
+		// Reads are routed with the read policy
+		res, err = c.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		if n := atomic.LoadInt32(&secondary.requests); n != 1 {
+			t.Errorf("Unexpected number of requests to secondary: %d", n)
+		}
+	})
+
+	t.Run("Reads with write to all", func(t *testing.T) {
+		primary, secondary := newTestCluster(t), newTestCluster(t)
+		primary.status = http.StatusServiceUnavailable
+		primary.body = `{"_scroll_id":"scroll-primary"}`
+		secondary.body = `{"_scroll_id":"scroll-secondary"}`
+
+		c, err := NewMultiClient(MultiClusterConfig{
+			Clusters:           []ClusterConfig{primary.config("primary"), secondary.config("secondary")},
+			WritePolicy:        RouteAll,
+			DisableHealthCheck: true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer c.Close()
+
+		// The scroll is opened on the secondary, as the primary fails
+		res, err := c.Search(c.Search.WithScroll(time.Minute))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || string(body) != secondary.body {
+			t.Fatalf("Unexpected response: %d %s", res.StatusCode, body)
+		}
+
+		atomic.StoreInt32(&primary.status, http.StatusOK)
+		c.CheckHealth(context.Background())
+		if !c.Clusters()[0].Healthy {
+			t.Fatalf("Expected the primary to be healthy")
+		}
+
+		// The continuation and the clear scroll are sent to the secondary only
+		res, err = c.Scroll(c.Scroll.WithBody(strings.NewReader(`{"scroll":"1m","scroll_id":"scroll-secondary"}`)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		res, err = c.ClearScroll(c.ClearScroll.WithScrollID("scroll-secondary"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		// The cleared scroll is forgotten
+		if cl := c.pins.get([]string{"scroll-secondary"}); cl != nil {
+			t.Errorf("Expected the scroll ID to be removed, got cluster: %s", cl.name)
+		}
+
+		if n := atomic.LoadInt32(&primary.requests); n != 1 {
+			t.Errorf("Expected the scroll requests to be pinned to the secondary, got %d requests to primary", n)
+		}
+		if n := atomic.LoadInt32(&secondary.requests); n != 3 {
+			t.Errorf("Unexpected number of requests to secondary: %d", n)
+		}
+		if secondary.bodies[1] != `{"scroll":"1m","scroll_id":"scroll-secondary"}` {
+			t.Errorf("Unexpected scroll body: %q", secondary.bodies[1])
+		}
+
+		// Multi search is a read, sent to a single cluster
+		res, err = c.Msearch(strings.NewReader("{}\n{\"query\":{\"match_all\":{}}}\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		if n := atomic.LoadInt32(&primary.requests); n != 2 {
+			t.Errorf("Expected the multi search on the primary, got %d requests", n)
+		}
+		if n := atomic.LoadInt32(&secondary.requests); n != 3 {
+			t.Errorf("Expected the multi search not to be sent to the secondary, got %d requests", n)
+		}
+	})
+
+	t.Run("Read from nearest", func(t *testing.T) {
+		primary, secondary := newTestCluster(t), newTestCluster(t)
+		primary.delay = 50 * time.Millisecond
+
+		c, err := NewTypedMultiClient(MultiClusterConfig{
+			Clusters:           []ClusterConfig{primary.config("primary"), secondary.config("secondary")},
+			ReadPolicy:         RouteNearest,
+			DisableHealthCheck: true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer c.Close()
+
+		c.CheckHealth(context.Background())
+
+		if _, err := c.Search().Index("test").Perform(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if n := atomic.LoadInt32(&secondary.requests); n != 1 {
+			t.Errorf("Expected the read to be routed to the nearest cluster, got %d requests", n)
+		}
+
+		if _, err := c.Index("test").Raw(strings.NewReader(`{}`)).Perform(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if n := atomic.LoadInt32(&primary.requests); n != 1 {
+			t.Errorf("Expected the write to be routed to the primary cluster, got %d requests", n)
+		}
+	})
+
+	t.Run("Red cluster", func(t *testing.T) {
+		primary := newTestCluster(t)
+		primary.health = "red"
+
+		c, _ := NewMultiClient(MultiClusterConfig{
+			Clusters:            []ClusterConfig{primary.config("primary")},
+			HealthCheckInterval: 10 * time.Millisecond,
+		})
+		defer c.Close()
+
+		time.Sleep(50 * time.Millisecond)
+		if h := c.Clusters()[0]; h.Healthy || h.Status != "red" {
+			t.Errorf("Unexpected health: %+v", h)
+		}
+	})
+}
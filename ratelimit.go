@@ -0,0 +1,446 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is matched by errors.Is for the errors returned by the rate limiter.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitPolicy defines the behaviour of the rate limiter for requests over the limits.
+type RateLimitPolicy int
+
+// The rate limiting policies.
+const (
+	RateLimitBlock    RateLimitPolicy = iota // Wait until the request is allowed, or the context is done.
+	RateLimitFailFast                        // Return a RateLimitError immediately.
+)
+
+// RateLimitError is returned for requests rejected by the rate limiter.
+type RateLimitError struct {
+	Group string // Endpoint group, or empty for the global limits.
+	Limit string // Exceeded limit: "requests", "bytes" or "in-flight".
+}
+
+// Error returns the error message.
+func (e *RateLimitError) Error() string {
+	if e.Group == "" {
+		return fmt.Sprintf("rate limit exceeded: %s", e.Limit)
+	}
+	return fmt.Sprintf("rate limit exceeded for group %s: %s", e.Group, e.Limit)
+}
+
+// Is allows to match the error with ErrRateLimited.
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimit represents the limits for a set of requests. Zero values disable the corresponding limit.
+type RateLimit struct {
+	RequestsPerSecond float64 // Rate of requests.
+	RequestsBurst     int     // Number of requests allowed above the rate. Default: one second worth of requests.
+
+	// Rate of request body bytes. Requests without a body, eg. searches with the query
+	// in the URL parameters, don't consume any bytes; limit them with RequestsPerSecond.
+	BytesPerSecond float64
+	BytesBurst     int64 // Number of bytes allowed above the rate. Default: one second worth of bytes.
+
+	MaxInFlight int // Number of requests executed concurrently, until the response body is closed.
+}
+
+func (l RateLimit) isZero() bool {
+	return l.RequestsPerSecond <= 0 && l.BytesPerSecond <= 0 && l.MaxInFlight <= 0
+}
+
+// RateLimitConfig represents the configuration of the client-side rate limiting.
+//
+// The global limits apply to all requests, and the limits of an endpoint group
+// apply in addition to the requests of the group, as returned by the Group function.
+// Each attempt of a retried request is counted.
+type RateLimitConfig struct {
+	RateLimit // Global limits.
+
+	Groups map[string]RateLimit // Limits per endpoint group, eg. "search" or "bulk".
+
+	// Optional function returning the endpoint group of the request. Default: EndpointGroup.
+	Group func(*http.Request) string
+
+	Policy RateLimitPolicy // Behaviour for requests over the limits. Default: RateLimitBlock.
+}
+
+// RateLimitMetric represents the metric information for a set of rate limits.
+type RateLimitMetric struct {
+	Group    string        `json:"group,omitempty"`
+	InFlight int           `json:"in_flight"`
+	Waits    int           `json:"waits"`
+	WaitTime time.Duration `json:"wait_time"`
+	Rejected int           `json:"rejected"`
+}
+
+// String returns the rate limit information as a string.
+func (m RateLimitMetric) String() string {
+	group := m.Group
+	if group == "" {
+		group = "global"
+	}
+	return fmt.Sprintf("{%s in_flight=%d waits=%d wait_time=%s rejected=%d}", group, m.InFlight, m.Waits, m.WaitTime, m.Rejected)
+}
+
+var endpointGroups = map[string]string{
+	"_bulk":             "bulk",
+	"_search":           "search",
+	"_msearch":          "search",
+	"_search_template":  "search",
+	"_msearch_template": "search",
+	"_async_search":     "search",
+	"_count":            "search",
+}
+
+// EndpointGroup returns "bulk" for bulk requests, "search" for search and count requests,
+// and an empty string for other requests.
+func EndpointGroup(req *http.Request) string {
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if group, ok := endpointGroups[segment]; ok {
+			return group
+		}
+	}
+	return ""
+}
+
+// rateLimiter holds the global limiter and the limiters for the endpoint groups.
+type rateLimiter struct {
+	policy    RateLimitPolicy
+	group     func(*http.Request) string
+	withBytes bool
+
+	global *limiter
+	groups map[string]*limiter
+}
+
+func newRateLimiter(cfg *RateLimitConfig) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+
+	rl := rateLimiter{
+		policy: cfg.Policy,
+		group:  cfg.Group,
+		groups: make(map[string]*limiter),
+	}
+	if rl.group == nil {
+		rl.group = EndpointGroup
+	}
+
+	if !cfg.RateLimit.isZero() {
+		rl.global = newLimiter("", cfg.RateLimit)
+		rl.withBytes = cfg.BytesPerSecond > 0
+	}
+	for name, l := range cfg.Groups {
+		if l.isZero() {
+			continue
+		}
+		rl.groups[name] = newLimiter(name, l)
+		rl.withBytes = rl.withBytes || l.BytesPerSecond > 0
+	}
+
+	return &rl
+}
+
+// acquire waits until the request is allowed by the limits, according to the policy.
+// The returned function must be called once the request is complete.
+//
+// The limits of the group are acquired first, so a request waiting for a saturated group
+// doesn't hold the global limits, which would starve the requests of the other groups.
+func (rl *rateLimiter) acquire(req *http.Request) (func(), error) {
+	var size int64
+	if rl.withBytes {
+		var err error
+		if size, err = requestSize(req); err != nil {
+			return nil, err
+		}
+	}
+
+	failFast := rl.policy == RateLimitFailFast
+
+	var releases []func()
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+
+	for _, l := range []*limiter{rl.groups[rl.group(req)], rl.global} {
+		if l == nil {
+			continue
+		}
+		r, err := l.acquire(req.Context(), size, failFast)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+
+	var once sync.Once
+	return func() { once.Do(release) }, nil
+}
+
+// metrics returns the metrics for the limiters, starting with the global one.
+func (rl *rateLimiter) metrics() []RateLimitMetric {
+	var ms []RateLimitMetric
+
+	if rl.global != nil {
+		ms = append(ms, rl.global.metric())
+	}
+
+	names := make([]string, 0, len(rl.groups))
+	for name := range rl.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ms = append(ms, rl.groups[name].metric())
+	}
+
+	return ms
+}
+
+// requestSize returns the size of the request body, buffering it when the length is unknown.
+func requestSize(req *http.Request) (int64, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return 0, nil
+	}
+	// A zero length with a body means unknown, see http.NewRequest
+	if req.ContentLength > 0 {
+		return req.ContentLength, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(req.Body); err != nil {
+		return 0, err
+	}
+	req.Body.Close()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}
+	req.Body, _ = req.GetBody()
+	req.ContentLength = int64(buf.Len())
+
+	return req.ContentLength, nil
+}
+
+// limiter enforces a set of limits.
+type limiter struct {
+	group    string
+	requests *tokenBucket
+	bytes    *tokenBucket
+	inFlight chan struct{}
+
+	mu       sync.Mutex
+	waits    int
+	waitTime time.Duration
+	rejected int
+}
+
+func newLimiter(group string, l RateLimit) *limiter {
+	lm := limiter{group: group}
+	if l.RequestsPerSecond > 0 {
+		burst := float64(l.RequestsBurst)
+		if burst <= 0 {
+			burst = math.Max(1, math.Ceil(l.RequestsPerSecond))
+		}
+		lm.requests = newTokenBucket(l.RequestsPerSecond, burst)
+	}
+	if l.BytesPerSecond > 0 {
+		burst := float64(l.BytesBurst)
+		if burst <= 0 {
+			burst = math.Max(1, math.Ceil(l.BytesPerSecond))
+		}
+		lm.bytes = newTokenBucket(l.BytesPerSecond, burst)
+	}
+	if l.MaxInFlight > 0 {
+		lm.inFlight = make(chan struct{}, l.MaxInFlight)
+	}
+	return &lm
+}
+
+// acquire waits for an in-flight slot and for the tokens, or fails according to the policy.
+func (l *limiter) acquire(ctx context.Context, size int64, failFast bool) (func(), error) {
+	var (
+		start  = time.Now()
+		waited bool
+	)
+
+	release := func() {}
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		default:
+			if failFast {
+				l.reject()
+				return nil, &RateLimitError{Group: l.group, Limit: "in-flight"}
+			}
+			waited = true
+			select {
+			case l.inFlight <- struct{}{}:
+			case <-ctx.Done():
+				l.wait(time.Since(start))
+				return nil, ctx.Err()
+			}
+		}
+		release = func() { <-l.inFlight }
+	}
+
+	var (
+		delay    time.Duration
+		reserved []func()
+	)
+	cancel := func() {
+		for _, c := range reserved {
+			c()
+		}
+		release()
+	}
+
+	for _, b := range []struct {
+		bucket *tokenBucket
+		n      float64
+		name   string
+	}{{l.requests, 1, "requests"}, {l.bytes, float64(size), "bytes"}} {
+		if b.bucket == nil {
+			continue
+		}
+		d, ok := b.bucket.reserve(b.n, failFast)
+		if !ok {
+			cancel()
+			l.reject()
+			return nil, &RateLimitError{Group: l.group, Limit: b.name}
+		}
+		bucket, n := b.bucket, b.n
+		reserved = append(reserved, func() { bucket.refund(n) })
+		if d > delay {
+			delay = d
+		}
+	}
+
+	if delay > 0 {
+		waited = true
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			cancel()
+			l.wait(time.Since(start))
+			return nil, ctx.Err()
+		}
+	}
+
+	if waited {
+		l.wait(time.Since(start))
+	}
+
+	return release, nil
+}
+
+func (l *limiter) wait(d time.Duration) {
+	l.mu.Lock()
+	l.waits++
+	l.waitTime += d
+	l.mu.Unlock()
+}
+
+func (l *limiter) reject() {
+	l.mu.Lock()
+	l.rejected++
+	l.mu.Unlock()
+}
+
+func (l *limiter) metric() RateLimitMetric {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return RateLimitMetric{
+		Group:    l.group,
+		InFlight: len(l.inFlight),
+		Waits:    l.waits,
+		WaitTime: l.waitTime,
+		Rejected: l.rejected,
+	}
+}
+
+// tokenBucket implements the token bucket algorithm with reservations:
+// the tokens can go negative, delaying the subsequent reservations.
+type tokenBucket struct {
+	sync.Mutex
+
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve takes n tokens and returns the delay before they are available.
+//
+// Reservations larger than the burst wait for a full bucket. With failFast,
+// no tokens are taken and false is returned when they're not available.
+func (b *tokenBucket) reserve(n float64, failFast bool) (time.Duration, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	required := math.Min(n, b.burst)
+	if b.tokens >= required {
+		b.tokens -= n
+		return 0, true
+	}
+	if failFast {
+		return 0, false
+	}
+
+	delay := time.Duration((required - b.tokens) / b.rate * float64(time.Second))
+	b.tokens -= n
+	return delay, true
+}
+
+// refund returns n tokens to the bucket.
+func (b *tokenBucket) refund(n float64) {
+	b.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+n)
+	b.Unlock()
+}
@@ -0,0 +1,280 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpointGroup(t *testing.T) {
+	tests := []struct {
+		path  string
+		group string
+	}{
+		{"/_bulk", "bulk"},
+		{"/test/_bulk", "bulk"},
+		{"/test/_search", "search"},
+		{"/_search/scroll", "search"},
+		{"/test/_count", "search"},
+		{"/_msearch", "search"},
+		{"/test/_doc/1", ""},
+		{"/", ""},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		if group := EndpointGroup(req); group != tt.group {
+			t.Errorf("Unexpected group for %s: %q, want: %q", tt.path, group, tt.group)
+		}
+	}
+}
+
+func TestRequestSize(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/_bulk", ioutil.NopCloser(strings.NewReader("{}\n")))
+	if req.ContentLength != 0 || req.GetBody != nil {
+		t.Fatalf("Expected a body of unknown length")
+	}
+
+	size, err := requestSize(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if size != 3 || req.ContentLength != 3 {
+		t.Errorf("Unexpected size: %d", size)
+	}
+
+	for i := 0; i < 2; i++ {
+		body, _ := ioutil.ReadAll(req.Body)
+		if string(body) != "{}\n" {
+			t.Errorf("Unexpected body: %q", body)
+		}
+		if req.GetBody == nil {
+			t.Fatalf("Expected GetBody to be set")
+		}
+		req.Body, _ = req.GetBody()
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/_search?q=foo", nil)
+	if size, _ := requestSize(req); size != 0 {
+		t.Errorf("Unexpected size for request without body: %d", size)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	newServer := func(block <-chan struct{}, started chan<- string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if block != nil && strings.HasSuffix(r.URL.Path, "_bulk") {
+				started <- r.URL.Path
+				<-block
+			}
+			w.Header().Set("X-Elastic-Product", "Elasticsearch")
+			w.Write([]byte("{}"))
+		}))
+	}
+
+	t.Run("Requests per second", func(t *testing.T) {
+		server := newServer(nil, nil)
+		defer server.Close()
+
+		c, _ := NewClient(Config{
+			Addresses: []string{server.URL},
+			RateLimit: &RateLimitConfig{RateLimit: RateLimit{RequestsPerSecond: 20, RequestsBurst: 1}},
+		})
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			res, err := c.Info()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+		}
+		if d := time.Since(start); d < 180*time.Millisecond {
+			t.Errorf("Expected requests to be delayed, took: %s", d)
+		}
+
+		m := c.ClientMetrics()
+		if len(m.RateLimits) != 1 || m.RateLimits[0].Waits != 4 || m.RateLimits[0].WaitTime <= 0 {
+			t.Errorf("Unexpected metrics: %s", m)
+		}
+	})
+
+	t.Run("Bytes per second", func(t *testing.T) {
+		server := newServer(nil, nil)
+		defer server.Close()
+
+		c, _ := NewClient(Config{
+			Addresses:    []string{server.URL},
+			DisableRetry: true,
+			RateLimit:    &RateLimitConfig{RateLimit: RateLimit{BytesPerSecond: 10000, BytesBurst: 1000}},
+		})
+
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			// The body length is unknown for a plain io.Reader
+			body := ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 1000)))
+			res, err := c.Index("test", body)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+		}
+		if d := time.Since(start); d < 90*time.Millisecond {
+			t.Errorf("Expected requests to be delayed, took: %s", d)
+		}
+	})
+
+	t.Run("Max in flight per group with fail fast", func(t *testing.T) {
+		block, started := make(chan struct{}), make(chan string, 1)
+		server := newServer(block, started)
+		defer server.Close()
+
+		c, _ := NewClient(Config{
+			Addresses: []string{server.URL},
+			RateLimit: &RateLimitConfig{
+				Groups: map[string]RateLimit{"bulk": {MaxInFlight: 1}},
+				Policy: RateLimitFailFast,
+			},
+		})
+
+		done := make(chan error)
+		go func() {
+			res, err := c.Bulk(strings.NewReader("{}\n"))
+			if err == nil {
+				res.Body.Close()
+			}
+			done <- err
+		}()
+		<-started
+
+		_, err := c.Bulk(strings.NewReader("{}\n"))
+		if !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("Expected ErrRateLimited, got: %v", err)
+		}
+		var rlErr *RateLimitError
+		if !errors.As(err, &rlErr) || rlErr.Group != "bulk" || rlErr.Limit != "in-flight" {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+
+		res, err := c.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error for another group: %s", err)
+		}
+		res.Body.Close()
+
+		close(block)
+		if err := <-done; err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		res, err = c.Bulk(strings.NewReader("{}\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+		<-started
+
+		m := c.ClientMetrics()
+		if len(m.RateLimits) != 1 || m.RateLimits[0].Group != "bulk" || m.RateLimits[0].Rejected != 1 || m.RateLimits[0].InFlight != 0 {
+			t.Errorf("Unexpected metrics: %s", m)
+		}
+	})
+
+	t.Run("Saturated group", func(t *testing.T) {
+		block, started := make(chan struct{}), make(chan string, 1)
+		server := newServer(block, started)
+		defer server.Close()
+		defer close(block)
+
+		c, _ := NewClient(Config{
+			Addresses: []string{server.URL},
+			RateLimit: &RateLimitConfig{
+				RateLimit: RateLimit{MaxInFlight: 2},
+				Groups:    map[string]RateLimit{"bulk": {MaxInFlight: 1}},
+			},
+		})
+
+		bulk := func() {
+			if res, err := c.Bulk(strings.NewReader("{}\n")); err == nil {
+				res.Body.Close()
+			}
+		}
+		go bulk()
+		<-started
+
+		// The second bulk request waits for the group, without holding a global slot
+		go bulk()
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		res, err := c.Search(c.Search.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("Expected the search to succeed, got: %v", err)
+		}
+		res.Body.Close()
+
+		m := c.ClientMetrics()
+		if m.RateLimits[0].InFlight != 1 || m.RateLimits[1].InFlight != 1 {
+			t.Errorf("Unexpected metrics: %s", m)
+		}
+	})
+
+	t.Run("Max in flight with context", func(t *testing.T) {
+		block, started := make(chan struct{}), make(chan string, 1)
+		server := newServer(block, started)
+		defer server.Close()
+		defer close(block)
+
+		c, _ := NewClient(Config{
+			Addresses: []string{server.URL},
+			RateLimit: &RateLimitConfig{RateLimit: RateLimit{MaxInFlight: 1}},
+		})
+
+		go func() {
+			if res, err := c.Bulk(strings.NewReader("{}\n")); err == nil {
+				res.Body.Close()
+			}
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := c.Info(c.Info.WithContext(ctx))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected context.DeadlineExceeded, got: %v", err)
+		}
+
+		m := c.ClientMetrics()
+		if m.RateLimits[0].Waits != 1 || m.RateLimits[0].InFlight != 1 {
+			t.Errorf("Unexpected metrics: %s", m)
+		}
+	})
+}
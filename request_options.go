@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+const (
+	headerOpaqueID    = "X-Opaque-Id"
+	headerTraceparent = "traceparent"
+)
+
+// RequestOptions represents the options for a single request, overriding the client configuration.
+//
+// Use WithRequestOptions to attach the options to the request context, eg. with the
+// WithContext option of the esapi functions, or with the Do and Perform methods of the typed API:
+//
+//	ctx := elasticsearch.WithRequestOptions(ctx, elasticsearch.RequestOptions{
+//	  Timeout:      2 * time.Second,
+//	  DisableRetry: true,
+//	  OpaqueID:     "my-update",
+//	})
+//
+//	es.Update("my-index", "1", body, es.Update.WithContext(ctx))
+//	typedClient.Update("my-index", "1").Request(req).Do(ctx)
+type RequestOptions struct {
+	Timeout time.Duration // Maximum duration of the request, including the retries.
+
+	DisableRetry  bool                            // Disable retries, eg. for a non-idempotent request.
+	MaxRetries    int                             // Overrides Config.MaxRetries, when set.
+	RetryOnStatus []int                           // Overrides Config.RetryOnStatus, when set.
+	RetryBackoff  func(attempt int) time.Duration // Overrides Config.RetryBackoff, when set.
+
+	// URL of the node to send the request to, instead of a node from the connection pool.
+	// The request is performed with the configuration of the client, but it's not reflected
+	// in the transport metrics, and it doesn't affect the state of the connection pool:
+	// the node is never marked as dead, and the retries are sent to the same node.
+	Node string
+
+	DisableHedging bool // Disable hedging, when configured for the client.
+
+	OpaqueID    string // Value of the X-Opaque-Id HTTP header.
+	Traceparent string // Value of the W3C Trace Context traceparent HTTP header.
+}
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a copy of ctx carrying the request options.
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// RequestOptionsFromContext returns the request options attached to ctx, if any.
+func RequestOptionsFromContext(ctx context.Context) (RequestOptions, bool) {
+	if ctx == nil {
+		return RequestOptions{}, false
+	}
+	opts, ok := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return opts, ok
+}
+
+// nodeTransport returns the transport for requests pinned to the node at addr.
+//
+// The transports are cached for the nodes of the connection pool: on a cache miss, the
+// transports of the nodes removed from the pool, eg. by the node discovery, are evicted.
+// They share the HTTP transport of the client, so they don't hold any connection.
+func (c *BaseClient) nodeTransport(addr string) (elastictransport.Interface, error) {
+	c.nodeTransportsMu.Lock()
+	defer c.nodeTransportsMu.Unlock()
+
+	if tp, ok := c.nodeTransports[addr]; ok {
+		return tp, nil
+	}
+
+	c.pruneNodeTransports()
+
+	u, err := url.Parse(strings.TrimRight(addr, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse node url: %v", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("cannot parse node url: %q is not an absolute URL", addr)
+	}
+
+	cfg := c.transportConfig
+	cfg.URLs = []*url.URL{u}
+	cfg.EnableMetrics = false
+	cfg.DiscoverNodesInterval = 0
+	cfg.ConnectionPoolFunc = nil
+
+	tp, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.nodeTransports == nil {
+		c.nodeTransports = make(map[string]*elastictransport.Client)
+	}
+	c.nodeTransports[addr] = tp
+
+	return tp, nil
+}
+
+// pruneNodeTransports evicts the cached transports of the nodes which are not live in the
+// connection pool. The caller must hold nodeTransportsMu.
+func (c *BaseClient) pruneNodeTransports() {
+	if len(c.nodeTransports) == 0 {
+		return
+	}
+
+	tp, ok := c.Transport.(*elastictransport.Client)
+	if !ok {
+		return
+	}
+
+	live := make(map[string]bool)
+	for _, u := range tp.URLs() {
+		live[strings.TrimRight(u.String(), "/")] = true
+	}
+	for addr := range c.nodeTransports {
+		if !live[strings.TrimRight(addr, "/")] {
+			delete(c.nodeTransports, addr)
+		}
+	}
+}
+
+// cancelBody releases the request context when the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,308 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+func TestRetry(t *testing.T) {
+	newClient := func(t *testing.T, cfg Config, statuses ...int) (*Client, *[]string) {
+		var bodies []string
+		cfg.Transport = &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+			var body []byte
+			if req.Body != nil {
+				body, _ = ioutil.ReadAll(req.Body)
+			}
+			bodies = append(bodies, string(body))
+
+			status := http.StatusOK
+			if len(bodies) <= len(statuses) {
+				status = statuses[len(bodies)-1]
+			}
+			return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		}}
+		c, err := NewClient(cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return c, &bodies
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		c, bodies := newClient(t, Config{}, 502, 503)
+
+		res, err := c.Search(c.Search.WithBody(strings.NewReader(`{"query":{}}`)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Unexpected status: %d", res.StatusCode)
+		}
+		if len(*bodies) != 3 {
+			t.Fatalf("Expected 3 attempts, got %d", len(*bodies))
+		}
+		for _, body := range *bodies {
+			if body != `{"query":{}}` {
+				t.Errorf("Unexpected body: %q", body)
+			}
+		}
+	})
+
+	t.Run("Max retries", func(t *testing.T) {
+		c, bodies := newClient(t, Config{MaxRetries: 2}, 502, 502, 502, 502)
+
+		res, _ := c.Info()
+		if res.StatusCode != 502 {
+			t.Errorf("Unexpected status: %d", res.StatusCode)
+		}
+		if len(*bodies) != 3 {
+			t.Errorf("Expected 3 attempts, got %d", len(*bodies))
+		}
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		c, bodies := newClient(t, Config{EnableMetrics: true}, 503)
+
+		if _, err := c.Info(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, err := c.Info(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		m, err := c.Metrics()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(*bodies) != 3 {
+			t.Errorf("Expected 3 attempts, got %d", len(*bodies))
+		}
+		if m.Requests != 2 {
+			t.Errorf("Expected 2 requests, got %d", m.Requests)
+		}
+		if m.Responses[503] != 1 || m.Responses[200] != 2 {
+			t.Errorf("Unexpected responses: %v", m.Responses)
+		}
+
+		cm := c.ClientMetrics()
+		if cm.Retries == nil || cm.Retries.Requests != 2 || cm.Retries.Retries != 1 {
+			t.Errorf("Unexpected client metrics: %s", cm)
+		}
+		if cm.String() != "{Retries: {requests=2 retries=1}}" {
+			t.Errorf("Unexpected client metrics: %s", cm)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		c, bodies := newClient(t, Config{DisableRetry: true}, 502)
+
+		c.Info() // errcheck exclude
+		if len(*bodies) != 1 {
+			t.Errorf("Expected 1 attempt, got %d", len(*bodies))
+		}
+	})
+
+	t.Run("Connection pool error", func(t *testing.T) {
+		pool := &emptyConnectionPool{}
+		c, _ := NewClient(Config{
+			Addresses:     []string{"http://localhost:9200", "http://localhost:9201"},
+			EnableMetrics: true,
+			ConnectionPoolFunc: func([]*elastictransport.Connection, elastictransport.Selector) elastictransport.ConnectionPool {
+				return pool
+			},
+		})
+
+		if _, err := c.Info(); err == nil || !strings.HasPrefix(err.Error(), "cannot get connection") {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if pool.calls != 1 {
+			t.Errorf("Expected 1 attempt, got %d", pool.calls)
+		}
+		if m, _ := c.Metrics(); m.Requests != 1 {
+			t.Errorf("Expected 1 request, got %d", m.Requests)
+		}
+	})
+
+	t.Run("Retry on error", func(t *testing.T) {
+		var attempts int
+		c, _ := NewClient(Config{
+			RetryOnError: func(req *http.Request, err error) bool { return err.Error() != "fatal" },
+			Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				attempts++
+				if attempts == 1 {
+					return nil, errors.New("temporary")
+				}
+				return nil, errors.New("fatal")
+			}},
+		})
+
+		if _, err := c.Info(); err == nil {
+			t.Fatalf("Expected error")
+		}
+		if attempts != 2 {
+			t.Errorf("Expected 2 attempts, got %d", attempts)
+		}
+	})
+}
+
+type emptyConnectionPool struct{ calls int }
+
+func (cp *emptyConnectionPool) Next() (*elastictransport.Connection, error) {
+	cp.calls++
+	return nil, errors.New("no connection available")
+}
+func (cp *emptyConnectionPool) OnSuccess(*elastictransport.Connection) error { return nil }
+func (cp *emptyConnectionPool) OnFailure(*elastictransport.Connection) error { return nil }
+func (cp *emptyConnectionPool) URLs() []*url.URL                             { return nil }
+
+func TestRequestOptions(t *testing.T) {
+	t.Run("Retry", func(t *testing.T) {
+		var attempts int
+		c, _ := NewClient(Config{
+			RetryBackoff: func(int) time.Duration { return time.Millisecond },
+			Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{StatusCode: 503, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+			}},
+		})
+
+		ctx := WithRequestOptions(context.Background(), RequestOptions{DisableRetry: true})
+		c.Index("test", strings.NewReader("{}"), c.Index.WithContext(ctx)) // errcheck exclude
+		if attempts != 1 {
+			t.Errorf("Expected 1 attempt, got %d", attempts)
+		}
+
+		attempts = 0
+		ctx = WithRequestOptions(context.Background(), RequestOptions{MaxRetries: 5, RetryOnStatus: []int{503}})
+		c.Index("test", strings.NewReader("{}"), c.Index.WithContext(ctx)) // errcheck exclude
+		if attempts != 6 {
+			t.Errorf("Expected 6 attempts, got %d", attempts)
+		}
+
+		attempts = 0
+		ctx = WithRequestOptions(context.Background(), RequestOptions{RetryOnStatus: []int{429}})
+		c.Index("test", strings.NewReader("{}"), c.Index.WithContext(ctx)) // errcheck exclude
+		if attempts != 1 {
+			t.Errorf("Expected 1 attempt, got %d", attempts)
+		}
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+		var header http.Header
+		c, _ := NewTypedClient(Config{
+			Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				header = req.Header
+				return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+			}},
+		})
+
+		ctx := WithRequestOptions(context.Background(), RequestOptions{
+			OpaqueID:    "my-id",
+			Traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		})
+		c.Info().Perform(ctx) // errcheck exclude
+
+		if v := header.Get("X-Opaque-Id"); v != "my-id" {
+			t.Errorf("Unexpected X-Opaque-Id: %q", v)
+		}
+		if v := header.Get("Traceparent"); !strings.HasPrefix(v, "00-0af7651916cd43dd8448eb211c80319c") {
+			t.Errorf("Unexpected traceparent: %q", v)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		c, _ := NewClient(Config{
+			Transport: &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+				<-req.Context().Done()
+				return nil, req.Context().Err()
+			}},
+		})
+
+		ctx := WithRequestOptions(context.Background(), RequestOptions{Timeout: 10 * time.Millisecond})
+		start := time.Now()
+		_, err := c.Info(c.Info.WithContext(ctx))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded error, got: %v", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Errorf("Expected the retries to stop at the deadline")
+		}
+	})
+
+	t.Run("Node", func(t *testing.T) {
+		var servers []string
+		newServer := func(name string) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				servers = append(servers, name)
+				w.Write([]byte("{}"))
+			}))
+		}
+		s1, s2 := newServer("s1"), newServer("s2")
+		defer s1.Close()
+		defer s2.Close()
+
+		c, _ := NewClient(Config{Addresses: []string{s1.URL}})
+
+		c.Info()                                                                                           // errcheck exclude
+		c.Info(c.Info.WithContext(WithRequestOptions(context.Background(), RequestOptions{Node: s2.URL}))) // errcheck exclude
+		c.Info()                                                                                           // errcheck exclude
+
+		if strings.Join(servers, ",") != "s1,s2,s1" {
+			t.Errorf("Unexpected servers: %v", servers)
+		}
+
+		_, err := c.Info(c.Info.WithContext(WithRequestOptions(context.Background(), RequestOptions{Node: "foo"})))
+		if err == nil {
+			t.Errorf("Expected error for invalid node URL")
+		}
+	})
+
+	t.Run("Node cache", func(t *testing.T) {
+		c, _ := NewClient(Config{Addresses: []string{"http://es1:9200", "http://es2:9200"}})
+
+		for _, addr := range []string{"http://es1:9200", "http://es3:9200", "http://es2:9200/"} {
+			if _, err := c.nodeTransport(addr); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+		}
+
+		var addrs []string
+		for addr := range c.nodeTransports {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		if strings.Join(addrs, ",") != "http://es1:9200,http://es2:9200/" {
+			t.Errorf("Unexpected cached transports: %v", addrs)
+		}
+	})
+}
@@ -0,0 +1,297 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+var (
+	defaultMaxRetries    = 3
+	defaultRetryOnStatus = [...]int{502, 503, 504}
+)
+
+// retryConfig represents the retry policy of the client.
+type retryConfig struct {
+	disableRetry  bool
+	maxRetries    int
+	retryOnStatus []int
+	retryOnError  func(*http.Request, error) bool
+	retryBackoff  func(attempt int) time.Duration
+
+	metrics *retryMetrics
+}
+
+// RetryMetric represents the metric information for the retried requests.
+type RetryMetric struct {
+	Requests int `json:"requests"`
+	Retries  int `json:"retries"`
+}
+
+// String returns the retry information as a string.
+func (m RetryMetric) String() string {
+	return fmt.Sprintf("{requests=%d retries=%d}", m.Requests, m.Retries)
+}
+
+// retryMetrics counts the requests performed with the retry policy and their retries.
+type retryMetrics struct {
+	mu       sync.Mutex
+	requests int
+	retries  int
+
+	// The retries sent to the connection pool, counted as requests by the transport metrics.
+	poolRetries int
+}
+
+func (m *retryMetrics) record(retries int, pooled bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.requests++
+	m.retries += retries
+	if pooled {
+		m.poolRetries += retries
+	}
+	m.mu.Unlock()
+}
+
+// transportRetries returns the retries counted as requests by the transport metrics.
+func (m *retryMetrics) transportRetries() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.poolRetries
+}
+
+func (m *retryMetrics) metric() RetryMetric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return RetryMetric{Requests: m.requests, Retries: m.retries}
+}
+
+func newRetryConfig(cfg Config) retryConfig {
+	rc := retryConfig{
+		disableRetry:  cfg.DisableRetry,
+		maxRetries:    cfg.MaxRetries,
+		retryOnStatus: cfg.RetryOnStatus,
+		retryOnError:  cfg.RetryOnError,
+		retryBackoff:  cfg.RetryBackoff,
+		metrics:       &retryMetrics{},
+	}
+
+	if len(rc.retryOnStatus) == 0 {
+		rc.retryOnStatus = defaultRetryOnStatus[:]
+	}
+
+	if rc.maxRetries == 0 {
+		rc.maxRetries = defaultMaxRetries
+	}
+
+	return rc
+}
+
+// withOptions returns the retry policy overridden by the request options.
+func (rc retryConfig) withOptions(opts RequestOptions) retryConfig {
+	if opts.DisableRetry {
+		rc.disableRetry = true
+	}
+	if opts.MaxRetries > 0 {
+		rc.maxRetries = opts.MaxRetries
+	}
+	if len(opts.RetryOnStatus) > 0 {
+		rc.retryOnStatus = opts.RetryOnStatus
+	}
+	if opts.RetryBackoff != nil {
+		rc.retryBackoff = opts.RetryBackoff
+	}
+	return rc
+}
+
+// performWithRetry executes the request with the transport, retrying according to the retry policy.
+//
+// Each attempt is performed with a copy of the request, as the transport updates
+// the request URL and headers for the selected connection. The retries of a request
+// pinned to a node with RequestOptions.Node are sent to the same node, as its transport
+// has a single connection, never marked as dead.
+//
+// The requests failing to get a connection from the pool, when all the nodes are dead,
+// are not retried.
+func (c *BaseClient) performWithRetry(req *http.Request, opts RequestOptions) (*http.Response, error) {
+	var (
+		res *http.Response
+		err error
+
+		tp = c.Transport
+		rc = c.retry.withOptions(opts)
+	)
+
+	if opts.Node != "" {
+		if tp, err = c.nodeTransport(opts.Node); err != nil {
+			return nil, err
+		}
+	}
+
+	if rc.disableRetry {
+		return c.performAttempt(tp, req)
+	}
+
+	getBody := req.GetBody
+	if req.Body != nil && req.Body != http.NoBody && getBody == nil {
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(req.Body); err != nil {
+			return nil, err
+		}
+		getBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+		}
+		req.Body, _ = getBody()
+		req.GetBody = getBody
+	}
+
+	var retries int
+	defer func() { rc.metrics.record(retries, opts.Node == "") }()
+
+	for i := 0; i <= rc.maxRetries; i++ {
+		var (
+			shouldRetry     bool
+			shouldCloseBody bool
+		)
+
+		attempt := req.Clone(req.Context())
+		if i > 0 {
+			retries++
+			if req.Body != nil && req.Body != http.NoBody {
+				if attempt.Body, err = getBody(); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		res, err = c.performAttempt(tp, attempt)
+
+		// Fail fast when the cluster circuit breaker is open, the request is over the rate limits,
+		// or there is no connection in the pool
+		var (
+			cbErr *CircuitBreakerError
+			rlErr *RateLimitError
+		)
+		if (errors.As(err, &cbErr) && cbErr.Node == "") || errors.As(err, &rlErr) || isConnectionPoolError(err) {
+			break
+		}
+
+		// Retry upon decision by the user
+		if err != nil && (rc.retryOnError == nil || rc.retryOnError(attempt, err)) {
+			shouldRetry = true
+		}
+
+		// Retry on configured response statuses
+		if res != nil {
+			for _, code := range rc.retryOnStatus {
+				if res.StatusCode == code {
+					shouldRetry = true
+					shouldCloseBody = true
+				}
+			}
+		}
+
+		if !shouldRetry || i == rc.maxRetries {
+			break
+		}
+
+		// Drain and close body when retrying after response
+		if shouldCloseBody && res.Body != nil {
+			io.Copy(ioutil.Discard, res.Body) // errcheck exclude
+			res.Body.Close()
+		}
+
+		// Delay the retry if a backoff function is configured
+		if rc.retryBackoff != nil {
+			timer := time.NewTimer(rc.retryBackoff(i + 1))
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			case <-timer.C:
+			}
+		} else if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+	}
+
+	return res, err
+}
+
+// isConnectionPoolError returns true when the transport failed to get a connection from the pool.
+func isConnectionPoolError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "cannot get connection")
+}
+
+// performAttempt executes a single attempt of the request, applying the rate limits
+// and the cluster circuit breaker.
+func (c *BaseClient) performAttempt(tp elastictransport.Interface, req *http.Request) (*http.Response, error) {
+	if c.limiter != nil {
+		release, err := c.limiter.acquire(req)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.performWithBreaker(tp, req)
+
+		// Keep the request in flight until the response body is consumed.
+		if res != nil && res.Body != nil {
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: release}
+		} else {
+			release()
+		}
+
+		return res, err
+	}
+
+	return c.performWithBreaker(tp, req)
+}
+
+// performWithBreaker executes the request, unless the cluster circuit breaker is open.
+func (c *BaseClient) performWithBreaker(tp elastictransport.Interface, req *http.Request) (*http.Response, error) {
+	if c.breakers == nil || c.breakers.cluster == nil {
+		return tp.Perform(req)
+	}
+
+	cb := c.breakers.cluster
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := tp.Perform(req)
+	c.breakers.done(cb, res, err, time.Since(start))
+
+	return res, err
+}
@@ -0,0 +1,303 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultTLSSourceInterval = 10 * time.Second
+
+// TLSCertificates represents the certificates used to establish TLS connections.
+type TLSCertificates struct {
+	RootCAs           *x509.CertPool   // Certificate authorities; nil means the system pool.
+	ClientCertificate *tls.Certificate // Optional client certificate for mutual TLS authentication.
+}
+
+// TLSSource defines the interface for supplying TLS certificates.
+//
+// The client calls Certificates for every request, which allows to rotate
+// the certificates without recreating the client: when the returned pointers
+// change, new connections are established with the new certificates, and the
+// idle connections are closed. Connections in use are not affected.
+//
+// The source is only valid when the transport is not specified, or when it's http.Transport,
+// and it cannot be used together with Config.CertificateFingerprint.
+type TLSSource interface {
+	Certificates() (TLSCertificates, error)
+}
+
+// FileTLSSource reads PEM-encoded certificates from files, and reloads them when the files change.
+//
+// The files are checked for modifications at most once per Interval. When the
+// updated files cannot be loaded, eg. because they are still being written,
+// the previous certificates are used until the next check.
+type FileTLSSource struct {
+	CACertPath     string        // Path to the certificate authorities.
+	ClientCertPath string        // Path to the client certificate.
+	ClientKeyPath  string        // Path to the client certificate key.
+	Interval       time.Duration // How often to check the files for changes. Default: 10s.
+
+	mu      sync.Mutex
+	checked time.Time
+	files   []os.FileInfo
+	current *TLSCertificates
+}
+
+// Certificates returns the certificates from the files, re-reading them when they have changed.
+func (s *FileTLSSource) Certificates() (TLSCertificates, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultTLSSourceInterval
+	}
+
+	if s.current != nil && time.Since(s.checked) < interval {
+		return *s.current, nil
+	}
+	s.checked = time.Now()
+
+	files, err := s.stat()
+	if err == nil && s.current != nil && !filesChanged(s.files, files) {
+		return *s.current, nil
+	}
+
+	var certs TLSCertificates
+	if err == nil {
+		certs, err = s.load()
+	}
+	if err != nil {
+		if s.current != nil {
+			return *s.current, nil
+		}
+		return TLSCertificates{}, err
+	}
+	s.current, s.files = &certs, files
+
+	return certs, nil
+}
+
+func (s *FileTLSSource) stat() ([]os.FileInfo, error) {
+	var files []os.FileInfo
+	for _, path := range []string{s.CACertPath, s.ClientCertPath, s.ClientKeyPath} {
+		if path == "" {
+			files = append(files, nil)
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read certificate file: %s", err)
+		}
+		files = append(files, fi)
+	}
+	return files, nil
+}
+
+func (s *FileTLSSource) load() (TLSCertificates, error) {
+	var certs TLSCertificates
+
+	if s.CACertPath != "" {
+		caCert, err := ioutil.ReadFile(s.CACertPath)
+		if err != nil {
+			return certs, fmt.Errorf("cannot read CA certificate: %s", err)
+		}
+		if certs.RootCAs, err = newCertPool(caCert); err != nil {
+			return certs, err
+		}
+	}
+
+	if s.ClientCertPath != "" || s.ClientKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(s.ClientCertPath, s.ClientKeyPath)
+		if err != nil {
+			return certs, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		certs.ClientCertificate = &cert
+	}
+
+	return certs, nil
+}
+
+func filesChanged(a, b []os.FileInfo) bool {
+	for i := range a {
+		if (a[i] == nil) != (b[i] == nil) {
+			return true
+		}
+		if a[i] != nil && (!a[i].ModTime().Equal(b[i].ModTime()) || a[i].Size() != b[i].Size()) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCertPool returns a pool with the PEM-encoded certificates.
+func newCertPool(pem []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if ok := pool.AppendCertsFromPEM(pem); !ok {
+		return nil, errors.New("unable to add CA certificate")
+	}
+	return pool, nil
+}
+
+// configureTLS returns the transport from cfg, updated with the TLS options.
+//
+// The options are only valid when the transport is not specified, or when it's http.Transport;
+// the transport is cloned, so the original value is not modified. The transport is cloned as
+// well when CertificateFingerprint is set, as elastictransport installs its verification on it.
+func configureTLS(cfg Config) (http.RoundTripper, error) {
+	hasStatic := cfg.CACert != nil || cfg.ClientCert != nil || cfg.ClientCertKey != nil
+	if !hasStatic && cfg.TLSSource == nil && cfg.CertificateFingerprint == "" {
+		return cfg.Transport, nil
+	}
+
+	if hasStatic && cfg.TLSSource != nil {
+		return nil, errors.New("both TLSSource and CACert or client certificate are set")
+	}
+
+	if cfg.CertificateFingerprint != "" && cfg.TLSSource != nil {
+		return nil, errors.New("both TLSSource and CertificateFingerprint are set")
+	}
+
+	transport := cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	httpTransport, ok := transport.(*http.Transport)
+	if !ok {
+		// The fingerprint is only verified by elastictransport for http.Transport.
+		if !hasStatic && cfg.TLSSource == nil {
+			return transport, nil
+		}
+		if cfg.CACert != nil {
+			return nil, fmt.Errorf("unable to set CA certificate for transport of type %T", transport)
+		}
+		return nil, fmt.Errorf("unable to set TLS configuration for transport of type %T", transport)
+	}
+
+	httpTransport = httpTransport.Clone()
+	if httpTransport.TLSClientConfig == nil {
+		httpTransport.TLSClientConfig = &tls.Config{}
+	}
+	tlsConfig := httpTransport.TLSClientConfig
+
+	if cfg.CACert != nil {
+		pool, err := newCertPool(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != nil || cfg.ClientCertKey != nil {
+		cert, err := tls.X509KeyPair(cfg.ClientCert, cfg.ClientCertKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.TLSSource != nil {
+		return newTLSSourceTransport(httpTransport, cfg.TLSSource)
+	}
+
+	return httpTransport, nil
+}
+
+// tlsSourceTransport performs the requests with a copy of the transport configured with the
+// certificates from src, replaced by a new copy when the certificates change.
+//
+// The certificates are set in the TLS configuration of the transport, so the server certificate
+// is verified by crypto/tls against the host of the connection, and the proxy and the
+// TLSHandshakeTimeout settings still apply.
+type tlsSourceTransport struct {
+	src  TLSSource
+	base *http.Transport
+
+	mu      sync.Mutex
+	certs   TLSCertificates
+	current *http.Transport
+}
+
+func newTLSSourceTransport(base *http.Transport, src TLSSource) (*tlsSourceTransport, error) {
+	t := tlsSourceTransport{src: src, base: base}
+	if _, err := t.transport(); err != nil {
+		return nil, fmt.Errorf("unable to load TLS certificates: %s", err)
+	}
+	return &t, nil
+}
+
+// RoundTrip performs the request with the transport for the current certificates.
+func (t *tlsSourceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the current transport.
+func (t *tlsSourceTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	current := t.current
+	t.mu.Unlock()
+
+	if current != nil {
+		current.CloseIdleConnections()
+	}
+}
+
+// transport returns the transport for the current certificates, replacing the previous
+// transport when the certificates have changed; its connections in use are not affected.
+func (t *tlsSourceTransport) transport() (*http.Transport, error) {
+	certs, err := t.src.Certificates()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current != nil && certs.RootCAs == t.certs.RootCAs && certs.ClientCertificate == t.certs.ClientCertificate {
+		return t.current, nil
+	}
+
+	transport := t.base.Clone()
+	if certs.RootCAs != nil {
+		transport.TLSClientConfig.RootCAs = certs.RootCAs
+	}
+	if certs.ClientCertificate != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*certs.ClientCertificate}
+	}
+
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+	t.certs, t.current = certs, transport
+
+	return transport, nil
+}
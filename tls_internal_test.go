@@ -0,0 +1,572 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	return newTestCertForHosts(t, name, parent, "127.0.0.1")
+}
+
+// newTestCertForHosts returns a certificate valid for the hosts, IP addresses or DNS names.
+func newTestCertForHosts(t *testing.T, name string, parent *testCert, hosts ...string) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	serverCert := newTestCert(t, "server", ca)
+	clientCert := newTestCert(t, "client", ca)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	t.Run("Without client certificate", func(t *testing.T) {
+		c, err := NewClient(Config{Addresses: []string{server.URL}, CACert: ca.certPEM, DisableRetry: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, err := c.Info(); err == nil {
+			t.Errorf("Expected error without client certificate")
+		}
+	})
+
+	t.Run("With client certificate", func(t *testing.T) {
+		c, err := NewClient(Config{
+			Addresses:     []string{server.URL},
+			CACert:        ca.certPEM,
+			ClientCert:    clientCert.certPEM,
+			ClientCertKey: clientCert.keyPEM,
+			DisableRetry:  true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res, err := c.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+	})
+
+	t.Run("With invalid client certificate", func(t *testing.T) {
+		_, err := NewClient(Config{ClientCert: clientCert.certPEM, ClientCertKey: []byte("foo")})
+		if err == nil {
+			t.Errorf("Expected error for invalid key")
+		}
+	})
+
+	t.Run("With custom transport", func(t *testing.T) {
+		_, err := NewClient(Config{CACert: ca.certPEM, Transport: &mockTransp{}})
+		if err == nil {
+			t.Errorf("Expected error for transport of type %T", &mockTransp{})
+		}
+	})
+
+	t.Run("With TLSSource and CACert", func(t *testing.T) {
+		_, err := NewClient(Config{CACert: ca.certPEM, TLSSource: &FileTLSSource{}})
+		if err == nil {
+			t.Errorf("Expected error when both CACert and TLSSource are set")
+		}
+	})
+}
+
+func TestFileTLSSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		ca1 = newTestCert(t, "ca1", nil)
+		ca2 = newTestCert(t, "ca2", nil)
+
+		server1 = newTestCert(t, "server1", ca1)
+		server2 = newTestCert(t, "server2", ca2)
+		client1 = newTestCert(t, "client1", ca1)
+		client2 = newTestCert(t, "client2", ca2)
+
+		mu         sync.Mutex
+		serverCert = server1.tlsCertificate(t)
+		clientCAs  = x509.NewCertPool()
+	)
+	clientCAs.AddCert(ca1.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    clientCAs,
+			}, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	var (
+		caPath   = filepath.Join(dir, "ca.crt")
+		certPath = filepath.Join(dir, "client.crt")
+		keyPath  = filepath.Join(dir, "client.key")
+	)
+	writeFiles := func(ca, client *testCert) {
+		for path, data := range map[string][]byte{caPath: ca.certPEM, certPath: client.certPEM, keyPath: client.keyPEM} {
+			if err := ioutil.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeFiles(ca1, client1)
+
+	c, err := NewClient(Config{
+		Addresses:    []string{server.URL},
+		Transport:    &http.Transport{DisableKeepAlives: true},
+		DisableRetry: true,
+		TLSSource: &FileTLSSource{
+			CACertPath:     caPath,
+			ClientCertPath: certPath,
+			ClientKeyPath:  keyPath,
+			Interval:       time.Nanosecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	info := func() (string, error) {
+		res, err := c.Info()
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return string(body), nil
+	}
+
+	if cn, err := info(); err != nil || cn != "client1" {
+		t.Fatalf("Unexpected response: %q, %v", cn, err)
+	}
+
+	// Rotate the certificates on the server.
+	mu.Lock()
+	serverCert = server2.tlsCertificate(t)
+	clientCAs = x509.NewCertPool()
+	clientCAs.AddCert(ca2.cert)
+	mu.Unlock()
+
+	if _, err := info(); err == nil {
+		t.Fatalf("Expected error for certificate signed by unknown authority")
+	}
+
+	// Rotate the certificates on the client; ensure the modification time changes.
+	writeFiles(ca2, client2)
+	future := time.Now().Add(time.Minute)
+	for _, path := range []string{caPath, certPath, keyPath} {
+		os.Chtimes(path, future, future) // errcheck exclude
+	}
+
+	if cn, err := info(); err != nil || cn != "client2" {
+		t.Fatalf("Unexpected response after rotation: %q, %v", cn, err)
+	}
+
+	// Invalid files keep the previous certificates.
+	ioutil.WriteFile(keyPath, []byte("foo"), 0600) // errcheck exclude
+	if cn, err := info(); err != nil || cn != "client2" {
+		t.Fatalf("Unexpected response with invalid files: %q, %v", cn, err)
+	}
+}
+
+type staticTLSSource TLSCertificates
+
+func (s staticTLSSource) Certificates() (TLSCertificates, error) { return TLSCertificates(s), nil }
+
+func TestTLSSourceTransport(t *testing.T) {
+	var (
+		ca         = newTestCert(t, "ca", nil)
+		serverCert = newTestCert(t, "server", ca)
+		clientCert = newTestCert(t, "client", ca)
+		clientCAs  = x509.NewCertPool()
+		rootCAs    = x509.NewCertPool()
+	)
+	clientCAs.AddCert(ca.cert)
+	rootCAs.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	var (
+		mu      sync.Mutex
+		tunnels []string
+	)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		tunnels = append(tunnels, r.Host)
+		mu.Unlock()
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n") // errcheck exclude
+		rw.Flush()                                                    // errcheck exclude
+
+		go io.Copy(upstream, rw.Reader)          // errcheck exclude
+		io.Copy(conn, bufio.NewReader(upstream)) // errcheck exclude
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	source := staticTLSSource{RootCAs: rootCAs, ClientCertificate: &tls.Certificate{}}
+	*source.ClientCertificate = clientCert.tlsCertificate(t)
+
+	newClient := func(t *testing.T, transport *http.Transport) *Client {
+		c, err := NewClient(Config{
+			Addresses:    []string{server.URL},
+			Transport:    transport,
+			DisableRetry: true,
+			TLSSource:    source,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return c
+	}
+
+	t.Run("Through proxy", func(t *testing.T) {
+		transport := &http.Transport{
+			Proxy:               http.ProxyURL(proxyURL),
+			TLSHandshakeTimeout: time.Second,
+			DisableKeepAlives:   true,
+		}
+		c := newClient(t, transport)
+
+		tp, err := c.transportConfig.Transport.(*tlsSourceTransport).transport()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if tp.DialTLSContext != nil || tp.TLSHandshakeTimeout != time.Second || tp.Proxy == nil || tp.TLSClientConfig.RootCAs != rootCAs {
+			t.Errorf("Unexpected transport configuration: %+v", tp)
+		}
+		if cfg := transport.TLSClientConfig; cfg != nil && (cfg.RootCAs != nil || len(cfg.Certificates) > 0) {
+			t.Errorf("Expected the original transport to be left unmodified")
+		}
+
+		res, err := c.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		if string(body) != "client" {
+			t.Errorf("Unexpected response: %q", body)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(tunnels) != 1 || tunnels[0] != strings.TrimPrefix(server.URL, "https://") {
+			t.Errorf("Expected the request to go through the proxy, got: %v", tunnels)
+		}
+	})
+
+	t.Run("Server name mismatch", func(t *testing.T) {
+		c := newClient(t, &http.Transport{
+			TLSClientConfig:   &tls.Config{ServerName: "example.com"},
+			DisableKeepAlives: true,
+		})
+		if _, err := c.Info(); err == nil || !strings.Contains(err.Error(), "example.com") {
+			t.Errorf("Expected error for the server name, got: %v", err)
+		}
+	})
+
+	t.Run("IP address mismatch", func(t *testing.T) {
+		// The certificate is signed by the trusted authority, but it's not valid for the IP address
+		otherCert := newTestCertForHosts(t, "other", ca, "other.example.com")
+		other := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{}"))
+		}))
+		other.TLS = &tls.Config{Certificates: []tls.Certificate{otherCert.tlsCertificate(t)}}
+		other.StartTLS()
+		defer other.Close()
+
+		c, err := NewClient(Config{
+			Addresses:    []string{other.URL},
+			Transport:    &http.Transport{DisableKeepAlives: true},
+			DisableRetry: true,
+			TLSSource:    source,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		_, err = c.Info()
+		var hostErr x509.HostnameError
+		if !errors.As(err, &hostErr) {
+			t.Errorf("Expected error for the IP address, got: %v", err)
+		}
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		var (
+			mu       sync.Mutex
+			certs    = TLSCertificates{RootCAs: x509.NewCertPool()}
+			rotating = tlsSourceFunc(func() (TLSCertificates, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return certs, nil
+			})
+		)
+		c, err := NewClient(Config{Addresses: []string{server.URL}, DisableRetry: true, TLSSource: rotating})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, err := c.Info(); err == nil {
+			t.Fatalf("Expected error for the unknown authority")
+		}
+
+		mu.Lock()
+		certs = TLSCertificates{RootCAs: rootCAs, ClientCertificate: source.ClientCertificate}
+		mu.Unlock()
+
+		res, err := c.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+	})
+}
+
+type tlsSourceFunc func() (TLSCertificates, error)
+
+func (f tlsSourceFunc) Certificates() (TLSCertificates, error) { return f() }
+
+func TestCertificateFingerprint(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	serverCert := newTestCert(t, "server", ca)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert.tlsCertificate(t)}}
+	server.StartTLS()
+	defer server.Close()
+
+	t.Run("Matching fingerprint", func(t *testing.T) {
+		c, err := NewClient(Config{
+			Addresses:              []string{server.URL},
+			CertificateFingerprint: strings.ToUpper(sha256Hex(serverCert.cert.Raw)),
+			DisableRetry:           true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res, err := c.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+	})
+
+	t.Run("Mismatching fingerprint", func(t *testing.T) {
+		c, err := NewClient(Config{
+			Addresses:              []string{server.URL},
+			CertificateFingerprint: sha256Hex([]byte("foo")),
+			DisableRetry:           true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, err := c.Info(); err == nil || !strings.Contains(err.Error(), "fingerprint mismatch") {
+			t.Errorf("Expected fingerprint mismatch error, got: %v", err)
+		}
+	})
+
+	t.Run("With circuit breaker", func(t *testing.T) {
+		c, err := NewClient(Config{
+			Addresses:              []string{server.URL},
+			CertificateFingerprint: sha256Hex(serverCert.cert.Raw),
+			CircuitBreaker:         &CircuitBreakerConfig{},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res, err := c.Info()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+
+		c, err = NewClient(Config{
+			Addresses:              []string{server.URL},
+			CertificateFingerprint: sha256Hex([]byte("foo")),
+			CircuitBreaker:         &CircuitBreakerConfig{},
+			DisableRetry:           true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, err := c.Info(); err == nil || !strings.Contains(err.Error(), "fingerprint mismatch") {
+			t.Errorf("Expected fingerprint mismatch error, got: %v", err)
+		}
+	})
+
+	t.Run("Transport not modified", func(t *testing.T) {
+		transport := &http.Transport{}
+		_, err := NewClient(Config{
+			Addresses:              []string{server.URL},
+			CertificateFingerprint: sha256Hex(serverCert.cert.Raw),
+			CircuitBreaker:         &CircuitBreakerConfig{},
+			Transport:              transport,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if transport.DialTLS != nil || transport.DialTLSContext != nil {
+			t.Error("Expected the transport to be cloned")
+		}
+	})
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -25,7 +25,6 @@ package get
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -36,6 +35,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -47,13 +47,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type Get struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	paramSet int
 
@@ -81,10 +79,10 @@ func NewGetFunc(tp elastictransport.Interface) NewGet {
 // https://www.elastic.co/guide/en/elasticsearch/reference/{branch}/async-search.html
 func New(tp elastictransport.Interface) *Get {
 	r := &Get{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -94,12 +92,15 @@ func New(tp elastictransport.Interface) *Get {
 // given parameters.
 func (r *Get) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
-	r.path.Scheme = "http"
+	buf := gobytes.NewBuffer(nil)
+
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == idMask:
@@ -112,17 +113,17 @@ func (r *Get) HttpRequest(ctx context.Context) (*http.Request, error) {
 		method = http.MethodGet
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
@@ -167,7 +168,7 @@ func (r Get) Do(ctx context.Context) (*Response, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -177,7 +178,7 @@ func (r Get) Do(ctx context.Context) (*Response, error) {
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -213,6 +214,28 @@ func (r *Get) Header(key, value string) *Get {
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *Get) Serializer(s serializer.Serializer) *Get {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the Get request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *Get) Clone() *Get {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // Id The async search ID
 // API Name: id
 func (r *Get) Id(v string) *Get {
@@ -25,7 +25,6 @@ package deleteautoscalingpolicy
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +34,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -46,13 +46,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type DeleteAutoscalingPolicy struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	paramSet int
 
@@ -80,10 +78,10 @@ func NewDeleteAutoscalingPolicyFunc(tp elastictransport.Interface) NewDeleteAuto
 // https://www.elastic.co/guide/en/elasticsearch/reference/{branch}/autoscaling-delete-autoscaling-policy.html
 func New(tp elastictransport.Interface) *DeleteAutoscalingPolicy {
 	r := &DeleteAutoscalingPolicy{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -93,12 +91,15 @@ func New(tp elastictransport.Interface) *DeleteAutoscalingPolicy {
 // given parameters.
 func (r *DeleteAutoscalingPolicy) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
-	r.path.Scheme = "http"
+	buf := gobytes.NewBuffer(nil)
+
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == nameMask:
@@ -113,17 +114,17 @@ func (r *DeleteAutoscalingPolicy) HttpRequest(ctx context.Context) (*http.Reques
 		method = http.MethodDelete
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
@@ -166,7 +167,7 @@ func (r DeleteAutoscalingPolicy) Do(ctx context.Context) (*Response, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -176,7 +177,7 @@ func (r DeleteAutoscalingPolicy) Do(ctx context.Context) (*Response, error) {
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -212,6 +213,28 @@ func (r *DeleteAutoscalingPolicy) Header(key, value string) *DeleteAutoscalingPo
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *DeleteAutoscalingPolicy) Serializer(s serializer.Serializer) *DeleteAutoscalingPolicy {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the DeleteAutoscalingPolicy request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *DeleteAutoscalingPolicy) Clone() *DeleteAutoscalingPolicy {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // Name the name of the autoscaling policy
 // API Name: name
 func (r *DeleteAutoscalingPolicy) Name(v string) *DeleteAutoscalingPolicy {
@@ -26,7 +26,6 @@ package getautoscalingcapacity
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -36,6 +35,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -43,13 +43,11 @@ import (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type GetAutoscalingCapacity struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	paramSet int
 }
@@ -74,10 +72,10 @@ func NewGetAutoscalingCapacityFunc(tp elastictransport.Interface) NewGetAutoscal
 // https://www.elastic.co/guide/en/elasticsearch/reference/{branch}/autoscaling-get-autoscaling-capacity.html
 func New(tp elastictransport.Interface) *GetAutoscalingCapacity {
 	r := &GetAutoscalingCapacity{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -87,12 +85,15 @@ func New(tp elastictransport.Interface) *GetAutoscalingCapacity {
 // given parameters.
 func (r *GetAutoscalingCapacity) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
-	r.path.Scheme = "http"
+	buf := gobytes.NewBuffer(nil)
+
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == 0:
@@ -104,17 +105,17 @@ func (r *GetAutoscalingCapacity) HttpRequest(ctx context.Context) (*http.Request
 		method = http.MethodGet
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
@@ -157,7 +158,7 @@ func (r GetAutoscalingCapacity) Do(ctx context.Context) (*Response, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -167,7 +168,7 @@ func (r GetAutoscalingCapacity) Do(ctx context.Context) (*Response, error) {
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -202,3 +203,25 @@ func (r *GetAutoscalingCapacity) Header(key, value string) *GetAutoscalingCapaci
 
 	return r
 }
+
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *GetAutoscalingCapacity) Serializer(s serializer.Serializer) *GetAutoscalingCapacity {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the GetAutoscalingCapacity request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *GetAutoscalingCapacity) Clone() *GetAutoscalingCapacity {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
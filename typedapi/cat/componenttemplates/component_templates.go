@@ -24,7 +24,6 @@ package componenttemplates
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -34,6 +33,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -45,13 +45,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type ComponentTemplates struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	paramSet int
 
@@ -76,10 +74,10 @@ func NewComponentTemplatesFunc(tp elastictransport.Interface) NewComponentTempla
 // https://www.elastic.co/guide/en/elasticsearch/reference/master/cat-compoentn-templates.html
 func New(tp elastictransport.Interface) *ComponentTemplates {
 	r := &ComponentTemplates{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -89,12 +87,15 @@ func New(tp elastictransport.Interface) *ComponentTemplates {
 // given parameters.
 func (r *ComponentTemplates) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
-	r.path.Scheme = "http"
+	buf := gobytes.NewBuffer(nil)
+
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == 0:
@@ -116,17 +117,17 @@ func (r *ComponentTemplates) HttpRequest(ctx context.Context) (*http.Request, er
 		method = http.MethodGet
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
@@ -169,7 +170,7 @@ func (r ComponentTemplates) Do(ctx context.Context) (Response, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(&response)
+		err = r.serializer.NewDecoder(res.Body).Decode(&response)
 		if err != nil {
 			return nil, err
 		}
@@ -179,7 +180,7 @@ func (r ComponentTemplates) Do(ctx context.Context) (Response, error) {
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -215,6 +216,28 @@ func (r *ComponentTemplates) Header(key, value string) *ComponentTemplates {
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *ComponentTemplates) Serializer(s serializer.Serializer) *ComponentTemplates {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the ComponentTemplates request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *ComponentTemplates) Clone() *ComponentTemplates {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // Name A pattern that returned component template names must match
 // API Name: name
 func (r *ComponentTemplates) Name(v string) *ComponentTemplates {
@@ -25,7 +25,6 @@ package follow
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -34,6 +33,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -45,13 +45,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type Follow struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	req *Request
 	raw io.Reader
@@ -82,10 +80,10 @@ func NewFollowFunc(tp elastictransport.Interface) NewFollow {
 // https://www.elastic.co/guide/en/elasticsearch/reference/{branch}/ccr-put-follow.html
 func New(tp elastictransport.Interface) *Follow {
 	r := &Follow{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -110,24 +108,27 @@ func (r *Follow) Request(req *Request) *Follow {
 // given parameters.
 func (r *Follow) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
+	buf := gobytes.NewBuffer(nil)
+
 	if r.raw != nil {
-		r.buf.ReadFrom(r.raw)
+		buf.ReadFrom(r.raw)
 	} else if r.req != nil {
-		data, err := json.Marshal(r.req)
+		data, err := r.serializer.Marshal(r.req)
 
 		if err != nil {
 			return nil, fmt.Errorf("could not serialise request for Follow: %w", err)
 		}
 
-		r.buf.Write(data)
+		buf.Write(data)
 	}
 
-	r.path.Scheme = "http"
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == indexMask:
@@ -142,23 +143,23 @@ func (r *Follow) HttpRequest(ctx context.Context) (*http.Request, error) {
 		method = http.MethodPut
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
 
 	if req.Header.Get("Content-Type") == "" {
-		if r.buf.Len() > 0 {
+		if buf.Len() > 0 {
 			req.Header.Set("Content-Type", "application/vnd.elasticsearch+json;compatible-with=8")
 		}
 	}
@@ -201,7 +202,7 @@ func (r Follow) Do(ctx context.Context) (*Response, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -211,7 +212,7 @@ func (r Follow) Do(ctx context.Context) (*Response, error) {
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -226,6 +227,28 @@ func (r *Follow) Header(key, value string) *Follow {
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *Follow) Serializer(s serializer.Serializer) *Follow {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the Follow request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *Follow) Clone() *Follow {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // Index The name of the follower index
 // API Name: index
 func (r *Follow) Index(v string) *Follow {
@@ -24,7 +24,6 @@ package forgetfollower
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -33,6 +32,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -44,13 +44,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type ForgetFollower struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	req *Request
 	raw io.Reader
@@ -80,10 +78,10 @@ func NewForgetFollowerFunc(tp elastictransport.Interface) NewForgetFollower {
 // https://www.elastic.co/guide/en/elasticsearch/reference/{branch}/ccr-post-forget-follower.html
 func New(tp elastictransport.Interface) *ForgetFollower {
 	r := &ForgetFollower{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -108,24 +106,27 @@ func (r *ForgetFollower) Request(req *Request) *ForgetFollower {
 // given parameters.
 func (r *ForgetFollower) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
+	buf := gobytes.NewBuffer(nil)
+
 	if r.raw != nil {
-		r.buf.ReadFrom(r.raw)
+		buf.ReadFrom(r.raw)
 	} else if r.req != nil {
-		data, err := json.Marshal(r.req)
+		data, err := r.serializer.Marshal(r.req)
 
 		if err != nil {
 			return nil, fmt.Errorf("could not serialise request for ForgetFollower: %w", err)
 		}
 
-		r.buf.Write(data)
+		buf.Write(data)
 	}
 
-	r.path.Scheme = "http"
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == indexMask:
@@ -140,23 +141,23 @@ func (r *ForgetFollower) HttpRequest(ctx context.Context) (*http.Request, error)
 		method = http.MethodPost
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
 
 	if req.Header.Get("Content-Type") == "" {
-		if r.buf.Len() > 0 {
+		if buf.Len() > 0 {
 			req.Header.Set("Content-Type", "application/vnd.elasticsearch+json;compatible-with=8")
 		}
 	}
@@ -199,7 +200,7 @@ func (r ForgetFollower) Do(ctx context.Context) (*Response, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -209,7 +210,7 @@ func (r ForgetFollower) Do(ctx context.Context) (*Response, error) {
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -224,6 +225,28 @@ func (r *ForgetFollower) Header(key, value string) *ForgetFollower {
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *ForgetFollower) Serializer(s serializer.Serializer) *ForgetFollower {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the ForgetFollower request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *ForgetFollower) Clone() *ForgetFollower {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // Index the name of the leader index for which specified follower retention leases
 // should be removed
 // API Name: index
@@ -26,7 +26,6 @@ package putautofollowpattern
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +34,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -46,13 +46,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type PutAutoFollowPattern struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	req *Request
 	raw io.Reader
@@ -84,10 +82,10 @@ func NewPutAutoFollowPatternFunc(tp elastictransport.Interface) NewPutAutoFollow
 // https://www.elastic.co/guide/en/elasticsearch/reference/{branch}/ccr-put-auto-follow-pattern.html
 func New(tp elastictransport.Interface) *PutAutoFollowPattern {
 	r := &PutAutoFollowPattern{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -112,24 +110,27 @@ func (r *PutAutoFollowPattern) Request(req *Request) *PutAutoFollowPattern {
 // given parameters.
 func (r *PutAutoFollowPattern) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
+	buf := gobytes.NewBuffer(nil)
+
 	if r.raw != nil {
-		r.buf.ReadFrom(r.raw)
+		buf.ReadFrom(r.raw)
 	} else if r.req != nil {
-		data, err := json.Marshal(r.req)
+		data, err := r.serializer.Marshal(r.req)
 
 		if err != nil {
 			return nil, fmt.Errorf("could not serialise request for PutAutoFollowPattern: %w", err)
 		}
 
-		r.buf.Write(data)
+		buf.Write(data)
 	}
 
-	r.path.Scheme = "http"
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == nameMask:
@@ -144,23 +145,23 @@ func (r *PutAutoFollowPattern) HttpRequest(ctx context.Context) (*http.Request,
 		method = http.MethodPut
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
 
 	if req.Header.Get("Content-Type") == "" {
-		if r.buf.Len() > 0 {
+		if buf.Len() > 0 {
 			req.Header.Set("Content-Type", "application/vnd.elasticsearch+json;compatible-with=8")
 		}
 	}
@@ -203,7 +204,7 @@ func (r PutAutoFollowPattern) Do(ctx context.Context) (*Response, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -213,7 +214,7 @@ func (r PutAutoFollowPattern) Do(ctx context.Context) (*Response, error) {
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -228,6 +229,28 @@ func (r *PutAutoFollowPattern) Header(key, value string) *PutAutoFollowPattern {
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *PutAutoFollowPattern) Serializer(s serializer.Serializer) *PutAutoFollowPattern {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the PutAutoFollowPattern request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *PutAutoFollowPattern) Clone() *PutAutoFollowPattern {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // Name The name of the collection of auto-follow patterns.
 // API Name: name
 func (r *PutAutoFollowPattern) Name(v string) *PutAutoFollowPattern {
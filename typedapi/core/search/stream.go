@@ -0,0 +1,45 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package search
+
+import (
+	"context"
+
+	"github.com/elastic/go-elasticsearch/v8/internal/streaming"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+)
+
+// Stream runs the request and decodes the hits incrementally from the response body,
+// calling fn with each hit instead of collecting them in Response.Hits.Hits, to bound
+// the memory used by large responses, eg. for exports.
+//
+// The other fields of the response, eg. the total hits, the aggregations and the scroll ID,
+// are populated as with Do. An error returned by fn stops the decoding and is returned.
+func (r Search) Stream(ctx context.Context, fn func(types.Hit) error) (*Response, error) {
+	res, err := r.Perform(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := NewResponse()
+	if err := streaming.DecodeResponse(res, r.serializer, response, fn); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
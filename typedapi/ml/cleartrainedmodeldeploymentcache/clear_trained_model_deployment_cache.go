@@ -24,7 +24,6 @@ package cleartrainedmodeldeploymentcache
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -34,6 +33,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -45,13 +45,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type ClearTrainedModelDeploymentCache struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	paramSet int
 
@@ -78,10 +76,10 @@ func NewClearTrainedModelDeploymentCacheFunc(tp elastictransport.Interface) NewC
 // https://www.elastic.co/guide/en/elasticsearch/reference/master/clear-trained-model-deployment-cache.html
 func New(tp elastictransport.Interface) *ClearTrainedModelDeploymentCache {
 	r := &ClearTrainedModelDeploymentCache{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -91,12 +89,15 @@ func New(tp elastictransport.Interface) *ClearTrainedModelDeploymentCache {
 // given parameters.
 func (r *ClearTrainedModelDeploymentCache) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
-	r.path.Scheme = "http"
+	buf := gobytes.NewBuffer(nil)
+
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == modelidMask:
@@ -117,23 +118,23 @@ func (r *ClearTrainedModelDeploymentCache) HttpRequest(ctx context.Context) (*ht
 		method = http.MethodPost
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
 
 	if req.Header.Get("Content-Type") == "" {
-		if r.buf.Len() > 0 {
+		if buf.Len() > 0 {
 			req.Header.Set("Content-Type", "application/vnd.elasticsearch+json;compatible-with=8")
 		}
 	}
@@ -176,7 +177,7 @@ func (r ClearTrainedModelDeploymentCache) Do(ctx context.Context) (*Response, er
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -186,7 +187,7 @@ func (r ClearTrainedModelDeploymentCache) Do(ctx context.Context) (*Response, er
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -222,6 +223,28 @@ func (r *ClearTrainedModelDeploymentCache) Header(key, value string) *ClearTrain
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *ClearTrainedModelDeploymentCache) Serializer(s serializer.Serializer) *ClearTrainedModelDeploymentCache {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the ClearTrainedModelDeploymentCache request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *ClearTrainedModelDeploymentCache) Clone() *ClearTrainedModelDeploymentCache {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // ModelId The unique identifier of the trained model.
 // API Name: modelid
 func (r *ClearTrainedModelDeploymentCache) ModelId(v string) *ClearTrainedModelDeploymentCache {
@@ -25,7 +25,6 @@ package clearrepositoriesmeteringarchive
 import (
 	gobytes "bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -35,6 +34,7 @@ import (
 	"strings"
 
 	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 )
 
@@ -48,13 +48,11 @@ const (
 var ErrBuildPath = errors.New("cannot build path, check for missing path parameters")
 
 type ClearRepositoriesMeteringArchive struct {
-	transport elastictransport.Interface
+	transport  elastictransport.Interface
+	serializer serializer.Serializer
 
 	headers http.Header
 	values  url.Values
-	path    url.URL
-
-	buf *gobytes.Buffer
 
 	paramSet int
 
@@ -85,10 +83,10 @@ func NewClearRepositoriesMeteringArchiveFunc(tp elastictransport.Interface) NewC
 // https://www.elastic.co/guide/en/elasticsearch/reference/current/clear-repositories-metering-archive-api.html
 func New(tp elastictransport.Interface) *ClearRepositoriesMeteringArchive {
 	r := &ClearRepositoriesMeteringArchive{
-		transport: tp,
-		values:    make(url.Values),
-		headers:   make(http.Header),
-		buf:       gobytes.NewBuffer(nil),
+		transport:  tp,
+		serializer: serializer.FromTransport(tp),
+		values:     make(url.Values),
+		headers:    make(http.Header),
 	}
 
 	return r
@@ -98,12 +96,15 @@ func New(tp elastictransport.Interface) *ClearRepositoriesMeteringArchive {
 // given parameters.
 func (r *ClearRepositoriesMeteringArchive) HttpRequest(ctx context.Context) (*http.Request, error) {
 	var path strings.Builder
+	var u url.URL
 	var method string
 	var req *http.Request
 
 	var err error
 
-	r.path.Scheme = "http"
+	buf := gobytes.NewBuffer(nil)
+
+	u.Scheme = "http"
 
 	switch {
 	case r.paramSet == nodeidMask|maxarchiveversionMask:
@@ -121,17 +122,17 @@ func (r *ClearRepositoriesMeteringArchive) HttpRequest(ctx context.Context) (*ht
 		method = http.MethodDelete
 	}
 
-	r.path.Path = path.String()
-	r.path.RawQuery = r.values.Encode()
+	u.Path = path.String()
+	u.RawQuery = r.values.Encode()
 
-	if r.path.Path == "" {
+	if u.Path == "" {
 		return nil, ErrBuildPath
 	}
 
 	if ctx != nil {
-		req, err = http.NewRequestWithContext(ctx, method, r.path.String(), r.buf)
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
 	} else {
-		req, err = http.NewRequest(method, r.path.String(), r.buf)
+		req, err = http.NewRequest(method, u.String(), buf)
 	}
 
 	req.Header = r.headers.Clone()
@@ -174,7 +175,7 @@ func (r ClearRepositoriesMeteringArchive) Do(ctx context.Context) (*Response, er
 	defer res.Body.Close()
 
 	if res.StatusCode < 299 {
-		err = json.NewDecoder(res.Body).Decode(response)
+		err = r.serializer.NewDecoder(res.Body).Decode(response)
 		if err != nil {
 			return nil, err
 		}
@@ -184,7 +185,7 @@ func (r ClearRepositoriesMeteringArchive) Do(ctx context.Context) (*Response, er
 	}
 
 	errorResponse := types.NewElasticsearchError()
-	err = json.NewDecoder(res.Body).Decode(errorResponse)
+	err = r.serializer.NewDecoder(res.Body).Decode(errorResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -220,6 +221,28 @@ func (r *ClearRepositoriesMeteringArchive) Header(key, value string) *ClearRepos
 	return r
 }
 
+// Serializer sets the serializer of the request and response bodies,
+// overriding the serializer provided by the transport.
+func (r *ClearRepositoriesMeteringArchive) Serializer(s serializer.Serializer) *ClearRepositoriesMeteringArchive {
+	r.serializer = s
+
+	return r
+}
+
+// Clone returns a copy of the ClearRepositoriesMeteringArchive request, which can be modified and executed
+// independently of the original, eg. concurrently. The body set with Request is
+// shared by the copies, and the body set with Raw can only be read once.
+func (r *ClearRepositoriesMeteringArchive) Clone() *ClearRepositoriesMeteringArchive {
+	n := *r
+	n.headers = r.headers.Clone()
+	n.values = make(url.Values, len(r.values))
+	for key, values := range r.values {
+		n.values[key] = append([]string(nil), values...)
+	}
+
+	return &n
+}
+
 // NodeId Comma-separated list of node IDs or names used to limit returned information.
 // All the nodes selective options are explained
 // [here](https://www.elastic.co/guide/en/elasticsearch/reference/current/cluster.html#cluster-nodes).
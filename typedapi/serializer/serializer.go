@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package serializer defines the encoding of the request and response bodies of the typed API.
+//
+// The typed API uses encoding/json by default. Implement the Serializer interface to use
+// another codec, and configure it for the client with elasticsearch.Config.Serializer,
+// or for a single request with the Serializer method of the request builders:
+//
+//	es, _ := elasticsearch.NewTypedClient(elasticsearch.Config{Serializer: mySerializer{}})
+//	es.Search().Serializer(otherSerializer{}).Do(ctx)
+//
+// A serializer must honor the json.Marshaler and json.Unmarshaler implementations
+// and the "json" struct tags of the typedapi types; use the serializertest package
+// to check the conformance of an implementation.
+//
+// The serializer encodes and decodes the top-level request and response bodies only:
+// the typedapi types implementing json.Unmarshaler, eg. the ones holding variants or
+// additional properties, decode their own fields with encoding/json, whichever the
+// serializer in use.
+package serializer
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Serializer encodes the request bodies and decodes the response bodies.
+//
+// A serializer must be safe for concurrent use.
+type Serializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	NewDecoder(r io.Reader) Decoder
+}
+
+// Decoder decodes the values from a stream.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Provider is implemented by the transports configuring the serializer of the typed API, eg. the TypedClient.
+type Provider interface {
+	Serializer() Serializer
+}
+
+// Default is the serializer used when the transport doesn't provide one.
+var Default Serializer = JSON{}
+
+// JSON implements the Serializer interface with encoding/json.
+type JSON struct{}
+
+// Marshal returns the JSON encoding of v.
+func (JSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// NewDecoder returns a JSON decoder reading from r.
+func (JSON) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+// FromTransport returns the serializer provided by the transport, or the Default serializer.
+func FromTransport(tp interface{}) Serializer {
+	if p, ok := tp.(Provider); ok {
+		if s := p.Serializer(); s != nil {
+			return s
+		}
+	}
+	return Default
+}
@@ -0,0 +1,255 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package serializertest provides a conformance test suite for the implementations of serializer.Serializer.
+//
+// Run the suite from a test of the package implementing the serializer:
+//
+//	func TestSerializer(t *testing.T) {
+//	  serializertest.Run(t, mySerializer{})
+//	}
+package serializertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/index"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/serializer"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/result"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/totalhitsrelation"
+)
+
+const searchResponse = `{
+  "took": 5,
+  "timed_out": false,
+  "_shards": {"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+  "hits": {
+    "total": {"value": 1, "relation": "eq"},
+    "max_score": 1.3,
+    "hits": [
+      {"_index": "test", "_id": "1", "_score": 1.3, "_source": {"title": "Test", "tags": ["one", "two"]}}
+    ]
+  },
+  "aggregations": {
+    "sterms#tags": {
+      "doc_count_error_upper_bound": 0,
+      "sum_other_doc_count": 0,
+      "buckets": [{"key": "one", "doc_count": 1}, {"key": "two", "doc_count": 1}]
+    }
+  }
+}`
+
+const errorResponse = `{
+  "error": {
+    "root_cause": [{"type": "index_not_found_exception", "reason": "no such index [test]", "index": "test"}],
+    "type": "index_not_found_exception",
+    "reason": "no such index [test]",
+    "index": "test"
+  },
+  "status": 404
+}`
+
+// Run runs the conformance test suite for the serializer.
+//
+// The suite checks that the serializer encodes the typed API requests and decodes
+// the responses like encoding/json, honoring the struct tags, and the json.Marshaler
+// and json.Unmarshaler implementations of the types.
+func Run(t *testing.T, s serializer.Serializer) {
+	t.Helper()
+
+	t.Run("Marshal request", func(t *testing.T) {
+		size := 10
+		req := search.Request{
+			Size: &size,
+			Query: &types.Query{
+				Bool: &types.BoolQuery{
+					Must:   []types.Query{{Match: map[string]types.MatchQuery{"title": {Query: "test"}}}},
+					Filter: []types.Query{{Term: map[string]types.TermQuery{"tags": {Value: "one"}}}},
+				},
+			},
+			Aggregations: map[string]types.Aggregations{
+				"tags": {Terms: &types.TermsAggregation{Field: some("tags")}},
+			},
+			Ext: map[string]json.RawMessage{"custom": json.RawMessage(`{"enabled":true}`)},
+		}
+
+		assertMarshal(t, s, req)
+	})
+
+	t.Run("Marshal custom marshaler", func(t *testing.T) {
+		cause := types.ErrorCause{
+			Type:     "exception",
+			Reason:   some("failure"),
+			Metadata: map[string]json.RawMessage{"index": json.RawMessage(`"test"`)},
+		}
+
+		data := assertMarshal(t, s, cause)
+		if !strings.Contains(string(data), `"index"`) {
+			t.Errorf("Expected the additional properties to be inlined, got: %s", data)
+		}
+	})
+
+	t.Run("Marshal document", func(t *testing.T) {
+		assertMarshal(t, s, map[string]interface{}{
+			"title":   "Test <&>",
+			"count":   42,
+			"ratio":   0.5,
+			"tags":    []string{"one", "two"},
+			"nested":  map[string]interface{}{"enabled": true, "value": nil},
+			"unicode": "žluťoučký 🐴",
+		})
+	})
+
+	t.Run("Decode response", func(t *testing.T) {
+		res := search.NewResponse()
+		if err := s.NewDecoder(strings.NewReader(searchResponse)).Decode(res); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if res.Took != 5 || res.Shards_.Successful != 1 {
+			t.Errorf("Unexpected response: %+v", res)
+		}
+		if res.Hits.Total == nil || res.Hits.Total.Value != 1 || res.Hits.Total.Relation != totalhitsrelation.Eq {
+			t.Errorf("Unexpected total: %+v", res.Hits.Total)
+		}
+		if len(res.Hits.Hits) != 1 || res.Hits.Hits[0].Id_ != "1" {
+			t.Fatalf("Unexpected hits: %+v", res.Hits.Hits)
+		}
+		assertJSONEqual(t, res.Hits.Hits[0].Source_, []byte(`{"title":"Test","tags":["one","two"]}`))
+
+		agg, ok := res.Aggregations["tags"].(*types.StringTermsAggregate)
+		if !ok {
+			t.Fatalf("Unexpected aggregation: %#v", res.Aggregations["tags"])
+		}
+		buckets, ok := agg.Buckets.([]types.StringTermsBucket)
+		if !ok || len(buckets) != 2 || buckets[0].Key != "one" || buckets[0].DocCount != 1 {
+			t.Errorf("Unexpected buckets: %#v", agg.Buckets)
+		}
+	})
+
+	t.Run("Decode enum", func(t *testing.T) {
+		res := index.NewResponse()
+		body := `{"_index":"test","_id":"1","_version":1,"result":"created","_seq_no":0,"_primary_term":1,"_shards":{"total":2,"successful":1,"failed":0}}`
+		if err := s.NewDecoder(strings.NewReader(body)).Decode(res); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Result != result.Created || res.Id_ != "1" || res.Version_ != 1 {
+			t.Errorf("Unexpected response: %+v", res)
+		}
+	})
+
+	t.Run("Decode error", func(t *testing.T) {
+		res := types.NewElasticsearchError()
+		if err := s.NewDecoder(strings.NewReader(errorResponse)).Decode(res); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if res.Status != 404 || res.ErrorCause.Type != "index_not_found_exception" {
+			t.Errorf("Unexpected error response: %+v", res)
+		}
+		if res.ErrorCause.Reason == nil || *res.ErrorCause.Reason != "no such index [test]" {
+			t.Errorf("Unexpected reason: %v", res.ErrorCause.Reason)
+		}
+		if len(res.ErrorCause.RootCause) != 1 {
+			t.Errorf("Unexpected root cause: %+v", res.ErrorCause.RootCause)
+		}
+	})
+
+	t.Run("Decode invalid", func(t *testing.T) {
+		res := search.NewResponse()
+		if err := s.NewDecoder(strings.NewReader(`{"took":`)).Decode(res); err == nil {
+			t.Errorf("Expected error for truncated input")
+		}
+		if err := s.NewDecoder(strings.NewReader(`{"took":"five"}`)).Decode(res); err == nil {
+			t.Errorf("Expected error for mismatched type")
+		}
+	})
+
+	t.Run("Concurrent use", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				doc := map[string]interface{}{"id": i}
+				data, err := s.Marshal(doc)
+				if err != nil {
+					errs <- err
+					return
+				}
+				var decoded map[string]int
+				if err := s.NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+					errs <- err
+					return
+				}
+				if decoded["id"] != i {
+					errs <- fmt.Errorf("unexpected document: %v", decoded)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+	})
+}
+
+// assertMarshal checks that the serializer encodes v like encoding/json, and returns the encoded value.
+func assertMarshal(t *testing.T, s serializer.Serializer, v interface{}) []byte {
+	t.Helper()
+
+	expected, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	actual, err := s.Marshal(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	assertJSONEqual(t, actual, expected)
+
+	return actual
+}
+
+// assertJSONEqual checks that the JSON values are semantically equal.
+func assertJSONEqual(t *testing.T, actual, expected []byte) {
+	t.Helper()
+
+	var a, e interface{}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		t.Fatalf("Invalid JSON: %s: %s", err, actual)
+	}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		t.Fatalf("Invalid JSON: %s: %s", err, expected)
+	}
+	if !reflect.DeepEqual(a, e) {
+		t.Errorf("Unexpected JSON:\n%s\nwant:\n%s", actual, expected)
+	}
+}
+
+func some(s string) *string {
+	return &s
+}
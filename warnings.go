@@ -0,0 +1,277 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxWarningMessages limits the number of distinct warning messages counted in the metrics.
+const maxWarningMessages = 100
+
+// ErrDeprecated is returned, wrapped in a DeprecationError, for responses with deprecation warnings in strict mode.
+var ErrDeprecated = errors.New("deprecated API usage")
+
+// WarningsConfig represents the configuration of the handling of the response warnings.
+//
+// Elasticsearch returns the deprecation warnings in the "Warning" HTTP header. Configure a Handler,
+// eg. LogWarnings, to act on them, and the Strict mode, eg. in continuous integration, to turn
+// them into errors, so that the usage of deprecated APIs surfaces before upgrading the cluster.
+//
+// The Strict mode can also be enabled with the ELASTIC_CLIENT_STRICT_DEPRECATIONS environment variable.
+// The number of warnings is reported in the client metrics.
+type WarningsConfig struct {
+	// Optional function called with the warnings of each response.
+	Handler func(req *http.Request, warnings []Warning)
+
+	// Return a DeprecationError instead of the responses with deprecation warnings.
+	Strict bool
+
+	// Optional function returning true for the warnings to ignore, eg. a known deprecation.
+	Ignore func(Warning) bool
+}
+
+// Warning represents a warning from the "Warning" HTTP header.
+type Warning struct {
+	Code  int    // Code of the warning; Elasticsearch uses 299 for the deprecations.
+	Agent string // Agent emitting the warning, eg. "Elasticsearch-8.6.0-f67ef2df".
+	Text  string // Text of the warning.
+}
+
+// ParseWarning parses the value of a "Warning" HTTP header, eg.:
+//
+//	299 Elasticsearch-8.6.0-f67ef2df "[xpack.monitoring.enabled] setting was deprecated"
+//
+// When the value doesn't follow the format, it's returned as the text of the warning.
+func ParseWarning(header string) Warning {
+	fields := strings.SplitN(strings.TrimSpace(header), " ", 3)
+	if len(fields) < 3 {
+		return Warning{Text: header}
+	}
+
+	code, err := strconv.Atoi(fields[0])
+	if err != nil || !strings.HasPrefix(fields[2], `"`) {
+		return Warning{Text: header}
+	}
+
+	// Find the closing quote of the text, skipping the escaped characters; the date may follow.
+	rest := fields[2]
+	end := -1
+	for i := 1; i < len(rest); i++ {
+		if rest[i] == '\\' {
+			i++
+			continue
+		}
+		if rest[i] == '"' {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return Warning{Text: header}
+	}
+
+	text, err := strconv.Unquote(rest[:end+1])
+	if err != nil {
+		text = strings.Replace(rest[1:end], `\"`, `"`, -1)
+	}
+
+	return Warning{Code: code, Agent: fields[1], Text: text}
+}
+
+// IsDeprecation returns true for the deprecation warnings.
+func (w Warning) IsDeprecation() bool {
+	return w.Code == 299
+}
+
+// String returns the text of the warning.
+func (w Warning) String() string {
+	return w.Text
+}
+
+// DeprecationError represents a response with deprecation warnings in strict mode.
+type DeprecationError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Warnings   []Warning
+}
+
+// Error returns the error message.
+func (e *DeprecationError) Error() string {
+	texts := make([]string, len(e.Warnings))
+	for i, w := range e.Warnings {
+		texts[i] = w.Text
+	}
+	return fmt.Sprintf("%s: %s %s: %s", ErrDeprecated, e.Method, e.Path, strings.Join(texts, "; "))
+}
+
+// Is allows to check the error with errors.Is(err, ErrDeprecated).
+func (e *DeprecationError) Is(target error) bool {
+	return target == ErrDeprecated
+}
+
+// LogWarnings returns a warnings handler writing the warnings to the logger.
+// When l is nil, the standard logger is used.
+func LogWarnings(l *log.Logger) func(*http.Request, []Warning) {
+	printf := log.Printf
+	if l != nil {
+		printf = l.Printf
+	}
+	return func(req *http.Request, warnings []Warning) {
+		for _, w := range warnings {
+			printf("Elasticsearch warning: %s %s: %s", req.Method, req.URL.Path, w.Text)
+		}
+	}
+}
+
+// WarningsMetric represents the metric information for the response warnings.
+type WarningsMetric struct {
+	Responses int            `json:"responses"`
+	Warnings  int            `json:"warnings"`
+	Messages  map[string]int `json:"messages,omitempty"`
+}
+
+// String returns the warnings information as a string.
+func (m WarningsMetric) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "{responses=%d warnings=%d", m.Responses, m.Warnings)
+
+	texts := make([]string, 0, len(m.Messages))
+	for text := range m.Messages {
+		texts = append(texts, text)
+	}
+	sort.Strings(texts)
+	for _, text := range texts {
+		fmt.Fprintf(&b, " %q=%d", text, m.Messages[text])
+	}
+
+	b.WriteString("}")
+	return b.String()
+}
+
+// warningsHandler handles the response warnings according to the configuration.
+type warningsHandler struct {
+	cfg WarningsConfig
+
+	mu        sync.Mutex
+	responses int
+	warnings  int
+	messages  map[string]int
+}
+
+func newWarningsHandler(cfg *WarningsConfig, strict bool) *warningsHandler {
+	if cfg == nil && !strict {
+		return nil
+	}
+
+	h := warningsHandler{messages: make(map[string]int)}
+	if cfg != nil {
+		h.cfg = *cfg
+	}
+	if strict {
+		h.cfg.Strict = true
+	}
+
+	return &h
+}
+
+// handle records the warnings of the response and calls the handler.
+//
+// In strict mode, it closes the response body and returns a DeprecationError
+// for a response with deprecation warnings.
+func (h *warningsHandler) handle(req *http.Request, res *http.Response) (*http.Response, error) {
+	if res == nil || len(res.Header["Warning"]) == 0 {
+		return res, nil
+	}
+
+	var warnings []Warning
+	for _, header := range res.Header["Warning"] {
+		w := ParseWarning(header)
+		if h.cfg.Ignore != nil && h.cfg.Ignore(w) {
+			continue
+		}
+		warnings = append(warnings, w)
+	}
+	if len(warnings) == 0 {
+		return res, nil
+	}
+
+	h.mu.Lock()
+	h.responses++
+	h.warnings += len(warnings)
+	for _, w := range warnings {
+		if _, ok := h.messages[w.Text]; ok || len(h.messages) < maxWarningMessages {
+			h.messages[w.Text]++
+		}
+	}
+	h.mu.Unlock()
+
+	if h.cfg.Handler != nil {
+		h.cfg.Handler(req, warnings)
+	}
+
+	if !h.cfg.Strict {
+		return res, nil
+	}
+
+	var deprecations []Warning
+	for _, w := range warnings {
+		if w.IsDeprecation() {
+			deprecations = append(deprecations, w)
+		}
+	}
+	if len(deprecations) == 0 {
+		return res, nil
+	}
+
+	if res.Body != nil {
+		io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}
+
+	return nil, &DeprecationError{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		StatusCode: res.StatusCode,
+		Warnings:   deprecations,
+	}
+}
+
+func (h *warningsHandler) metric() WarningsMetric {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	m := WarningsMetric{Responses: h.responses, Warnings: h.warnings}
+	if len(h.messages) > 0 {
+		m.Messages = make(map[string]int, len(h.messages))
+		for text, n := range h.messages {
+			m.Messages[text] = n
+		}
+	}
+	return m
+}
@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+// +build !integration
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseWarning(t *testing.T) {
+	tests := []struct {
+		header  string
+		warning Warning
+	}{
+		{
+			`299 Elasticsearch-8.6.0-f67ef2df "[xpack.monitoring.enabled] setting was deprecated"`,
+			Warning{Code: 299, Agent: "Elasticsearch-8.6.0-f67ef2df", Text: "[xpack.monitoring.enabled] setting was deprecated"},
+		},
+		{
+			`299 Elasticsearch-7.17.0 "the \"foo\" parameter is deprecated" "Mon, 01 Jan 2022 00:00:00 GMT"`,
+			Warning{Code: 299, Agent: "Elasticsearch-7.17.0", Text: `the "foo" parameter is deprecated`},
+		},
+		{
+			`something unexpected`,
+			Warning{Text: "something unexpected"},
+		},
+	}
+
+	for _, tt := range tests {
+		if w := ParseWarning(tt.header); w != tt.warning {
+			t.Errorf("Unexpected warning for %s: %#v, want: %#v", tt.header, w, tt.warning)
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	deprecation := `299 Elasticsearch-8.6.0 "[types removal] Specifying types in search requests is deprecated."`
+
+	transport := &mockTransp{RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+		res := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"X-Elastic-Product": []string{"Elasticsearch"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{}`)),
+		}
+		if req.URL.Path != "/" {
+			res.Header.Add("Warning", deprecation)
+			res.Header.Add("Warning", `199 Elasticsearch-8.6.0 "some other warning"`)
+		}
+		return res, nil
+	}}
+
+	t.Run("Handler", func(t *testing.T) {
+		var buf bytes.Buffer
+		c, _ := NewClient(Config{
+			Transport: transport,
+			Warnings:  &WarningsConfig{Handler: LogWarnings(log.New(&buf, "", 0))},
+		})
+
+		for i := 0; i < 2; i++ {
+			res, err := c.Search()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			res.Body.Close()
+		}
+
+		if !strings.Contains(buf.String(), "Elasticsearch warning: POST /_search: [types removal]") {
+			t.Errorf("Unexpected log output: %s", buf.String())
+		}
+
+		m := c.ClientMetrics()
+		if m.Warnings == nil || m.Warnings.Responses != 2 || m.Warnings.Warnings != 4 {
+			t.Fatalf("Unexpected metrics: %+v", m.Warnings)
+		}
+		if n := m.Warnings.Messages["some other warning"]; n != 2 {
+			t.Errorf("Unexpected number of messages: %d", n)
+		}
+		if !strings.Contains(m.String(), "Warnings: {responses=2 warnings=4") {
+			t.Errorf("Unexpected metrics string: %s", m)
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		c, _ := NewTypedClient(Config{Transport: transport, Warnings: &WarningsConfig{Strict: true}})
+
+		if _, err := c.Info().Do(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		_, err := c.Search().Do(context.Background())
+		if !errors.Is(err, ErrDeprecated) {
+			t.Fatalf("Expected deprecation error, got: %v", err)
+		}
+		var depErr *DeprecationError
+		if !errors.As(err, &depErr) || len(depErr.Warnings) != 1 || depErr.Path != "/_search" {
+			t.Errorf("Unexpected error: %#v", err)
+		}
+	})
+
+	t.Run("Strict with ignored warnings", func(t *testing.T) {
+		c, _ := NewClient(Config{
+			Transport: transport,
+			Warnings: &WarningsConfig{
+				Strict: true,
+				Ignore: func(w Warning) bool { return strings.HasPrefix(w.Text, "[types removal]") },
+			},
+		})
+
+		res, err := c.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		res.Body.Close()
+	})
+
+	t.Run("Strict from environment", func(t *testing.T) {
+		os.Setenv(esStrictDeprecations, "true")
+		defer os.Unsetenv(esStrictDeprecations)
+
+		c, _ := NewClient(Config{Transport: transport})
+		if _, err := c.Search(); !errors.Is(err, ErrDeprecated) {
+			t.Errorf("Expected deprecation error, got: %v", err)
+		}
+	})
+}